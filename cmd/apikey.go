@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	apiKey     string
+	configFile string
+)
+
+// config is the configuration file of the CLI.
+type config struct {
+	APIKey string `yaml:"apiKey"`
+}
+
+// configuredAPIKey returns the API key of the --api-key flag, which defaults
+// to QUIZ_API_KEY, or else the one of the config file. A missing config file
+// is only an error if it was given with --config.
+func configuredAPIKey() (string, error) {
+	if apiKey != "" {
+		return apiKey, nil
+	}
+
+	path := configFile
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", nil
+		}
+		path = filepath.Join(home, ".quiz-api.yaml")
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && configFile == "" {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading config: %v", err)
+	}
+
+	var cfg config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return "", fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	return cfg.APIKey, nil
+}
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&apiKey, "api-key", os.Getenv("QUIZ_API_KEY"), "API key to authenticate with instead of a token")
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "config file holding the apiKey (default is $HOME/.quiz-api.yaml)")
+}
@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/spf13/cobra"
+)
+
+var (
+	token    string
+	password string
+)
+
+var loginCmd = &cobra.Command{
+	Use:   "login",
+	Short: "Log in and print the token to send with --token",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := json.Marshal(models.Credentials{UserName: username, Password: password})
+		if err != nil {
+			return err
+		}
+
+		resp, err := http.Post("http://localhost:4000/v1/users/login", "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			return fmt.Errorf("error logging in: %v", err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("failed to log in, status: %s", resp.Status)
+		}
+
+		var login models.LoginResponse
+		if err := json.NewDecoder(resp.Body).Decode(&login); err != nil {
+			return fmt.Errorf("error decoding response: %v", err)
+		}
+		fmt.Println(login.Token)
+		return nil
+	},
+}
+
+// authorizedRequest creates a request carrying the token of the --token flag
+// or, without one, the configured API key.
+func authorizedRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return req, nil
+	}
+	key, err := configuredAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	return req, nil
+}
+
+func init() {
+	rootCmd.AddCommand(loginCmd)
+	rootCmd.PersistentFlags().StringVar(&token, "token", os.Getenv("QUIZ_TOKEN"), "token of the logged in user, see the login command")
+
+	loginCmd.Flags().StringVarP(&username, "user", "u", "", "Username to log in as")
+	loginCmd.Flags().StringVarP(&password, "password", "p", "", "Password of the user")
+}
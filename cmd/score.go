@@ -21,7 +21,11 @@ var getSubmissionCmd = &cobra.Command{
 
 		url := fmt.Sprintf("http://localhost:4000/v1/quiz/submission/%s", username)
 		fmt.Printf("Fetching submission for user: %s\n", url)
-		resp, err := http.Get(url)
+		req, err := authorizedRequest("GET", url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			return fmt.Errorf("error fetching submission: %v", err)
 		}
@@ -32,10 +36,12 @@ var getSubmissionCmd = &cobra.Command{
 		}
 
 		var submissionResponse struct {
-			Message               string `json:"message"`
-			Score                 int    `json:"score"`
-			Rank                  string `json:"rank"`
-			TotalQuestionAnswered int    `json:"total_question_answered"`
+			Message               string  `json:"message"`
+			Score                 float64 `json:"score"`
+			MaxScore              float64 `json:"maxScore"`
+			Percentage            float64 `json:"percentage"`
+			Rank                  string  `json:"rank"`
+			TotalQuestionAnswered int     `json:"totalQuestionCount"`
 		}
 
 		if err := json.NewDecoder(resp.Body).Decode(&submissionResponse); err != nil {
@@ -44,7 +50,7 @@ var getSubmissionCmd = &cobra.Command{
 
 		fmt.Printf("User Submission for %s:\n", username)
 		fmt.Printf("Message: %s\n", submissionResponse.Message)
-		fmt.Printf("Score: %d\n", submissionResponse.Score)
+		fmt.Printf("Score: %g/%g (%.2f%%)\n", submissionResponse.Score, submissionResponse.MaxScore, submissionResponse.Percentage)
 		fmt.Printf("Rank: %s\n", submissionResponse.Rank)
 		fmt.Printf("Total Questions Answered: %d\n", submissionResponse.TotalQuestionAnswered)
 
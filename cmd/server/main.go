@@ -3,12 +3,18 @@ package main
 import (
 	"context"
 
+	"crypto/rand"
+
+	"database/sql"
+
 	"flag"
 
 	"os"
 
 	"fmt"
 
+	"io"
+
 	"time"
 
 	"os/signal"
@@ -23,36 +29,106 @@ import (
 
 	"github.com/go-ozzo/ozzo-routing/v2/cors"
 
+	"github.com/golang-jwt/jwt/v5"
+
 	"github.com/courage173/quiz-api/pkg/accesslog"
 
 	"github.com/courage173/quiz-api/pkg/log"
 
+	"github.com/courage173/quiz-api/internal/apikey"
+
+	"github.com/courage173/quiz-api/internal/auth"
+
 	"github.com/courage173/quiz-api/internal/errors"
 
 	"github.com/courage173/quiz-api/internal/healthcheck"
 
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/question"
+
+	"github.com/courage173/quiz-api/internal/questionbank"
+
 	"github.com/courage173/quiz-api/internal/quiz"
 
+	"github.com/courage173/quiz-api/internal/ratelimit"
+
 	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/internal/team"
+
+	"github.com/courage173/quiz-api/internal/user"
+
+	_ "modernc.org/sqlite"
 )
 
 var (
-	Version    string = "1.0.0"
-	listenAddr string
-	healthy    int32
+	Version        string = "1.0.0"
+	listenAddr     string
+	adminToken     string
+	jwtSecret      string
+	jwtKeyFile     string
+	tokenTTL       time.Duration
+	storageKind    string
+	dataDir        string
+	databaseDSN    string
+	rankingPolicy  string
+	questionDir    string
+	reloadInterval time.Duration
+	rateLimit      int
+	submitLimit    int
+	authLimit      int
+	healthy        int32
 )
 
 func main() {
 	flag.StringVar(&listenAddr, "listen-addr", "localhost:4000", "server listen address")
+	flag.StringVar(&adminToken, "admin-token", os.Getenv("QUIZ_ADMIN_TOKEN"), "bearer token authenticating as admin")
+	flag.StringVar(&jwtSecret, "jwt-secret", os.Getenv("QUIZ_JWT_SECRET"), "secret the user tokens are signed with using HS256; a random one is used if empty")
+	flag.StringVar(&jwtKeyFile, "jwt-private-key", os.Getenv("QUIZ_JWT_PRIVATE_KEY"), "PEM file of the RSA key the user tokens are signed with using RS256 instead")
+	flag.DurationVar(&tokenTTL, "token-ttl", auth.DefaultTokenTTL, "how long the tokens issued on login are valid")
+	flag.StringVar(&storageKind, "storage", "memory", "storage backend to use: memory, file or sql")
+	flag.StringVar(&dataDir, "data-dir", "data", "directory holding the file storage log and snapshot")
+	flag.StringVar(&databaseDSN, "database-dsn", "file:quiz.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate", "SQLite data source name used by the sql storage")
+	flag.StringVar(&rankingPolicy, "ranking-policy", string(storage.RankLatest), "which attempt of a user is ranked: best, latest or first")
+	flag.StringVar(&questionDir, "questions", "", "directory of JSON or YAML question banks to load instead of the built-in questions")
+	flag.DurationVar(&reloadInterval, "questions-poll-interval", 5*time.Second, "how often the question bank directory is checked for changes")
+	flag.IntVar(&rateLimit, "rate-limit", 600, "requests per minute a client may make; 0 disables the limit")
+	flag.IntVar(&submitLimit, "submit-rate-limit", 10, "submissions, logins and registrations per minute a client may make; 0 applies -rate-limit to them")
+	flag.IntVar(&authLimit, "auth-rate-limit", 20, "failed authentications per minute an IP may make; 0 disables the limit")
 	flag.Parse()
 
 	// create root logger tagged with server version
 	logger := log.New().With(nil, "version", Version)
 
+	store, err := buildStorage(logger)
+	if err != nil {
+		logger.Errorf("Could not open storage: %v", err)
+		os.Exit(1)
+	}
+
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	defer stopWatching()
+
+	var reloader *questionbank.Reloader
+	if questionDir != "" {
+		reloader = questionbank.NewReloader(questionDir, store, logger)
+		if _, err := reloader.Reload(); err != nil {
+			logger.Errorf("Could not load question banks: %v", err)
+			os.Exit(1)
+		}
+		go reloader.Watch(watchCtx, reloadInterval)
+	}
+
+	tokens, err := buildTokens(logger)
+	if err != nil {
+		logger.Errorf("Could not set up user tokens: %v", err)
+		os.Exit(1)
+	}
+
 	fmt.Println(listenAddr)
 	server := &http.Server{
 		Addr:         listenAddr,
-		Handler:      buildHandler(logger),
+		Handler:      buildHandler(logger, store, reloader, tokens),
 		ReadTimeout:  5 * time.Second,
 		WriteTimeout: 10 * time.Second,
 		IdleTimeout:  15 * time.Second,
@@ -66,6 +142,7 @@ func main() {
 		<-quit
 		fmt.Println("Server is shutting down...")
 		atomic.StoreInt32(&healthy, 0)
+		stopWatching()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 		defer cancel()
@@ -84,29 +161,160 @@ func main() {
 	}
 
 	<-done
+
+	if closer, ok := store.(io.Closer); ok {
+		if err := closer.Close(); err != nil {
+			logger.Errorf("Could not close storage: %v", err)
+		}
+	}
 	fmt.Println("Server stopped")
 }
 
+// buildStorage creates the storage backend selected by the -storage flag.
+func buildStorage(logger log.Logger) (storage.Storage, error) {
+	policy, err := storage.ParseRankingPolicy(rankingPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	switch storageKind {
+	case "memory":
+		return storage.NewStorage(policy), nil
+	case "file":
+		return storage.NewFileStorage(dataDir, storage.DefaultSnapshotInterval, policy, logger)
+	case "sql":
+		db, err := sql.Open("sqlite", databaseDSN)
+		if err != nil {
+			return nil, err
+		}
+		store, err := storage.NewSQLStorage(db, policy, logger)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", storageKind)
+	}
+}
+
+// buildTokens creates the issuer of user tokens. Tokens are signed with RS256
+// if a -jwt-private-key is given and with HS256 otherwise. Without a
+// -jwt-secret either, they are signed with a random secret and do not
+// survive restarts.
+func buildTokens(logger log.Logger) (*auth.Tokens, error) {
+	if jwtKeyFile != "" {
+		data, err := os.ReadFile(jwtKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		key, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", jwtKeyFile, err)
+		}
+		return auth.NewRSATokens(key, tokenTTL), nil
+	}
+
+	secret := []byte(jwtSecret)
+	if len(secret) == 0 {
+		logger.Infof("No JWT secret configured, user tokens are signed with a random secret")
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return auth.NewTokens(secret, tokenTTL), nil
+}
+
+// buildRateLimiter creates the middleware limiting the requests per minute of
+// every client to -rate-limit, and those of the routes open to brute force to
+// -submit-rate-limit.
+func buildRateLimiter() routing.Handler {
+	var limiter *ratelimit.Limiter
+	if rateLimit > 0 {
+		limiter = ratelimit.NewLimiter(ratelimit.Limit{Requests: rateLimit, Per: time.Minute}, nil)
+	}
+	submitLimiter := limiter
+	if submitLimit > 0 {
+		submitLimiter = ratelimit.NewLimiter(ratelimit.Limit{Requests: submitLimit, Per: time.Minute}, nil)
+	}
+	// the submission routes share a bucket, so that spreading submissions
+	// over quizzes does not raise the limit
+	return ratelimit.Handler(limiter,
+		ratelimit.Rule{Method: http.MethodPost, Path: "/v1/quiz/submit", Limiter: submitLimiter},
+		ratelimit.Rule{Method: http.MethodPost, Path: "/v1/quizzes/*/submit", Limiter: submitLimiter},
+		ratelimit.Rule{Method: http.MethodPost, Path: "/v1/users/login", Limiter: submitLimiter},
+		ratelimit.Rule{Method: http.MethodPost, Path: "/v1/users", Limiter: submitLimiter},
+	)
+}
+
+// buildFailureLimiter returns a middleware limiting the failed
+// authentications of every IP to -auth-rate-limit.
+func buildFailureLimiter() routing.Handler {
+	if authLimit <= 0 {
+		return func(*routing.Context) error { return nil }
+	}
+	return ratelimit.FailureHandler(ratelimit.NewLimiter(ratelimit.Limit{Requests: authLimit, Per: time.Minute}, nil))
+}
+
 // buildHandler sets up the HTTP routing and builds an HTTP handler.
-func buildHandler(logger log.Logger) http.Handler {
+func buildHandler(logger log.Logger, store storage.Storage, reloader *questionbank.Reloader, tokens *auth.Tokens) http.Handler {
 	router := routing.New()
 
+	apikeyService := apikey.NewService(store, logger)
+
+	userService := user.NewService(store, tokens, logger)
+
 	router.Use(
 		accesslog.Handler(logger),
 		errors.Handler(logger),
 		content.TypeNegotiator(content.JSON),
 		cors.Handler(cors.AllowAll),
+		buildFailureLimiter(),
+		auth.Handler(tokens, userService, adminToken),
+		auth.APIKeyHandler(apikeyService),
+		buildRateLimiter(),
 	)
 
 	healthcheck.RegisterHandlers(router, Version)
 
 	rg := router.Group("/v1")
 
-	storage := storage.NewStorage()
+	participant := auth.RequireRole(models.RoleParticipant)
 
-	quiz.RegisterHandlers(rg.Group("/quiz"),
-		quiz.NewService(storage, logger), logger,
-	)
+	user.RegisterHandlers(rg.Group("/users"), userService, participant, logger)
+
+	quizService := quiz.NewService(store, logger)
+
+	quiz.RegisterHandlers(rg.Group("/quiz"), quizService, participant, logger)
+
+	quiz.RegisterQuizzesHandlers(rg.Group("/quizzes"), quizService, participant, logger)
+
+	teamService := team.NewService(store, logger)
+
+	team.RegisterHandlers(rg.Group("/teams"), teamService, logger)
+
+	// groups given handlers do not inherit the middlewares of their parent,
+	// so the role checks are added with Use
+	authors := rg.Group("/admin")
+	authors.Use(auth.RequireRole(models.RoleAuthor))
+
+	admins := rg.Group("/admin")
+	admins.Use(auth.RequireRole(models.RoleAdmin))
+
+	quiz.RegisterAdminHandlers(authors.Group("/quiz"), quizService, logger)
+
+	question.RegisterHandlers(authors.Group("/questions"), question.NewService(store, logger), logger)
+
+	if reloader != nil {
+		questionbank.RegisterHandlers(authors.Group("/questionbank"), reloader, logger)
+	}
+
+	team.RegisterAdminHandlers(admins.Group("/teams"), teamService, logger)
+
+	user.RegisterAdminHandlers(admins.Group("/users"), userService, logger)
+
+	apikey.RegisterAdminHandlers(admins.Group("/apikeys"), apikeyService, logger)
 
 	return router
 }
@@ -78,8 +78,14 @@ var answerCmd = &cobra.Command{
 			return
 		}
 
-		// Send POST request to the API
-		resp, err := http.Post("http://localhost:4000/v1/quiz/submit", "application/json", bytes.NewBuffer(data))
+		// Send POST request to the API as the logged in user
+		req, err := authorizedRequest("POST", "http://localhost:4000/v1/quiz/submit", bytes.NewBuffer(data))
+		if err != nil {
+			fmt.Println("Error creating request:", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := http.DefaultClient.Do(req)
 		if err != nil {
 			fmt.Println("Error submitting answers:", err)
 			return
@@ -95,5 +101,5 @@ var answerCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(answerCmd)
 	// Add user flag to specify which user's answers to submit
-	answerCmd.Flags().StringVarP(&selectedUser, "user", "u", "", "Specify the user (user1, user2, user3)")
+	answerCmd.Flags().StringVarP(&selectedUser, "user", "u", "", "Specify the answers to submit (user1, user2, user3)")
 }
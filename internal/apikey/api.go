@@ -0,0 +1,76 @@
+package apikey
+
+import (
+	stderrors "errors"
+	"net/http"
+
+	"github.com/courage173/quiz-api/internal/errors"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterAdminHandlers registers the routes minting, listing and revoking
+// API keys. The route group is expected to be restricted to admins.
+func RegisterAdminHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
+	rg.Post("", createKey(service, logger))
+	rg.Get("", listKeys(service, logger))
+	rg.Delete("/<id>", revokeKey(service, logger))
+}
+
+// toErrorResponse maps errors returned by the service to error responses.
+// Validation errors are passed on as they are.
+func toErrorResponse(err error) error {
+	switch {
+	case stderrors.Is(err, storage.ErrAPIKeyNotFound):
+		return errors.NotFound(err.Error())
+	case stderrors.Is(err, storage.ErrUserNotFound):
+		return errors.BadRequest(err.Error())
+	}
+	return err
+}
+
+func createKey(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req models.APIKeyRequest
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		response, err := service.Create(req)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error creating API key: %v", err)
+			return toErrorResponse(err)
+		}
+		logger.With(c.Request.Context()).Infof("Created API key %s (%s)", response.ID, response.Prefix)
+		return c.WriteWithStatus(response, http.StatusCreated)
+	}
+}
+
+func listKeys(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.GetAPIKeys()
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error listing API keys: %v", err)
+			return err
+		}
+		return c.Write(response)
+	}
+}
+
+func revokeKey(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		if err := service.Revoke(c.Param("id")); err != nil {
+			logger.With(c.Request.Context()).Errorf("Error revoking API key: %v", err)
+			return toErrorResponse(err)
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
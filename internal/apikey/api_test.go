@@ -0,0 +1,84 @@
+package apikey_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/apikey"
+	"github.com/courage173/quiz-api/internal/auth"
+	"github.com/courage173/quiz-api/internal/errors"
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIKeyHandlers(t *testing.T) {
+	logger, _ := log.NewForTest()
+	service := apikey.NewService(storage.NewStorage(storage.RankLatest), logger)
+
+	router := routing.New()
+	router.Use(
+		errors.Handler(logger),
+		content.TypeNegotiator(content.JSON),
+		auth.Handler(auth.NewTokens([]byte("secret"), time.Hour), nil, "admin-secret"),
+		auth.APIKeyHandler(service),
+	)
+	admin := router.Group("/v1/admin/apikeys")
+	admin.Use(auth.RequireRole(models.RoleAdmin))
+	apikey.RegisterAdminHandlers(admin, service, logger)
+
+	do := func(method, url, body string, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := do("POST", "/v1/admin/apikeys", `{"name":"ci","scopes":["quiz","admin"]}`, "Authorization", "Bearer admin-secret")
+	require.Equal(t, http.StatusCreated, resp.Code)
+	var created models.NewAPIKey
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	assert.NotEmpty(t, created.Key)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		header   string
+		value    string
+		wantCode int
+		wantBody string
+	}{
+		{"create invalid", "POST", "/v1/admin/apikeys", `{"name":"ci"}`, "Authorization", "Bearer admin-secret", http.StatusBadRequest, "scopes"},
+		{"create for unknown user", "POST", "/v1/admin/apikeys", `{"name":"bot","userId":"u1","scopes":["quiz"]}`, "Authorization", "Bearer admin-secret", http.StatusBadRequest, "user not found"},
+		{"list without authentication", "GET", "/v1/admin/apikeys", "", "", "", http.StatusUnauthorized, ""},
+		{"list with the key", "GET", "/v1/admin/apikeys", "", auth.APIKeyHeader, created.Key, http.StatusOK, `"prefix":"` + created.Prefix + `"`},
+		{"revoke unknown", "DELETE", "/v1/admin/apikeys/unknown", "", "Authorization", "Bearer admin-secret", http.StatusNotFound, "API key not found"},
+		{"revoke", "DELETE", "/v1/admin/apikeys/" + created.ID, "", "Authorization", "Bearer admin-secret", http.StatusNoContent, ""},
+		{"list with the revoked key", "GET", "/v1/admin/apikeys", "", auth.APIKeyHeader, created.Key, http.StatusUnauthorized, "revoked"},
+		{"list", "GET", "/v1/admin/apikeys", "", "Authorization", "Bearer admin-secret", http.StatusOK, `"revokedAt"`},
+	}
+
+	// the cases build on each other and run in order
+	for _, tt := range tests {
+		resp := do(tt.method, tt.url, tt.body, tt.header, tt.value)
+
+		assert.Equal(t, tt.wantCode, resp.Code, tt.name)
+		assert.Contains(t, resp.Body.String(), tt.wantBody, tt.name)
+		assert.NotContains(t, resp.Body.String(), `"hash"`, tt.name)
+		assert.NotContains(t, resp.Body.String(), created.Key, tt.name)
+	}
+}
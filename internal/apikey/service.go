@@ -0,0 +1,143 @@
+// Package apikey mints and resolves the API keys machine clients authenticate
+// with.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	stderrors "errors"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/auth"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	"github.com/google/uuid"
+)
+
+// keyPrefix starts every API key so that leaked keys are easy to search for.
+const keyPrefix = "qk_"
+
+// shownPrefixLength is how much of a key is kept in the clear to tell keys
+// apart.
+const shownPrefixLength = len(keyPrefix) + 8
+
+// ErrInvalidKey is returned when resolving a key that is unknown, revoked or
+// minted for a user that no longer exists. The cases are not told apart.
+var ErrInvalidKey = stderrors.New("invalid or revoked API key")
+
+// Service mints, lists and revokes API keys and resolves them to the
+// principal they authenticate as.
+type Service interface {
+	Create(req models.APIKeyRequest) (models.NewAPIKey, error)
+	GetAPIKeys() ([]models.APIKeyInfo, error)
+	Revoke(id string) error
+	Resolve(key string) (auth.Principal, error)
+}
+
+type service struct {
+	storage storage.Storage
+	logger  log.Logger
+}
+
+func NewService(storage storage.Storage, logger log.Logger) Service {
+	return service{
+		storage,
+		logger,
+	}
+}
+
+// Create mints a random key. Only its hash is stored, so the key itself is
+// returned once and cannot be recovered.
+func (s service) Create(req models.APIKeyRequest) (models.NewAPIKey, error) {
+	if err := req.Validate(); err != nil {
+		return models.NewAPIKey{}, err
+	}
+	if req.UserID != "" {
+		if _, err := s.storage.GetUser(req.UserID); err != nil {
+			return models.NewAPIKey{}, err
+		}
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return models.NewAPIKey{}, err
+	}
+	key := keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+
+	apiKey := models.APIKey{
+		ID:        uuid.NewString(),
+		Name:      req.Name,
+		Prefix:    key[:shownPrefixLength],
+		Hash:      hashKey(key),
+		UserID:    req.UserID,
+		Scopes:    req.Scopes,
+		CreatedAt: time.Now().UTC(),
+	}
+	if err := s.storage.CreateAPIKey(apiKey); err != nil {
+		return models.NewAPIKey{}, err
+	}
+	return models.NewAPIKey{APIKeyInfo: apiKey.Info(), Key: key}, nil
+}
+
+func (s service) GetAPIKeys() ([]models.APIKeyInfo, error) {
+	keys, err := s.storage.GetAPIKeys()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]models.APIKeyInfo, len(keys))
+	for i, key := range keys {
+		infos[i] = key.Info()
+	}
+	return infos, nil
+}
+
+// Revoke stops the key from authenticating. Revoked keys are kept and listed.
+func (s service) Revoke(id string) error {
+	return s.storage.RevokeAPIKey(id, time.Now().UTC())
+}
+
+// Resolve returns the principal of the key. Keys minted for a user act as the
+// user with its current role, the others as admins, both limited to the
+// scopes of the key.
+func (s service) Resolve(key string) (auth.Principal, error) {
+	apiKey, err := s.storage.GetAPIKeyByHash(hashKey(key))
+	if stderrors.Is(err, storage.ErrAPIKeyNotFound) {
+		return auth.Principal{}, ErrInvalidKey
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	if apiKey.RevokedAt != nil {
+		return auth.Principal{}, ErrInvalidKey
+	}
+
+	scopes := apiKey.Scopes
+	if scopes == nil {
+		scopes = []models.Scope{}
+	}
+	if apiKey.UserID == "" {
+		return auth.Principal{UserName: "key:" + apiKey.Name, Role: models.RoleAdmin, KeyID: apiKey.ID, Scopes: scopes}, nil
+	}
+	user, err := s.storage.GetUser(apiKey.UserID)
+	if stderrors.Is(err, storage.ErrUserNotFound) {
+		return auth.Principal{}, ErrInvalidKey
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	return auth.Principal{UserID: user.ID, UserName: user.UserName, Role: user.Role, KeyID: apiKey.ID, Scopes: scopes}, nil
+}
+
+// hashKey returns the SHA-256 hash keys are stored and looked up by. Unlike
+// passwords, keys are random enough not to need a slow hash.
+func hashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,91 @@
+package apikey_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/apikey"
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/pkg/log"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestService_Create(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	service := apikey.NewService(store, logger)
+
+	created, err := service.Create(models.APIKeyRequest{Name: "ci", Scopes: []models.Scope{models.ScopeQuiz}})
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(created.Key, "qk_"))
+	assert.True(t, strings.HasPrefix(created.Key, created.Prefix))
+	assert.Less(t, len(created.Prefix), len(created.Key))
+
+	// only the hash of the key is stored
+	keys, err := store.GetAPIKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 1)
+	assert.NotEmpty(t, keys[0].Hash)
+	assert.NotContains(t, keys[0].Hash, created.Key)
+
+	for _, req := range []models.APIKeyRequest{
+		{Scopes: []models.Scope{models.ScopeQuiz}},
+		{Name: "no scopes"},
+		{Name: "unknown scope", Scopes: []models.Scope{"everything"}},
+	} {
+		_, err = service.Create(req)
+		assert.IsType(t, validation.Errors{}, err, req.Name)
+	}
+
+	_, err = service.Create(models.APIKeyRequest{Name: "bot", UserID: "unknown", Scopes: []models.Scope{models.ScopeQuiz}})
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+func TestService_Resolve(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	require.NoError(t, store.CreateUser(models.User{ID: "u1", UserName: "ann", PasswordHash: "hash", CreatedAt: time.Now()}))
+	service := apikey.NewService(store, logger)
+
+	ci, err := service.Create(models.APIKeyRequest{Name: "ci", Scopes: []models.Scope{models.ScopeQuiz, models.ScopeQuestions}})
+	require.NoError(t, err)
+	bot, err := service.Create(models.APIKeyRequest{Name: "bot", UserID: "u1", Scopes: []models.Scope{models.ScopeQuiz}})
+	require.NoError(t, err)
+
+	// keys without a user act as admins limited to their scopes
+	principal, err := service.Resolve(ci.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "key:ci", principal.UserName)
+	assert.Equal(t, ci.ID, principal.KeyID)
+	assert.Empty(t, principal.UserID)
+	assert.True(t, principal.Allows(models.RoleAuthor))
+	assert.False(t, principal.Allows(models.RoleAdmin))
+
+	// keys of a user act as the user with its current role
+	require.NoError(t, store.SetUserRole("u1", models.RoleAuthor))
+	principal, err = service.Resolve(bot.Key)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", principal.UserID)
+	assert.Equal(t, "ann", principal.UserName)
+	assert.Equal(t, models.RoleAuthor, principal.Role)
+	assert.True(t, principal.Allows(models.RoleParticipant))
+	assert.False(t, principal.Allows(models.RoleAuthor))
+
+	_, err = service.Resolve("qk_unknown")
+	assert.ErrorIs(t, err, apikey.ErrInvalidKey)
+
+	require.NoError(t, service.Revoke(ci.ID))
+	_, err = service.Resolve(ci.Key)
+	assert.ErrorIs(t, err, apikey.ErrInvalidKey)
+	assert.ErrorIs(t, service.Revoke("unknown"), storage.ErrAPIKeyNotFound)
+
+	keys, err := service.GetAPIKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Nil(t, keys[0].RevokedAt)
+	assert.NotNil(t, keys[1].RevokedAt)
+}
@@ -0,0 +1,145 @@
+// Package auth provides middlewares that restrict access to API routes.
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"strings"
+
+	"github.com/courage173/quiz-api/internal/errors"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// AdminPrincipal is the principal of requests authenticated with the admin
+// token.
+var AdminPrincipal = Principal{UserName: "admin", Role: models.RoleAdmin}
+
+// APIKeyHeader is the header API keys are sent in.
+const APIKeyHeader = "X-API-Key"
+
+// Handler returns a middleware that authenticates requests carrying a bearer
+// token. The principal of the token is added to the request context, next to
+// the request ID, and requests with an invalid token are rejected. Requests
+// without a token pass through anonymously; RequireRole guards the routes that
+// need a principal.
+//
+// The role in a token is the one the user had when it was issued, so the
+// principal is reloaded from users, which rejects tokens of deleted users. A
+// nil users trusts the token as it is.
+//
+// A bearer token equal to adminToken authenticates as AdminPrincipal. If
+// adminToken is empty, no token does.
+func Handler(tokens *Tokens, users Users, adminToken string) routing.Handler {
+	return func(c *routing.Context) error {
+		token, ok := bearerToken(c)
+		if !ok {
+			return nil
+		}
+
+		var principal Principal
+		if adminToken != "" && subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) == 1 {
+			principal = AdminPrincipal
+		} else {
+			var err error
+			if principal, err = tokens.Verify(token); err != nil {
+				return errors.Unauthorized("The token is invalid or has expired")
+			}
+			if users != nil {
+				if principal, err = users.Resolve(principal.UserID); err != nil {
+					return errors.Unauthorized("The token is invalid or has expired")
+				}
+			}
+		}
+
+		ctx := WithPrincipal(c.Request.Context(), principal)
+		if principal.UserID != "" {
+			ctx = log.WithUserID(ctx, principal.UserID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		return nil
+	}
+}
+
+// Users resolves the ID of the user a token is issued to to its current
+// principal.
+type Users interface {
+	Resolve(id string) (Principal, error)
+}
+
+// Keys resolves API keys to the principal they authenticate as.
+type Keys interface {
+	Resolve(key string) (Principal, error)
+}
+
+// APIKeyHandler returns a middleware that authenticates requests carrying an
+// API key in the X-API-Key header, as Handler does for bearer tokens. It must
+// come after Handler, as requests carrying both are rejected.
+func APIKeyHandler(keys Keys) routing.Handler {
+	return func(c *routing.Context) error {
+		key := strings.TrimSpace(c.Request.Header.Get(APIKeyHeader))
+		if key == "" {
+			return nil
+		}
+		if _, ok := CurrentPrincipal(c.Request.Context()); ok {
+			return errors.BadRequest("Send either a bearer token or an API key")
+		}
+
+		principal, err := keys.Resolve(key)
+		if err != nil {
+			return errors.Unauthorized("The API key is invalid or has been revoked")
+		}
+
+		ctx := WithPrincipal(c.Request.Context(), principal)
+		if principal.UserID != "" {
+			ctx = log.WithUserID(ctx, principal.UserID)
+		}
+		c.Request = c.Request.WithContext(ctx)
+		return nil
+	}
+}
+
+// RequireRole returns a middleware that only lets through requests whose
+// principal has a role including the given one and, for API keys, the scope
+// of the role.
+func RequireRole(role models.Role) routing.Handler {
+	return func(c *routing.Context) error {
+		principal, ok := CurrentPrincipal(c.Request.Context())
+		if !ok {
+			return errors.Unauthorized("")
+		}
+		if !principal.Allows(role) {
+			return errors.Forbidden("")
+		}
+		return nil
+	}
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+// WithPrincipal returns a context carrying the principal of the request.
+func WithPrincipal(ctx context.Context, principal Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+// CurrentPrincipal returns the principal added by Handler.
+func CurrentPrincipal(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(Principal)
+	return principal, ok
+}
+
+// bearerToken extracts the token from the Authorization header of the request.
+func bearerToken(c *routing.Context) (string, bool) {
+	header := c.Request.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	token := strings.TrimSpace(header[7:])
+	return token, token != ""
+}
@@ -0,0 +1,201 @@
+package auth_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/auth"
+	"github.com/courage173/quiz-api/internal/errors"
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequireRole(t *testing.T) {
+	logger, _ := log.NewForTest()
+	tokens := auth.NewTokens([]byte("secret"), time.Hour)
+
+	router := routing.New()
+	router.Use(errors.Handler(logger), auth.Handler(tokens, nil, "admin-secret"))
+	whoami := func(c *routing.Context) error {
+		principal, _ := auth.CurrentPrincipal(c.Request.Context())
+		return c.Write(principal.UserName)
+	}
+	router.Get("/public", whoami)
+	router.Get("/participant", auth.RequireRole(models.RoleParticipant), whoami)
+	router.Get("/author", auth.RequireRole(models.RoleAuthor), whoami)
+	router.Get("/admin", auth.RequireRole(models.RoleAdmin), whoami)
+
+	participant, _, err := tokens.Issue(models.User{ID: "u1", UserName: "ann", Role: models.RoleParticipant})
+	require.NoError(t, err)
+	author, _, err := tokens.Issue(models.User{ID: "u2", UserName: "bob", Role: models.RoleAuthor})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		url      string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"public without token", "/public", "", http.StatusOK, ""},
+		{"public with token", "/public", participant, http.StatusOK, "ann"},
+		{"invalid token", "/public", "garbage", http.StatusUnauthorized, ""},
+		{"participant without token", "/participant", "", http.StatusUnauthorized, ""},
+		{"participant", "/participant", participant, http.StatusOK, "ann"},
+		{"participant as author", "/participant", author, http.StatusOK, "bob"},
+		{"author as participant", "/author", participant, http.StatusForbidden, ""},
+		{"author", "/author", author, http.StatusOK, "bob"},
+		{"admin as author", "/admin", author, http.StatusForbidden, ""},
+		{"admin with admin token", "/admin", "admin-secret", http.StatusOK, "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Contains(t, resp.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+func TestHandler_WithoutAdminToken(t *testing.T) {
+	router := routing.New()
+	router.Use(auth.Handler(auth.NewTokens([]byte("secret"), time.Hour), nil, ""))
+	router.Get("/admin", auth.RequireRole(models.RoleAdmin))
+
+	// an empty admin token never authenticates
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusUnauthorized, resp.Code)
+}
+
+func TestHandler_ResolvesUsers(t *testing.T) {
+	logger, _ := log.NewForTest()
+	tokens := auth.NewTokens([]byte("secret"), time.Hour)
+	// resolves users by ID: bob was demoted and carl deleted after their
+	// tokens were issued
+	users := fakeKeys{
+		"u1": {UserID: "u1", UserName: "ann", Role: models.RoleAuthor},
+		"u2": {UserID: "u2", UserName: "bob", Role: models.RoleParticipant},
+	}
+
+	router := routing.New()
+	router.Use(errors.Handler(logger), auth.Handler(tokens, users, "admin-secret"))
+	whoami := func(c *routing.Context) error {
+		principal, _ := auth.CurrentPrincipal(c.Request.Context())
+		return c.Write(principal.UserName)
+	}
+	router.Get("/author", auth.RequireRole(models.RoleAuthor), whoami)
+
+	promoted, _, err := tokens.Issue(models.User{ID: "u1", UserName: "ann", Role: models.RoleParticipant})
+	require.NoError(t, err)
+	demoted, _, err := tokens.Issue(models.User{ID: "u2", UserName: "bob", Role: models.RoleAuthor})
+	require.NoError(t, err)
+	deleted, _, err := tokens.Issue(models.User{ID: "u3", UserName: "carl", Role: models.RoleAuthor})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"promoted user", promoted, http.StatusOK, "ann"},
+		{"demoted user", demoted, http.StatusForbidden, ""},
+		{"deleted user", deleted, http.StatusUnauthorized, ""},
+		{"admin token", "admin-secret", http.StatusOK, "admin"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/author", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Contains(t, resp.Body.String(), tt.wantBody)
+		})
+	}
+}
+
+type fakeKeys map[string]auth.Principal
+
+func (k fakeKeys) Resolve(key string) (auth.Principal, error) {
+	principal, ok := k[key]
+	if !ok {
+		return auth.Principal{}, auth.ErrInvalidToken
+	}
+	return principal, nil
+}
+
+func TestAPIKeyHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	tokens := auth.NewTokens([]byte("secret"), time.Hour)
+	keys := fakeKeys{
+		"ci":     {UserName: "key:ci", Role: models.RoleAdmin, Scopes: []models.Scope{models.ScopeQuiz, models.ScopeQuestions}},
+		"bot":    {UserID: "u1", UserName: "ann", Role: models.RoleParticipant, Scopes: []models.Scope{models.ScopeQuiz}},
+		"author": {UserID: "u2", UserName: "bob", Role: models.RoleAuthor, Scopes: []models.Scope{models.ScopeQuiz}},
+	}
+
+	router := routing.New()
+	router.Use(errors.Handler(logger), auth.Handler(tokens, nil, "admin-secret"), auth.APIKeyHandler(keys))
+	whoami := func(c *routing.Context) error {
+		principal, _ := auth.CurrentPrincipal(c.Request.Context())
+		return c.Write(principal.UserName)
+	}
+	router.Get("/public", whoami)
+	router.Get("/participant", auth.RequireRole(models.RoleParticipant), whoami)
+	router.Get("/author", auth.RequireRole(models.RoleAuthor), whoami)
+	router.Get("/admin", auth.RequireRole(models.RoleAdmin), whoami)
+
+	tests := []struct {
+		name     string
+		url      string
+		key      string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"public with key", "/public", "bot", "", http.StatusOK, "ann"},
+		{"unknown key", "/public", "garbage", "", http.StatusUnauthorized, ""},
+		{"key and token", "/public", "bot", "admin-secret", http.StatusBadRequest, ""},
+		{"participant", "/participant", "bot", "", http.StatusOK, "ann"},
+		{"author beyond the role of the user", "/author", "bot", "", http.StatusForbidden, ""},
+		{"author beyond the scopes of the key", "/author", "author", "", http.StatusForbidden, ""},
+		{"author with scope", "/author", "ci", "", http.StatusOK, "key:ci"},
+		{"admin beyond the scopes of the key", "/admin", "ci", "", http.StatusForbidden, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", tt.url, nil)
+			req.Header.Set(auth.APIKeyHeader, tt.key)
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Contains(t, resp.Body.String(), tt.wantBody)
+		})
+	}
+}
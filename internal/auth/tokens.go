@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"errors"
+	"slices"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// DefaultTokenTTL is how long the tokens issued on login are valid.
+const DefaultTokenTTL = 24 * time.Hour
+
+// ErrInvalidToken is returned for tokens that are malformed, not signed by
+// the server or expired.
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// Principal is the authenticated user of a request. Principals authenticated
+// with an API key carry its KeyID and are limited to its Scopes; the others
+// have no Scopes and are limited by their Role only.
+type Principal struct {
+	UserID   string
+	UserName string
+	Role     models.Role
+	KeyID    string
+	Scopes   []models.Scope
+}
+
+// Allows reports whether the principal may use the routes of the role.
+func (p Principal) Allows(role models.Role) bool {
+	if !p.Role.Includes(role) {
+		return false
+	}
+	return p.Scopes == nil || slices.Contains(p.Scopes, role.Scope())
+}
+
+// Tokens issues and verifies the bearer tokens users authenticate with. The
+// tokens are JWTs whose subject is the ID of the user, signed with either
+// HS256 or RS256. Only tokens signed with the configured algorithm are
+// accepted.
+type Tokens struct {
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+type claims struct {
+	UserName string      `json:"name"`
+	Role     models.Role `json:"role,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// NewTokens returns Tokens signing with HS256 and the given secret. Issued
+// tokens expire after ttl.
+func NewTokens(secret []byte, ttl time.Duration) *Tokens {
+	return &Tokens{method: jwt.SigningMethodHS256, signKey: secret, verifyKey: secret, ttl: ttl, now: time.Now}
+}
+
+// NewRSATokens returns Tokens signing with RS256 and the given private key,
+// and verifying with its public key.
+func NewRSATokens(key *rsa.PrivateKey, ttl time.Duration) *Tokens {
+	return &Tokens{method: jwt.SigningMethodRS256, signKey: key, verifyKey: &key.PublicKey, ttl: ttl, now: time.Now}
+}
+
+// Issue returns a token for the user and the time it expires at.
+func (t *Tokens) Issue(user models.User) (string, time.Time, error) {
+	now := t.now().UTC().Truncate(time.Second)
+	expiresAt := now.Add(t.ttl)
+	token, err := jwt.NewWithClaims(t.method, claims{
+		UserName: user.UserName,
+		Role:     user.Role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   user.ID,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}).SignedString(t.signKey)
+	return token, expiresAt, err
+}
+
+// Verify checks the signature and expiry of the token and returns the user
+// it was issued to. Tokens without a role are issued to participants.
+func (t *Tokens) Verify(token string) (Principal, error) {
+	var parsed claims
+	_, err := jwt.ParseWithClaims(token, &parsed, func(*jwt.Token) (interface{}, error) {
+		return t.verifyKey, nil
+	}, jwt.WithValidMethods([]string{t.method.Alg()}), jwt.WithExpirationRequired(), jwt.WithTimeFunc(t.now))
+	if err != nil || parsed.Subject == "" {
+		return Principal{}, ErrInvalidToken
+	}
+	if parsed.Role == "" {
+		parsed.Role = models.RoleParticipant
+	}
+	if parsed.Role.Validate() != nil {
+		return Principal{}, ErrInvalidToken
+	}
+	return Principal{UserID: parsed.Subject, UserName: parsed.UserName, Role: parsed.Role}, nil
+}
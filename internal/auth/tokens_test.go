@@ -0,0 +1,84 @@
+package auth_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/auth"
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var ann = models.User{ID: "u1", UserName: "ann", Role: models.RoleAuthor}
+
+func TestTokens_HS256(t *testing.T) {
+	tokens := auth.NewTokens([]byte("secret"), time.Hour)
+
+	token, expiresAt, err := tokens.Issue(ann)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), expiresAt, time.Minute)
+
+	principal, err := tokens.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, auth.Principal{UserID: "u1", UserName: "ann", Role: models.RoleAuthor}, principal)
+
+	_, err = auth.NewTokens([]byte("other"), time.Hour).Verify(token)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	expired, _, err := auth.NewTokens([]byte("secret"), -time.Minute).Issue(ann)
+	require.NoError(t, err)
+	_, err = tokens.Verify(expired)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	_, err = tokens.Verify("not a token")
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestTokens_RS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	tokens := auth.NewRSATokens(key, time.Hour)
+
+	token, _, err := tokens.Issue(ann)
+	require.NoError(t, err)
+	principal, err := tokens.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, "u1", principal.UserID)
+
+	// a token signed with HS256 and the public key as secret must not pass
+	// as one signed with the private key
+	public := x509.MarshalPKCS1PublicKey(&key.PublicKey)
+	forged, _, err := auth.NewTokens(public, time.Hour).Issue(models.User{ID: "u2", UserName: "eve", Role: models.RoleAdmin})
+	require.NoError(t, err)
+	_, err = tokens.Verify(forged)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+
+	// and tokens of the HS256 issuer are not accepted by the RS256 one
+	hs256, _, err := auth.NewTokens([]byte("secret"), time.Hour).Issue(ann)
+	require.NoError(t, err)
+	_, err = tokens.Verify(hs256)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
+
+func TestTokens_Roles(t *testing.T) {
+	tokens := auth.NewTokens([]byte("secret"), time.Hour)
+
+	// tokens issued before roles existed carry none
+	token, _, err := tokens.Issue(models.User{ID: "u1", UserName: "ann"})
+	require.NoError(t, err)
+	principal, err := tokens.Verify(token)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleParticipant, principal.Role)
+
+	unknown, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "u1", "name": "ann", "role": "owner", "exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte("secret"))
+	require.NoError(t, err)
+	_, err = tokens.Verify(unknown)
+	assert.ErrorIs(t, err, auth.ErrInvalidToken)
+}
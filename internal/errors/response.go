@@ -76,6 +76,39 @@ func BadRequest(msg string) ErrorResponse {
 	}
 }
 
+// Conflict creates a new error response representing a request conflicting with another one in progress (HTTP 409)
+func Conflict(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request conflicts with another request in progress."
+	}
+	return ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: msg,
+	}
+}
+
+// UnprocessableEntity creates a new error response representing a well-formed request that cannot be processed (HTTP 422)
+func UnprocessableEntity(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "The request cannot be processed."
+	}
+	return ErrorResponse{
+		Status:  http.StatusUnprocessableEntity,
+		Message: msg,
+	}
+}
+
+// TooManyRequests creates a new error response representing a rate limited request (HTTP 429)
+func TooManyRequests(msg string) ErrorResponse {
+	if msg == "" {
+		msg = "You have sent too many requests, please try again later."
+	}
+	return ErrorResponse{
+		Status:  http.StatusTooManyRequests,
+		Message: msg,
+	}
+}
+
 type invalidField struct {
 	Field string `json:"field"`
 	Error string `json:"error"`
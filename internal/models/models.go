@@ -1,13 +1,298 @@
 package models
 
 import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"time"
+
 	validation "github.com/go-ozzo/ozzo-validation/v4"
 )
 
+// DefaultQuizID is the ID of the quiz served by the /v1/quiz routes.
+const DefaultQuizID = "default"
+
+var idPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+var userNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+type Quiz struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	// QuestionIDs lists the questions of the quiz in order. A quiz without
+	// question IDs uses every question of the question set.
+	QuestionIDs []int `json:"questionIds,omitempty"`
+	// MaxAttempts limits how often a user may submit the quiz and
+	// CooldownSeconds how long they have to wait between two attempts. Zero
+	// means no limit.
+	MaxAttempts     int `json:"maxAttempts,omitempty"`
+	CooldownSeconds int `json:"cooldownSeconds,omitempty"`
+	// TimeLimitSeconds is how long a session of the quiz lasts. A quiz with a
+	// time limit can only be submitted within a session.
+	TimeLimitSeconds int `json:"timeLimitSeconds,omitempty"`
+	// Feedback decides how much of the grading is returned with submissions.
+	Feedback Feedback `json:"feedback,omitempty"`
+	// ShuffleQuestions and ShuffleOptions shuffle the questions and the
+	// options of every session differently.
+	ShuffleQuestions bool `json:"shuffleQuestions,omitempty"`
+	ShuffleOptions   bool `json:"shuffleOptions,omitempty"`
+	// Blueprint draws the questions of every session at random from the
+	// questions of the quiz. A quiz with a blueprint can only be submitted
+	// within a session.
+	Blueprint []BlueprintRule `json:"blueprint,omitempty"`
+}
+
+// BlueprintRule draws Count questions tagged with Tag and of Difficulty. An
+// empty Tag or Difficulty matches every question.
+type BlueprintRule struct {
+	Tag        string     `json:"tag,omitempty"`
+	Difficulty Difficulty `json:"difficulty,omitempty"`
+	Count      int        `json:"count"`
+}
+
+// Matches reports whether the rule may draw the question.
+func (r BlueprintRule) Matches(question Question) bool {
+	if r.Difficulty != "" && r.Difficulty != question.Difficulty {
+		return false
+	}
+	if r.Tag == "" {
+		return true
+	}
+	for _, tag := range question.Tags {
+		if tag == r.Tag {
+			return true
+		}
+	}
+	return false
+}
+
+// BlueprintSize returns the number of questions the blueprint of the quiz
+// draws for every session, 0 for quizzes without blueprint.
+func (q Quiz) BlueprintSize() int {
+	size := 0
+	for _, rule := range q.Blueprint {
+		size += rule.Count
+	}
+	return size
+}
+
+// CheckBlueprint makes sure every rule of the quiz's blueprint matches enough
+// of the quiz's questions out of questions, and that the quiz has enough
+// questions for all of them.
+func (q Quiz) CheckBlueprint(questions []Question) error {
+	if len(q.Blueprint) == 0 {
+		return nil
+	}
+
+	pool := questions
+	if len(q.QuestionIDs) > 0 {
+		listed := make(map[int]bool, len(q.QuestionIDs))
+		for _, id := range q.QuestionIDs {
+			listed[id] = true
+		}
+		pool = nil
+		for _, question := range questions {
+			if listed[question.ID] {
+				pool = append(pool, question)
+			}
+		}
+	}
+
+	for i, rule := range q.Blueprint {
+		matches := 0
+		for _, question := range pool {
+			if rule.Matches(question) {
+				matches++
+			}
+		}
+		if matches < rule.Count {
+			return fmt.Errorf("blueprint rule %d asks for %d questions but only %d match", i+1, rule.Count, matches)
+		}
+	}
+	if size := q.BlueprintSize(); size > len(pool) {
+		return fmt.Errorf("blueprint asks for %d questions but the quiz has %d", size, len(pool))
+	}
+	return nil
+}
+
+// Feedback is the per-answer breakdown a quiz returns with submissions.
+type Feedback string
+
+const (
+	// FeedbackNone only returns the score. It is the feedback of quizzes
+	// without feedback.
+	FeedbackNone Feedback = "none"
+	// FeedbackResults also returns whether each answer is correct and the
+	// points it scored.
+	FeedbackResults Feedback = "results"
+	// FeedbackFull also returns the correct answers and the explanations of
+	// the questions.
+	FeedbackFull Feedback = "full"
+)
+
+type QuizSummary struct {
+	ID               string `json:"id"`
+	Title            string `json:"title"`
+	Description      string `json:"description,omitempty"`
+	QuestionCount    int    `json:"questionCount"`
+	MaxAttempts      int    `json:"maxAttempts,omitempty"`
+	CooldownSeconds  int    `json:"cooldownSeconds,omitempty"`
+	TimeLimitSeconds int    `json:"timeLimitSeconds,omitempty"`
+}
+
+type QuizDetails struct {
+	ID               string           `json:"id"`
+	Title            string           `json:"title"`
+	Description      string           `json:"description,omitempty"`
+	Version          int              `json:"version"`
+	MaxAttempts      int              `json:"maxAttempts,omitempty"`
+	CooldownSeconds  int              `json:"cooldownSeconds,omitempty"`
+	TimeLimitSeconds int              `json:"timeLimitSeconds,omitempty"`
+	Questions        []PublicQuestion `json:"questions"`
+}
+
+// Session is a timed run of a user through a quiz. It pins the question set
+// version the user is shown and must be submitted before its deadline.
+type Session struct {
+	ID         string     `json:"sessionId"`
+	QuizID     string     `json:"quizId"`
+	UserName   string     `json:"userName"`
+	Version    int        `json:"version"`
+	StartedAt  time.Time  `json:"startedAt"`
+	Deadline   time.Time  `json:"deadline"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+	// Seed seeds the shuffles the quiz asked for when the session started,
+	// so that the order the user was shown can be reproduced.
+	Seed             int64 `json:"seed,omitempty"`
+	ShuffleQuestions bool  `json:"shuffleQuestions,omitempty"`
+	ShuffleOptions   bool  `json:"shuffleOptions,omitempty"`
+	// QuestionIDs are the questions of the session, in the order of the quiz
+	// or in the order its blueprint drew them. Feedback is the feedback of
+	// the quiz. Both are kept so that the session is graded as it started,
+	// even if the quiz changes since.
+	QuestionIDs []int    `json:"questionIds,omitempty"`
+	Feedback    Feedback `json:"feedback,omitempty"`
+}
+
+// SessionResponse is a started session with the questions it asks.
+type SessionResponse struct {
+	Session
+	Questions []PublicQuestion `json:"questions"`
+}
+
+// SessionDetails is a session with the questions, including their answer
+// keys, in the order the user was shown them.
+type SessionDetails struct {
+	Session
+	Questions []Question `json:"questions"`
+}
+
+// QuestionType decides how a question is answered and graded.
+type QuestionType string
+
+const (
+	// QuestionSingleChoice questions have exactly one correct option. It is
+	// the type of questions without type.
+	QuestionSingleChoice QuestionType = "single_choice"
+	// QuestionMultipleChoice questions are answered with a set of options and
+	// are correct if the set holds exactly the correct options.
+	QuestionMultipleChoice QuestionType = "multiple_choice"
+	QuestionTrueFalse      QuestionType = "true_false"
+	QuestionNumeric        QuestionType = "numeric"
+	QuestionText           QuestionType = "text"
+)
+
+var questionTypes = []interface{}{
+	QuestionSingleChoice, QuestionMultipleChoice, QuestionTrueFalse, QuestionNumeric, QuestionText,
+}
+
+// Difficulty rates how hard a question is.
+type Difficulty string
+
+const (
+	DifficultyEasy   Difficulty = "easy"
+	DifficultyMedium Difficulty = "medium"
+	DifficultyHard   Difficulty = "hard"
+)
+
+var difficulties = []interface{}{DifficultyEasy, DifficultyMedium, DifficultyHard}
+
+// Scoring decides how partially correct answers to multiple choice questions
+// are credited.
+type Scoring string
+
+const (
+	// ScoringAllOrNothing only credits answers choosing exactly the correct
+	// options. It is the scoring of questions without scoring.
+	ScoringAllOrNothing Scoring = "all_or_nothing"
+	// ScoringProportional credits every correct option chosen and debits
+	// every incorrect one, relative to the number of correct options.
+	ScoringProportional Scoring = "proportional"
+)
+
 type Question struct {
-	ID      int      `json:"id"`
-	Text    string   `json:"text"`
+	ID   int          `json:"id"`
+	Type QuestionType `json:"type,omitempty"`
+	Text string       `json:"text"`
+	// Options are the choices of single and multiple choice questions.
 	Options []Option `json:"options"`
+	// IsTrue, NumericKey and TextKey are the answer keys of true/false,
+	// numeric and text questions.
+	IsTrue     *bool       `json:"isTrue,omitempty"`
+	NumericKey *NumericKey `json:"numericKey,omitempty"`
+	TextKey    *TextKey    `json:"textKey,omitempty"`
+	// Points is what a correct answer is worth, 1 if it is not set. Penalty
+	// is deducted for a wrong answer.
+	Points  float64 `json:"points,omitempty"`
+	Penalty float64 `json:"penalty,omitempty"`
+	Scoring Scoring `json:"scoring,omitempty"`
+	// Explanation is shown with the correct answer once the question has
+	// been answered.
+	Explanation string `json:"explanation,omitempty"`
+	// Tags and Difficulty classify the question for quiz blueprints.
+	Tags       []string   `json:"tags,omitempty"`
+	Difficulty Difficulty `json:"difficulty,omitempty"`
+}
+
+// NumericKey accepts numbers within Tolerance of Value.
+type NumericKey struct {
+	Value     float64 `json:"value"`
+	Tolerance float64 `json:"tolerance,omitempty"`
+}
+
+// TextKey accepts the Accepted answers, compared after trimming and
+// collapsing whitespace, and answers matching Pattern as a whole. Both are
+// case insensitive unless CaseSensitive is set.
+type TextKey struct {
+	Accepted      []string `json:"accepted,omitempty"`
+	Pattern       string   `json:"pattern,omitempty"`
+	CaseSensitive bool     `json:"caseSensitive,omitempty"`
+}
+
+// QuestionType returns the type of the question, defaulting to single
+// choice.
+func (q Question) QuestionType() QuestionType {
+	if q.Type == "" {
+		return QuestionSingleChoice
+	}
+	return q.Type
+}
+
+// MaxPoints returns the points of a correct answer to the question.
+func (q Question) MaxPoints() float64 {
+	if q.Points == 0 {
+		return 1
+	}
+	return q.Points
+}
+
+// HasOptions reports whether the question is answered by choosing options.
+func (q Question) HasOptions() bool {
+	questionType := q.QuestionType()
+	return questionType == QuestionSingleChoice || questionType == QuestionMultipleChoice
 }
 
 type Option struct {
@@ -16,33 +301,478 @@ type Option struct {
 	IsCorrect bool   `json:"isCorrect"`
 }
 
+// QuestionSet is a versioned snapshot of the questions. A new version is
+// created every time the questions are replaced.
+type QuestionSet struct {
+	Version   int        `json:"version"`
+	Questions []Question `json:"questions"`
+}
+
+type PublicQuestionSet struct {
+	Version   int              `json:"version"`
+	Questions []PublicQuestion `json:"questions"`
+}
+
+// PublicQuestion is the participant-facing view of a Question. It never
+// carries the answer key.
+type PublicQuestion struct {
+	ID      int            `json:"id"`
+	Type    QuestionType   `json:"type"`
+	Text    string         `json:"text"`
+	Options []PublicOption `json:"options"`
+}
+
+type PublicOption struct {
+	ID   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+// Answer answers a question. Which field carries the answer depends on the
+// type of the question: OptionID for single choice, OptionIDs for multiple
+// choice, Boolean for true/false, Number for numeric and Text for text
+// questions. A skipped answer carries none of them.
 type Answer struct {
-	QuestionID int `json:"questionId"`
-	OptionID   int `json:"optionId"`
+	QuestionID int      `json:"questionId"`
+	Skipped    bool     `json:"skipped,omitempty"`
+	OptionID   int      `json:"optionId,omitempty"`
+	OptionIDs  []int    `json:"optionIds,omitempty"`
+	Boolean    *bool    `json:"boolean,omitempty"`
+	Number     *float64 `json:"number,omitempty"`
+	Text       *string  `json:"text,omitempty"`
+}
+
+func (a Answer) hasValue() bool {
+	return a.OptionID != 0 || a.OptionIDs != nil || a.Boolean != nil || a.Number != nil || a.Text != nil
 }
 
 type Submission struct {
-	UserName string   `json:"userName"`
-	Answers  []Answer `json:"answers"`
+	UserName string `json:"userName"`
+	// UserID is the account the submission is made with. It is set from the
+	// authenticated user, never from the request body.
+	UserID  string   `json:"-"`
+	Answers []Answer `json:"answers"`
+	// Version is the question set version the answers were given against.
+	// The current version is used when it is omitted.
+	Version int `json:"version,omitempty"`
+	// SessionID binds the submission to a session, whose version replaces
+	// Version.
+	SessionID string `json:"sessionId,omitempty"`
 }
 
+// Result is a single graded attempt of a user at a quiz. Attempts are
+// numbered from 1 per user and quiz. Score is the points scored out of
+// MaxScore, and Percentage the normalized score users are ranked by.
 type Result struct {
-	UserName              string `json:"userName"`
-	Score                 int    `json:"score"`
-	TotalQuestionAnswered int    `json:"totalQuestionAnswered"`
+	QuizID                string    `json:"quizId"`
+	UserName              string    `json:"userName"`
+	UserID                string    `json:"userId,omitempty"`
+	Attempt               int       `json:"attempt"`
+	Score                 float64   `json:"score"`
+	MaxScore              float64   `json:"maxScore"`
+	Percentage            float64   `json:"percentage"`
+	TotalQuestionAnswered int       `json:"totalQuestionAnswered"`
+	SubmittedAt           time.Time `json:"submittedAt"`
+	// ElapsedMillis is the time between the start of the session and the
+	// submission. It is 0 for submissions made without a session.
+	ElapsedMillis int64 `json:"elapsedMillis,omitempty"`
+}
+
+// Percentage returns score as a percentage of maxScore, rounded to two
+// decimals.
+func Percentage(score, maxScore float64) float64 {
+	if maxScore <= 0 {
+		return 0
+	}
+	return math.Round(score/maxScore*10000) / 100
 }
 
+// SubmissionResponse is the graded submission. TotalQuestionAnswered counts
+// the questions that were answered and QuestionCount every question of the
+// quiz, including skipped ones.
 type SubmissionResponse struct {
-	Message               string `json:"message"`
-	Score                 int    `json:"score"`
-	TotalQuestionAnswered int    `json:"totalQuestionCount"`
+	Message               string  `json:"message"`
+	Attempt               int     `json:"attempt"`
+	Score                 float64 `json:"score"`
+	MaxScore              float64 `json:"maxScore"`
+	Percentage            float64 `json:"percentage"`
+	TotalQuestionAnswered int     `json:"totalQuestionCount"`
+	QuestionCount         int     `json:"questionCount"`
+	ElapsedMillis         int64   `json:"elapsedMillis,omitempty"`
+	// Answers is the breakdown per question, returned if the feedback of
+	// the quiz asks for it.
+	Answers []AnswerFeedback `json:"answers,omitempty"`
 }
 
+// AnswerFeedback is the grading of the answer to a single question.
+// CorrectAnswer and Explanation are only returned with full feedback.
+type AnswerFeedback struct {
+	QuestionID    int     `json:"questionId"`
+	Answer        *Answer `json:"answer,omitempty"`
+	Skipped       bool    `json:"skipped,omitempty"`
+	Correct       bool    `json:"correct"`
+	Points        float64 `json:"points"`
+	MaxPoints     float64 `json:"maxPoints"`
+	CorrectAnswer *Answer `json:"correctAnswer,omitempty"`
+	Explanation   string  `json:"explanation,omitempty"`
+}
+
+// GetSubmissionResponse describes the attempt of a user that counts toward
+// the ranking.
 type GetSubmissionResponse struct {
-	Message               string `json:"message"`
-	Score                 int    `json:"score"`
-	Rank                  string `json:"rank"`
-	TotalQuestionAnswered int    `json:"totalQuestionCount"`
+	Message               string  `json:"message"`
+	Attempt               int     `json:"attempt"`
+	Score                 float64 `json:"score"`
+	MaxScore              float64 `json:"maxScore"`
+	Percentage            float64 `json:"percentage"`
+	Rank                  string  `json:"rank"`
+	Position              int     `json:"position"`
+	Participants          int     `json:"participants"`
+	Percentile            float64 `json:"percentile"`
+	TotalQuestionAnswered int     `json:"totalQuestionCount"`
+	ElapsedMillis         int64   `json:"elapsedMillis,omitempty"`
+}
+
+// LeaderboardEntry is the ranked attempt of a user on a leaderboard. Users
+// with the same percentage share a rank and the users after them skip the
+// ranks they take (standard competition ranking: 1, 2, 2, 4).
+type LeaderboardEntry struct {
+	Rank          int       `json:"rank"`
+	UserName      string    `json:"userName"`
+	Attempt       int       `json:"attempt"`
+	Score         float64   `json:"score"`
+	MaxScore      float64   `json:"maxScore"`
+	Percentage    float64   `json:"percentage"`
+	ElapsedMillis int64     `json:"elapsedMillis,omitempty"`
+	SubmittedAt   time.Time `json:"submittedAt"`
+}
+
+// LeaderboardCursor is the position of an entry on a leaderboard. Entries are
+// ordered by percentage, highest first, ties by the time the session took,
+// fastest first, and then by user name.
+type LeaderboardCursor struct {
+	Percentage    float64 `json:"p"`
+	ElapsedMillis int64   `json:"e,omitempty"`
+	UserName      string  `json:"u"`
+}
+
+// Before reports whether the entry at c is listed before the one at other.
+func (c LeaderboardCursor) Before(other LeaderboardCursor) bool {
+	if c.Percentage != other.Percentage {
+		return c.Percentage > other.Percentage
+	}
+	if c.ElapsedMillis != other.ElapsedMillis {
+		return c.ElapsedMillis < other.ElapsedMillis
+	}
+	return c.UserName < other.UserName
+}
+
+// Leaderboard is a page of the leaderboard of a quiz, limited to the attempts
+// submitted from From up to To if they are set. NextCursor is passed as
+// cursor to get the next page and is empty on the last one.
+type Leaderboard struct {
+	QuizID     string             `json:"quizId"`
+	From       *time.Time         `json:"from,omitempty"`
+	To         *time.Time         `json:"to,omitempty"`
+	Entries    []LeaderboardEntry `json:"entries"`
+	NextCursor string             `json:"nextCursor,omitempty"`
+}
+
+// Standing places a percentage among the ranked attempts of all participants
+// of a quiz. Rank is the competition rank the percentage takes, Lower and
+// Tied count the participants with a lower and the same percentage.
+type Standing struct {
+	Rank         int
+	Participants int
+	Lower        int
+	Tied         int
+}
+
+// Percentile returns the percentile rank of the standing: the share of
+// participants with a lower percentage, counting the tied participants,
+// the user included, as half below. A sole participant is at the 50th
+// percentile, and every user with the same percentage at the same one.
+func (s Standing) Percentile() float64 {
+	if s.Participants == 0 {
+		return 0
+	}
+	return math.Round((float64(s.Lower)+float64(s.Tied)/2)/float64(s.Participants)*10000) / 100
+}
+
+// Statistics summarises the percentages of the ranked attempts of a quiz,
+// limited to the attempts submitted from From up to To if they are set. The
+// histogram covers 0 to 100 in buckets of HistogramBucketWidth, each counting
+// the percentages from From up to, but excluding, To. The last bucket
+// includes 100.
+type Statistics struct {
+	QuizID            string            `json:"quizId"`
+	From              *time.Time        `json:"from,omitempty"`
+	To                *time.Time        `json:"to,omitempty"`
+	Participants      int               `json:"participants"`
+	Mean              float64           `json:"mean"`
+	Median            float64           `json:"median"`
+	StandardDeviation float64           `json:"standardDeviation"`
+	Histogram         []HistogramBucket `json:"histogram"`
+}
+
+// HistogramBucketWidth is the width of the buckets of the histogram of the
+// statistics, in percentage points.
+const HistogramBucketWidth = 10
+
+type HistogramBucket struct {
+	From  float64 `json:"from"`
+	To    float64 `json:"to"`
+	Count int     `json:"count"`
+}
+
+// Window limits a ranking to the attempts submitted from From up to, but
+// excluding, To. A zero bound leaves the window open on that side, so the
+// zero Window covers all time.
+type Window struct {
+	From time.Time
+	To   time.Time
+}
+
+// AllTime reports whether the window is open on both sides.
+func (w Window) AllTime() bool {
+	return w.From.IsZero() && w.To.IsZero()
+}
+
+// Contains reports whether t falls into the window.
+func (w Window) Contains(t time.Time) bool {
+	return (w.From.IsZero() || !t.Before(w.From)) && (w.To.IsZero() || t.Before(w.To))
+}
+
+// Period is a window that rolls over on its own.
+type Period string
+
+const (
+	PeriodAllTime Period = "all"
+	PeriodDaily   Period = "daily"
+	PeriodWeekly  Period = "weekly"
+	PeriodMonthly Period = "monthly"
+)
+
+// Window returns the window of the period that now falls into. Days start at
+// midnight UTC and weeks on Monday. An empty period is all time.
+func (p Period) Window(now time.Time) (Window, error) {
+	now = now.UTC()
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	switch p {
+	case "", PeriodAllTime:
+		return Window{}, nil
+	case PeriodDaily:
+		return Window{From: day, To: day.AddDate(0, 0, 1)}, nil
+	case PeriodWeekly:
+		monday := day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return Window{From: monday, To: monday.AddDate(0, 0, 7)}, nil
+	case PeriodMonthly:
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return Window{From: month, To: month.AddDate(0, 1, 0)}, nil
+	}
+	return Window{}, fmt.Errorf("unknown period %q (must be all, daily, weekly or monthly)", p)
+}
+
+// AttemptsResponse lists every attempt of a user at a quiz, oldest first.
+type AttemptsResponse struct {
+	UserName      string   `json:"userName"`
+	RankingPolicy string   `json:"rankingPolicy"`
+	RankedAttempt int      `json:"rankedAttempt"`
+	Attempts      []Result `json:"attempts"`
+}
+
+// Team is a group of users competing together. A user may belong to several
+// teams. Members are ordered by name.
+type Team struct {
+	ID      string   `json:"id"`
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+}
+
+// TeamAggregate is how the percentages of the members of a team add up to
+// the score of the team. Only members who submitted the quiz count.
+type TeamAggregate string
+
+const (
+	// AggregateSum adds up the percentages of the members.
+	AggregateSum TeamAggregate = "sum"
+	// AggregateAverage averages the percentages of the members.
+	AggregateAverage TeamAggregate = "average"
+	// AggregateBest adds up the N best percentages of the members.
+	AggregateBest TeamAggregate = "best"
+)
+
+// MemberScore is the ranked attempt of a member of a team. Submitted is false
+// for members who have not submitted the quiz, and Counted tells whether the
+// attempt counts toward the score of the team.
+type MemberScore struct {
+	UserName    string     `json:"userName"`
+	Submitted   bool       `json:"submitted"`
+	Counted     bool       `json:"counted"`
+	Attempt     int        `json:"attempt,omitempty"`
+	Score       float64    `json:"score"`
+	MaxScore    float64    `json:"maxScore"`
+	Percentage  float64    `json:"percentage"`
+	SubmittedAt *time.Time `json:"submittedAt,omitempty"`
+}
+
+// TeamScore is the score of a team at a quiz. Participants counts the members
+// who submitted the quiz. Members is only set on the breakdown of a team.
+type TeamScore struct {
+	Rank         int           `json:"rank,omitempty"`
+	TeamID       string        `json:"teamId"`
+	Name         string        `json:"name"`
+	Score        float64       `json:"score"`
+	Participants int           `json:"participants"`
+	Members      []MemberScore `json:"members,omitempty"`
+}
+
+// TeamLeaderboard ranks the teams with at least one participant by their
+// score, highest first, with the same competition ranking as the leaderboard
+// of the users. Teams with the same score are listed by ID.
+type TeamLeaderboard struct {
+	QuizID    string        `json:"quizId"`
+	Aggregate TeamAggregate `json:"aggregate"`
+	N         int           `json:"n,omitempty"`
+	Entries   []TeamScore   `json:"entries"`
+}
+
+// Role decides which routes a user may access. Each role includes the roles
+// before it: participants take quizzes, authors also manage the questions and
+// admins everything else.
+type Role string
+
+const (
+	RoleParticipant Role = "participant"
+	RoleAuthor      Role = "author"
+	RoleAdmin       Role = "admin"
+)
+
+var roleLevels = map[Role]int{RoleParticipant: 1, RoleAuthor: 2, RoleAdmin: 3}
+
+// Includes tells whether the role grants the access of the other role.
+func (r Role) Includes(other Role) bool {
+	level, ok := roleLevels[r]
+	return ok && level >= roleLevels[other]
+}
+
+func (r Role) Validate() error {
+	if _, ok := roleLevels[r]; !ok {
+		return errors.New("must be participant, author or admin")
+	}
+	return nil
+}
+
+// User is a registered account. Users take quizzes under their UserName,
+// which no other account can claim. The PasswordHash is only kept by the
+// storages; the API returns the Profile of a user.
+type User struct {
+	ID           string    `json:"id"`
+	UserName     string    `json:"userName"`
+	PasswordHash string    `json:"passwordHash"`
+	Role         Role      `json:"role"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// UserProfile is the public part of a user.
+type UserProfile struct {
+	ID        string    `json:"id"`
+	UserName  string    `json:"userName"`
+	Role      Role      `json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (u User) Profile() UserProfile {
+	return UserProfile{ID: u.ID, UserName: u.UserName, Role: u.Role, CreatedAt: u.CreatedAt}
+}
+
+// Scope limits an API key to the routes of a role: quiz to the routes of
+// participants, questions to those of authors and admin to those of admins.
+type Scope string
+
+const (
+	ScopeQuiz      Scope = "quiz"
+	ScopeQuestions Scope = "questions"
+	ScopeAdmin     Scope = "admin"
+)
+
+var roleScopes = map[Role]Scope{RoleParticipant: ScopeQuiz, RoleAuthor: ScopeQuestions, RoleAdmin: ScopeAdmin}
+
+// Scope returns the scope an API key needs for the routes of the role.
+func (r Role) Scope() Scope {
+	return roleScopes[r]
+}
+
+// APIKey authenticates a machine client. Only the SHA-256 Hash of the key is
+// stored, along with its Prefix to tell keys apart. A key acts as the user it
+// was minted for, or as an admin if it was minted for none, limited to its
+// Scopes.
+type APIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Hash      string     `json:"hash"`
+	UserID    string     `json:"userId,omitempty"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+// APIKeyInfo is an API key as the API returns it, without its hash.
+type APIKeyInfo struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	UserID    string     `json:"userId,omitempty"`
+	Scopes    []Scope    `json:"scopes"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+func (k APIKey) Info() APIKeyInfo {
+	return APIKeyInfo{ID: k.ID, Name: k.Name, Prefix: k.Prefix, UserID: k.UserID, Scopes: k.Scopes, CreatedAt: k.CreatedAt, RevokedAt: k.RevokedAt}
+}
+
+// APIKeyRequest mints an API key.
+type APIKeyRequest struct {
+	Name   string  `json:"name"`
+	UserID string  `json:"userId,omitempty"`
+	Scopes []Scope `json:"scopes"`
+}
+
+// NewAPIKey is a minted API key. The Key itself is only returned once.
+type NewAPIKey struct {
+	APIKeyInfo
+	Key string `json:"key"`
+}
+
+// IdempotencyRecord is the response to a request made with an idempotency
+// key, returned again to retries of the request. Fingerprint identifies the
+// request, so that reusing the key for another request can be told apart
+// from a retry. Response is empty while the request is in progress.
+type IdempotencyRecord struct {
+	Key         string    `json:"key"`
+	Fingerprint string    `json:"fingerprint"`
+	Response    []byte    `json:"response,omitempty"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+}
+
+// RoleRequest changes the role of a user.
+type RoleRequest struct {
+	Role Role `json:"role"`
+}
+
+// Credentials are the user name and password a user registers and logs in
+// with.
+type Credentials struct {
+	UserName string `json:"userName"`
+	Password string `json:"password"`
+}
+
+// LoginResponse carries the bearer token of a logged in user.
+type LoginResponse struct {
+	Token     string      `json:"token"`
+	ExpiresAt time.Time   `json:"expiresAt"`
+	User      UserProfile `json:"user"`
 }
 
 func (s Submission) Validate() error {
@@ -53,10 +783,209 @@ func (s Submission) Validate() error {
 			if !ok {
 				return validation.ErrInInvalid
 			}
-			return validation.ValidateStruct(&answer,
+			if err := validation.ValidateStruct(&answer,
 				validation.Field(&answer.QuestionID, validation.Required),
-				validation.Field(&answer.OptionID, validation.Required),
+			); err != nil {
+				return err
+			}
+			switch {
+			case answer.Skipped && answer.hasValue():
+				return errors.New("a skipped answer cannot carry a value")
+			case !answer.Skipped && !answer.hasValue():
+				return errors.New("an answer needs an optionId, optionIds, boolean, number or text, or must be skipped")
+			}
+			return nil
+		}))),
+	)
+}
+
+// Validate checks the question and that it carries the answer key of its
+// type, and only that one.
+func (q Question) Validate() error {
+	questionType := q.QuestionType()
+	correctOptions := exactlyOneCorrectOption
+	if questionType == QuestionMultipleChoice {
+		correctOptions = atLeastOneCorrectOption
+	}
+
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.ID, validation.Required),
+		validation.Field(&q.Type, validation.In(questionTypes...)),
+		validation.Field(&q.Text, validation.Required),
+		validation.Field(&q.Options, validation.When(q.HasOptions(),
+			validation.Required,
+			validation.Length(2, 0),
+			validation.By(uniqueOptionIDs),
+			validation.By(correctOptions),
+			validation.Each(validation.By(func(value interface{}) error {
+				option, ok := value.(Option)
+				if !ok {
+					return validation.ErrInInvalid
+				}
+				return validation.ValidateStruct(&option,
+					validation.Field(&option.ID, validation.Required),
+					validation.Field(&option.Text, validation.Required),
+				)
+			})),
+		), validation.When(!q.HasOptions(), validation.By(absent))),
+		validation.Field(&q.IsTrue, answerKey(questionType == QuestionTrueFalse)...),
+		validation.Field(&q.NumericKey, answerKey(questionType == QuestionNumeric)...),
+		validation.Field(&q.TextKey, answerKey(questionType == QuestionText)...),
+		validation.Field(&q.Points, validation.Min(0.0)),
+		validation.Field(&q.Penalty, validation.Min(0.0)),
+		validation.Field(&q.Scoring,
+			validation.In(ScoringAllOrNothing, ScoringProportional),
+			validation.When(questionType != QuestionMultipleChoice, validation.In(ScoringAllOrNothing).Error("is only supported by multiple choice questions")),
+		),
+		validation.Field(&q.Tags, validation.Each(validation.Required)),
+		validation.Field(&q.Difficulty, validation.In(difficulties...)),
+	)
+}
+
+// answerKey requires an answer key if the question type uses it, and rejects
+// it otherwise.
+func answerKey(used bool) []validation.Rule {
+	return []validation.Rule{
+		validation.When(used, validation.NotNil),
+		validation.When(!used, validation.By(absent)),
+	}
+}
+
+func absent(value interface{}) error {
+	v := reflect.ValueOf(value)
+	if (v.Kind() == reflect.Ptr && !v.IsNil()) || (v.Kind() == reflect.Slice && v.Len() > 0) {
+		return errors.New("is not used by this question type")
+	}
+	return nil
+}
+
+func (k NumericKey) Validate() error {
+	return validation.ValidateStruct(&k,
+		validation.Field(&k.Tolerance, validation.Min(0.0)),
+	)
+}
+
+func (k TextKey) Validate() error {
+	return validation.ValidateStruct(&k,
+		validation.Field(&k.Accepted, validation.When(k.Pattern == "", validation.Required), validation.Each(validation.Required)),
+		validation.Field(&k.Pattern, validation.By(func(value interface{}) error {
+			if _, err := k.Regexp(); err != nil {
+				return errors.New("must be a valid regular expression")
+			}
+			return nil
+		})),
+	)
+}
+
+// Regexp compiles Pattern into an expression matching whole answers, or
+// returns nil if there is no pattern.
+func (k TextKey) Regexp() (*regexp.Regexp, error) {
+	if k.Pattern == "" {
+		return nil, nil
+	}
+	flags := "(?i)"
+	if k.CaseSensitive {
+		flags = ""
+	}
+	return regexp.Compile(flags + `^(?:` + k.Pattern + `)$`)
+}
+
+func uniqueOptionIDs(value interface{}) error {
+	options, _ := value.([]Option)
+	seen := make(map[int]bool, len(options))
+	for _, option := range options {
+		if seen[option.ID] {
+			return errors.New("option IDs must be unique")
+		}
+		seen[option.ID] = true
+	}
+	return nil
+}
+
+func exactlyOneCorrectOption(value interface{}) error {
+	if countCorrectOptions(value) != 1 {
+		return errors.New("exactly one option must be correct")
+	}
+	return nil
+}
+
+func atLeastOneCorrectOption(value interface{}) error {
+	if countCorrectOptions(value) == 0 {
+		return errors.New("at least one option must be correct")
+	}
+	return nil
+}
+
+func countCorrectOptions(value interface{}) int {
+	options, _ := value.([]Option)
+	correct := 0
+	for _, option := range options {
+		if option.IsCorrect {
+			correct++
+		}
+	}
+	return correct
+}
+
+func (q Quiz) Validate() error {
+	return validation.ValidateStruct(&q,
+		validation.Field(&q.ID, validation.Required, validation.Length(1, 64), validation.Match(idPattern)),
+		validation.Field(&q.Title, validation.Required),
+		validation.Field(&q.MaxAttempts, validation.Min(0)),
+		validation.Field(&q.CooldownSeconds, validation.Min(0)),
+		validation.Field(&q.TimeLimitSeconds, validation.Min(0)),
+		validation.Field(&q.Feedback, validation.In(FeedbackNone, FeedbackResults, FeedbackFull)),
+		validation.Field(&q.Blueprint, validation.Each(validation.By(func(value interface{}) error {
+			rule, ok := value.(BlueprintRule)
+			if !ok {
+				return validation.ErrInInvalid
+			}
+			return validation.ValidateStruct(&rule,
+				validation.Field(&rule.Difficulty, validation.In(difficulties...)),
+				validation.Field(&rule.Count, validation.Required, validation.Min(1)),
 			)
 		}))),
 	)
 }
+
+func (t Team) Validate() error {
+	return validation.ValidateStruct(&t,
+		validation.Field(&t.ID, validation.Required, validation.Length(1, 64), validation.Match(idPattern)),
+		validation.Field(&t.Name, validation.Required),
+		validation.Field(&t.Members, validation.Each(validation.Required)),
+	)
+}
+
+// maxPasswordBytes is the longest password bcrypt hashes.
+const maxPasswordBytes = 72
+
+// Validate checks the credentials of a new user. Passwords are at least 8
+// characters and at most 72 bytes, the most bcrypt hashes, so that multibyte
+// passwords may have fewer characters.
+func (c Credentials) Validate() error {
+	return validation.ValidateStruct(&c,
+		validation.Field(&c.UserName, validation.Required, validation.Length(3, 32), validation.Match(userNamePattern)),
+		validation.Field(&c.Password, validation.Required, validation.RuneLength(8, 0), validation.By(passwordBytes)),
+	)
+}
+
+func passwordBytes(value interface{}) error {
+	password, _ := value.(string)
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("the length must be no more than %d bytes", maxPasswordBytes)
+	}
+	return nil
+}
+
+func (r RoleRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Role, validation.Required),
+	)
+}
+
+func (r APIKeyRequest) Validate() error {
+	return validation.ValidateStruct(&r,
+		validation.Field(&r.Name, validation.Required, validation.Length(1, 64)),
+		validation.Field(&r.Scopes, validation.Required, validation.Each(validation.In(ScopeQuiz, ScopeQuestions, ScopeAdmin))),
+	)
+}
@@ -0,0 +1,241 @@
+package question
+
+import (
+	stderrors "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/courage173/quiz-api/internal/errors"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// orderRequest lists every ID of a collection in the requested order.
+type orderRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// RegisterHandlers registers the routes managing questions and their options.
+// The route group is expected to be restricted to authors.
+func RegisterHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
+	rg.Get("", listQuestions(service, logger))
+	rg.Post("", createQuestion(service, logger))
+	rg.Put("/order", reorderQuestions(service, logger))
+	rg.Get(`/<id:\d+>`, getQuestion(service, logger))
+	rg.Put(`/<id:\d+>`, updateQuestion(service, logger))
+	rg.Delete(`/<id:\d+>`, deleteQuestion(service, logger))
+	rg.Post(`/<id:\d+>/options`, addOption(service, logger))
+	rg.Put(`/<id:\d+>/options/order`, reorderOptions(service, logger))
+	rg.Put(`/<id:\d+>/options/<optionId:\d+>`, updateOption(service, logger))
+	rg.Delete(`/<id:\d+>/options/<optionId:\d+>`, deleteOption(service, logger))
+}
+
+// toErrorResponse maps errors returned by the service to error responses.
+// Validation errors are passed on as they are.
+func toErrorResponse(err error) error {
+	switch {
+	case stderrors.Is(err, storage.ErrQuestionNotFound), stderrors.Is(err, ErrOptionNotFound):
+		return errors.NotFound(err.Error())
+	case stderrors.Is(err, storage.ErrInvalidOrder), stderrors.Is(err, storage.ErrQuestionExists), stderrors.Is(err, storage.ErrQuestionInUse):
+		return errors.BadRequest(err.Error())
+	}
+	return err
+}
+
+func intParam(c *routing.Context, name string) (int, error) {
+	value, err := strconv.Atoi(c.Param(name))
+	if err != nil {
+		return 0, errors.BadRequest("invalid " + name)
+	}
+	return value, nil
+}
+
+func listQuestions(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.List()
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error listing questions: %v", err)
+			return err
+		}
+		return c.Write(response)
+	}
+}
+
+func getQuestion(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		id, err := intParam(c, "id")
+		if err != nil {
+			return err
+		}
+		response, err := service.Get(id)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting question: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func createQuestion(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req models.Question
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		response, err := service.Create(req)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error creating question: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.WriteWithStatus(response, http.StatusCreated)
+	}
+}
+
+func updateQuestion(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		id, err := intParam(c, "id")
+		if err != nil {
+			return err
+		}
+		var req models.Question
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+		req.ID = id
+
+		response, err := service.Update(req)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error updating question: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func deleteQuestion(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		id, err := intParam(c, "id")
+		if err != nil {
+			return err
+		}
+		if err := service.Delete(id); err != nil {
+			logger.With(c.Request.Context()).Errorf("Error deleting question: %v", err)
+			return toErrorResponse(err)
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+func reorderQuestions(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req orderRequest
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+		if err := service.Reorder(req.IDs); err != nil {
+			logger.With(c.Request.Context()).Errorf("Error reordering questions: %v", err)
+			return toErrorResponse(err)
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+func addOption(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		id, err := intParam(c, "id")
+		if err != nil {
+			return err
+		}
+		var req models.Option
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		response, err := service.AddOption(id, req)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error adding option: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.WriteWithStatus(response, http.StatusCreated)
+	}
+}
+
+func updateOption(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		id, err := intParam(c, "id")
+		if err != nil {
+			return err
+		}
+		optionID, err := intParam(c, "optionId")
+		if err != nil {
+			return err
+		}
+		var req models.Option
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+		req.ID = optionID
+
+		response, err := service.UpdateOption(id, req)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error updating option: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func deleteOption(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		id, err := intParam(c, "id")
+		if err != nil {
+			return err
+		}
+		optionID, err := intParam(c, "optionId")
+		if err != nil {
+			return err
+		}
+
+		response, err := service.DeleteOption(id, optionID)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error deleting option: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func reorderOptions(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		id, err := intParam(c, "id")
+		if err != nil {
+			return err
+		}
+		var req orderRequest
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		response, err := service.ReorderOptions(id, req.IDs)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error reordering options: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
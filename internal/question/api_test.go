@@ -0,0 +1,69 @@
+package question_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/courage173/quiz-api/internal/errors"
+	"github.com/courage173/quiz-api/internal/question"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupRouter(t *testing.T) *routing.Router {
+	logger, _ := log.NewForTest()
+	router := routing.New()
+	router.Use(errors.Handler(logger), content.TypeNegotiator(content.JSON))
+
+	service := question.NewService(storage.NewStorage(storage.RankLatest), logger)
+	question.RegisterHandlers(router.Group("/v1/admin/questions"), service, logger)
+	return router
+}
+
+func TestQuestionHandlers(t *testing.T) {
+	router := setupRouter(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"list", "GET", "/v1/admin/questions", "", http.StatusOK, `"version":1`},
+		{"get", "GET", "/v1/admin/questions/1", "", http.StatusOK, `"text":"What is the capital of France?"`},
+		{"get unknown", "GET", "/v1/admin/questions/99", "", http.StatusNotFound, "question not found"},
+		{"create", "POST", "/v1/admin/questions", `{"text":"New","options":[{"text":"A","isCorrect":true},{"text":"B"}]}`, http.StatusCreated, `"id":11`},
+		{"create invalid", "POST", "/v1/admin/questions", `{"text":"New","options":[{"text":"A"},{"text":"B"}]}`, http.StatusBadRequest, "exactly one option must be correct"},
+		{"create existing", "POST", "/v1/admin/questions", `{"id":1,"text":"New","options":[{"text":"A","isCorrect":true},{"text":"B"}]}`, http.StatusBadRequest, "already exists"},
+		{"update", "PUT", "/v1/admin/questions/11", `{"text":"Updated","options":[{"id":1,"text":"A","isCorrect":true},{"id":2,"text":"B"}]}`, http.StatusOK, `"text":"Updated"`},
+		{"add option", "POST", "/v1/admin/questions/11/options", `{"text":"C"}`, http.StatusCreated, `{"id":3,"text":"C","isCorrect":false}`},
+		{"update option", "PUT", "/v1/admin/questions/11/options/3", `{"text":"C","isCorrect":true}`, http.StatusOK, `{"id":1,"text":"A","isCorrect":false}`},
+		{"reorder options", "PUT", "/v1/admin/questions/11/options/order", `{"ids":[3,2,1]}`, http.StatusOK, `"options":[{"id":3`},
+		{"delete option", "DELETE", "/v1/admin/questions/11/options/1", "", http.StatusOK, `"options":[{"id":3,"text":"C","isCorrect":true},{"id":2,"text":"B","isCorrect":false}]`},
+		{"delete unknown option", "DELETE", "/v1/admin/questions/11/options/1", "", http.StatusNotFound, "option not found"},
+		{"reorder invalid", "PUT", "/v1/admin/questions/order", `{"ids":[1,2]}`, http.StatusBadRequest, "exactly once"},
+		{"reorder", "PUT", "/v1/admin/questions/order", `{"ids":[11,10,9,8,7,6,5,4,3,2,1]}`, http.StatusNoContent, ""},
+		{"list reordered", "GET", "/v1/admin/questions", "", http.StatusOK, `"questions":[{"id":11`},
+		{"delete", "DELETE", "/v1/admin/questions/11", "", http.StatusNoContent, ""},
+		{"delete unknown", "DELETE", "/v1/admin/questions/11", "", http.StatusNotFound, "question not found"},
+	}
+
+	// the cases build on each other and run in order
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, tt.wantCode, resp.Code, tt.name)
+		assert.Contains(t, resp.Body.String(), tt.wantBody, tt.name)
+	}
+}
@@ -0,0 +1,214 @@
+package question
+
+import (
+	"errors"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+var ErrOptionNotFound = errors.New("option not found")
+
+// Service manages the questions of the current question set. Every change
+// creates a new question set version, so submissions started on an older
+// version are still graded against the questions they were shown.
+type Service interface {
+	List() (models.QuestionSet, error)
+	Get(id int) (models.Question, error)
+	Create(question models.Question) (models.Question, error)
+	Update(question models.Question) (models.Question, error)
+	Delete(id int) error
+	Reorder(ids []int) error
+	AddOption(questionID int, option models.Option) (models.Question, error)
+	UpdateOption(questionID int, option models.Option) (models.Question, error)
+	DeleteOption(questionID, optionID int) (models.Question, error)
+	ReorderOptions(questionID int, optionIDs []int) (models.Question, error)
+}
+
+type service struct {
+	storage storage.Storage
+	logger  log.Logger
+}
+
+func NewService(storage storage.Storage, logger log.Logger) Service {
+	return service{
+		storage,
+		logger,
+	}
+}
+
+func (s service) List() (models.QuestionSet, error) {
+	return s.storage.GetQuestionSet(0)
+}
+
+func (s service) Get(id int) (models.Question, error) {
+	return s.storage.GetQuestion(id)
+}
+
+// Create adds the question at the end of the question set. A question or
+// option without ID gets the next free one.
+func (s service) Create(question models.Question) (models.Question, error) {
+	question.Options = assignOptionIDs(question.Options)
+	if err := validate(question, question.ID == 0); err != nil {
+		return models.Question{}, err
+	}
+	return s.storage.CreateQuestion(question)
+}
+
+// Update replaces the question with the same ID. An option without ID gets
+// the next free one.
+func (s service) Update(question models.Question) (models.Question, error) {
+	question.Options = assignOptionIDs(question.Options)
+	if err := validate(question, false); err != nil {
+		return models.Question{}, err
+	}
+	if err := s.storage.UpdateQuestion(question); err != nil {
+		return models.Question{}, err
+	}
+	return question, nil
+}
+
+// Delete removes the question. Questions a quiz still asks cannot be deleted.
+func (s service) Delete(id int) error {
+	return s.storage.DeleteQuestion(id)
+}
+
+func (s service) Reorder(ids []int) error {
+	return s.storage.ReorderQuestions(ids)
+}
+
+// AddOption appends the option to the question. Adding a correct option to a
+// single choice question makes the other options incorrect.
+func (s service) AddOption(questionID int, option models.Option) (models.Question, error) {
+	return s.updateOptions(questionID, func(questionType models.QuestionType, options []models.Option) ([]models.Option, error) {
+		options = append(options, option)
+		if option.ID == 0 {
+			options = assignOptionIDs(options)
+			option.ID = options[len(options)-1].ID
+		}
+		return markCorrect(questionType, options, option), nil
+	})
+}
+
+// UpdateOption replaces the option with the same ID. Making an option of a
+// single choice question correct makes the other options incorrect.
+func (s service) UpdateOption(questionID int, option models.Option) (models.Question, error) {
+	return s.updateOptions(questionID, func(questionType models.QuestionType, options []models.Option) ([]models.Option, error) {
+		for i := range options {
+			if options[i].ID == option.ID {
+				options[i] = option
+				return markCorrect(questionType, options, option), nil
+			}
+		}
+		return nil, ErrOptionNotFound
+	})
+}
+
+// DeleteOption removes the option from the question. The correct option can
+// only be removed by updating the whole question.
+func (s service) DeleteOption(questionID, optionID int) (models.Question, error) {
+	return s.updateOptions(questionID, func(_ models.QuestionType, options []models.Option) ([]models.Option, error) {
+		next := make([]models.Option, 0, len(options))
+		for _, option := range options {
+			if option.ID != optionID {
+				next = append(next, option)
+			}
+		}
+		if len(next) == len(options) {
+			return nil, ErrOptionNotFound
+		}
+		return next, nil
+	})
+}
+
+// ReorderOptions orders the options of the question as listed by optionIDs,
+// which must contain every option ID exactly once.
+func (s service) ReorderOptions(questionID int, optionIDs []int) (models.Question, error) {
+	return s.updateOptions(questionID, func(_ models.QuestionType, options []models.Option) ([]models.Option, error) {
+		if len(optionIDs) != len(options) {
+			return nil, storage.ErrInvalidOrder
+		}
+		byID := make(map[int]models.Option, len(options))
+		for _, option := range options {
+			byID[option.ID] = option
+		}
+
+		next := make([]models.Option, 0, len(optionIDs))
+		for _, id := range optionIDs {
+			option, exists := byID[id]
+			if !exists {
+				return nil, storage.ErrInvalidOrder
+			}
+			delete(byID, id)
+			next = append(next, option)
+		}
+		return next, nil
+	})
+}
+
+// updateOptions replaces the options of the question with the ones fn derives
+// from a copy of them, and validates the result before storing it. The
+// question is read and written in a single storage operation, so that
+// concurrent changes to its options are not lost.
+func (s service) updateOptions(questionID int, fn func(questionType models.QuestionType, options []models.Option) ([]models.Option, error)) (models.Question, error) {
+	return s.storage.ModifyQuestion(questionID, func(question models.Question) (models.Question, error) {
+		options := make([]models.Option, len(question.Options))
+		copy(options, question.Options)
+		var err error
+		if question.Options, err = fn(question.QuestionType(), options); err != nil {
+			return models.Question{}, err
+		}
+		if err := validate(question, false); err != nil {
+			return models.Question{}, err
+		}
+		return question, nil
+	})
+}
+
+// validate validates the question, ignoring a missing ID if the storage is
+// going to assign one.
+func validate(question models.Question, assignsID bool) error {
+	err := question.Validate()
+	if errs, ok := err.(validation.Errors); ok && assignsID {
+		delete(errs, "id")
+		return errs.Filter()
+	}
+	return err
+}
+
+// assignOptionIDs gives every option without ID the next free one.
+func assignOptionIDs(options []models.Option) []models.Option {
+	maxID := 0
+	for _, option := range options {
+		if option.ID > maxID {
+			maxID = option.ID
+		}
+	}
+
+	assigned := make([]models.Option, len(options))
+	for i, option := range options {
+		if option.ID == 0 {
+			maxID++
+			option.ID = maxID
+		}
+		assigned[i] = option
+	}
+	return assigned
+}
+
+// markCorrect makes every option but the given one incorrect if it is correct
+// and the question is single choice.
+func markCorrect(questionType models.QuestionType, options []models.Option, correct models.Option) []models.Option {
+	if !correct.IsCorrect || questionType != models.QuestionSingleChoice {
+		return options
+	}
+	for i := range options {
+		options[i].IsCorrect = options[i].ID == correct.ID
+	}
+	return options
+}
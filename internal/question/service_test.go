@@ -0,0 +1,158 @@
+package question_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/question"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/pkg/log"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newService(t *testing.T) question.Service {
+	logger, _ := log.NewForTest()
+	return question.NewService(storage.NewStorage(storage.RankLatest), logger)
+}
+
+func TestService_Create(t *testing.T) {
+	service := newService(t)
+
+	created, err := service.Create(models.Question{Text: "New", Options: []models.Option{
+		{Text: "A"}, {ID: 5, Text: "B", IsCorrect: true}, {Text: "C"},
+	}})
+
+	require.NoError(t, err)
+	assert.Equal(t, 11, created.ID)
+	assert.Equal(t, []models.Option{
+		{ID: 6, Text: "A"}, {ID: 5, Text: "B", IsCorrect: true}, {ID: 7, Text: "C"},
+	}, created.Options)
+
+	set, err := service.List()
+	require.NoError(t, err)
+	assert.Equal(t, 2, set.Version)
+	assert.Len(t, set.Questions, 11)
+}
+
+func TestService_CreateInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		question models.Question
+		field    string
+	}{
+		{"no text", models.Question{Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}, "text"},
+		{"one option", models.Question{Text: "Q", Options: []models.Option{{Text: "A", IsCorrect: true}}}, "options"},
+		{"no correct option", models.Question{Text: "Q", Options: []models.Option{{Text: "A"}, {Text: "B"}}}, "options"},
+		{"two correct options", models.Question{Text: "Q", Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B", IsCorrect: true}}}, "options"},
+		{"duplicate option IDs", models.Question{Text: "Q", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}, {ID: 1, Text: "B"}}}, "options"},
+		{"unknown type", models.Question{Type: "essay", Text: "Q"}, "type"},
+		{"multiple choice without correct option", models.Question{Type: models.QuestionMultipleChoice, Text: "Q", Options: []models.Option{{Text: "A"}, {Text: "B"}}}, "options"},
+		{"true/false without key", models.Question{Type: models.QuestionTrueFalse, Text: "Q"}, "isTrue"},
+		{"true/false with options", models.Question{Type: models.QuestionTrueFalse, Text: "Q", IsTrue: new(bool), Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}, "options"},
+		{"numeric without key", models.Question{Type: models.QuestionNumeric, Text: "Q"}, "numericKey"},
+		{"negative tolerance", models.Question{Type: models.QuestionNumeric, Text: "Q", NumericKey: &models.NumericKey{Value: 1, Tolerance: -1}}, "numericKey"},
+		{"text without accepted answers", models.Question{Type: models.QuestionText, Text: "Q", TextKey: &models.TextKey{}}, "textKey"},
+		{"text with invalid pattern", models.Question{Type: models.QuestionText, Text: "Q", TextKey: &models.TextKey{Pattern: "("}}, "textKey"},
+		{"negative points", models.Question{Text: "Q", Points: -1, Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}, "points"},
+		{"proportional single choice", models.Question{Text: "Q", Scoring: models.ScoringProportional, Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}}, "scoring"},
+		{"single choice with text key", models.Question{Text: "Q", Options: []models.Option{{Text: "A", IsCorrect: true}, {Text: "B"}}, TextKey: &models.TextKey{Accepted: []string{"A"}}}, "textKey"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newService(t).Create(tt.question)
+
+			var errs validation.Errors
+			require.ErrorAs(t, err, &errs)
+			assert.Contains(t, errs, tt.field)
+			assert.NotContains(t, errs, "id")
+		})
+	}
+}
+
+func TestService_MultipleChoiceOptions(t *testing.T) {
+	service := newService(t)
+
+	created, err := service.Create(models.Question{Type: models.QuestionMultipleChoice, Text: "Pick", Options: []models.Option{
+		{Text: "A", IsCorrect: true}, {Text: "B"},
+	}})
+	require.NoError(t, err)
+
+	updated, err := service.AddOption(created.ID, models.Option{Text: "C", IsCorrect: true})
+	require.NoError(t, err)
+	assert.True(t, updated.Options[0].IsCorrect, "multiple choice questions keep their other correct options")
+	assert.True(t, updated.Options[2].IsCorrect)
+}
+
+func TestService_Options(t *testing.T) {
+	service := newService(t)
+
+	// question 1 has the options Berlin, London, Paris (correct) and Madrid
+	updated, err := service.AddOption(1, models.Option{Text: "Lyon", IsCorrect: true})
+	require.NoError(t, err)
+	require.Len(t, updated.Options, 5)
+	assert.Equal(t, models.Option{ID: 5, Text: "Lyon", IsCorrect: true}, updated.Options[4])
+	assert.False(t, updated.Options[2].IsCorrect, "adding a correct option makes the others incorrect")
+
+	updated, err = service.UpdateOption(1, models.Option{ID: 3, Text: "Paris", IsCorrect: true})
+	require.NoError(t, err)
+	assert.True(t, updated.Options[2].IsCorrect)
+	assert.False(t, updated.Options[4].IsCorrect)
+
+	updated, err = service.DeleteOption(1, 5)
+	require.NoError(t, err)
+	assert.Len(t, updated.Options, 4)
+
+	_, err = service.DeleteOption(1, 3)
+	var errs validation.Errors
+	assert.ErrorAs(t, err, &errs, "the correct option cannot be removed on its own")
+
+	updated, err = service.ReorderOptions(1, []int{3, 1, 2, 4})
+	require.NoError(t, err)
+	assert.Equal(t, "Paris", updated.Options[0].Text)
+
+	_, err = service.ReorderOptions(1, []int{3, 1})
+	assert.ErrorIs(t, err, storage.ErrInvalidOrder)
+	_, err = service.UpdateOption(1, models.Option{ID: 9, Text: "Missing"})
+	assert.ErrorIs(t, err, question.ErrOptionNotFound)
+	_, err = service.AddOption(99, models.Option{Text: "Missing"})
+	assert.ErrorIs(t, err, storage.ErrQuestionNotFound)
+
+	stored, err := service.Get(1)
+	require.NoError(t, err)
+	assert.Equal(t, updated, stored)
+}
+
+func TestService_ConcurrentOptionChanges(t *testing.T) {
+	service := newService(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := service.AddOption(1, models.Option{Text: fmt.Sprintf("City %d", i)})
+			assert.NoError(t, err)
+		}(i)
+	}
+	wg.Wait()
+
+	// no option is lost to a concurrent change
+	stored, err := service.Get(1)
+	require.NoError(t, err)
+	assert.Len(t, stored.Options, 24)
+}
+
+func TestService_DeleteUsedQuestion(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	service := question.NewService(store, logger)
+	require.NoError(t, store.SetQuizzes([]models.Quiz{{ID: "space", Title: "Space", QuestionIDs: []int{2, 3}}}))
+
+	assert.ErrorIs(t, service.Delete(2), storage.ErrQuestionInUse)
+	assert.NoError(t, service.Delete(1))
+}
@@ -0,0 +1,33 @@
+package questionbank
+
+import (
+	"github.com/courage173/quiz-api/internal/errors"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers registers the admin routes reporting and triggering
+// question bank reloads.
+func RegisterHandlers(rg *routing.RouteGroup, reloader *Reloader, logger log.Logger) {
+	rg.Get("", getStatus(reloader))
+	rg.Post("/reload", reload(reloader, logger))
+}
+
+func getStatus(reloader *Reloader) routing.Handler {
+	return func(c *routing.Context) error {
+		return c.Write(reloader.Status())
+	}
+}
+
+func reload(reloader *Reloader, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		status, err := reloader.Reload()
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error reloading question banks: %v", err)
+			return errors.BadRequest(err.Error())
+		}
+		return c.Write(status)
+	}
+}
@@ -0,0 +1,166 @@
+// Package questionbank loads quiz questions from JSON and YAML files.
+package questionbank
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Bank is the content of a question bank file, or of a whole directory of
+// them once merged by Load.
+type Bank struct {
+	Questions []models.Question `json:"questions"`
+	Quizzes   []models.Quiz     `json:"quizzes,omitempty"`
+}
+
+// Load reads every .json, .yaml and .yml file in dir, validates the questions
+// and quizzes they contain and merges them into one bank with questions
+// ordered by ID. Question and quiz IDs must be unique across all files of the
+// directory, and quizzes may only list questions defined in it.
+func Load(dir string) (Bank, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return Bank{}, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		switch strings.ToLower(filepath.Ext(entry.Name())) {
+		case ".json", ".yaml", ".yml":
+			files = append(files, entry.Name())
+		}
+	}
+	sort.Strings(files)
+
+	var merged Bank
+	sources := make(map[int]string)
+	quizSources := make(map[string]string)
+	for _, file := range files {
+		bank, err := LoadFile(filepath.Join(dir, file))
+		if err != nil {
+			return Bank{}, err
+		}
+		for _, question := range bank.Questions {
+			if source, exists := sources[question.ID]; exists {
+				return Bank{}, fmt.Errorf("%s: question %d is already defined in %s", file, question.ID, source)
+			}
+			sources[question.ID] = file
+			merged.Questions = append(merged.Questions, question)
+		}
+		for _, quiz := range bank.Quizzes {
+			if source, exists := quizSources[quiz.ID]; exists {
+				return Bank{}, fmt.Errorf("%s: quiz %q is already defined in %s", file, quiz.ID, source)
+			}
+			quizSources[quiz.ID] = file
+			merged.Quizzes = append(merged.Quizzes, quiz)
+		}
+	}
+
+	if len(merged.Questions) == 0 {
+		return Bank{}, fmt.Errorf("no questions found in %s", dir)
+	}
+
+	for _, quiz := range merged.Quizzes {
+		for _, id := range quiz.QuestionIDs {
+			if _, exists := sources[id]; !exists {
+				return Bank{}, fmt.Errorf("%s: quiz %q lists unknown question %d", quizSources[quiz.ID], quiz.ID, id)
+			}
+		}
+		if err := quiz.CheckBlueprint(merged.Questions); err != nil {
+			return Bank{}, fmt.Errorf("%s: quiz %q: %w", quizSources[quiz.ID], quiz.ID, err)
+		}
+	}
+
+	sort.Slice(merged.Questions, func(i, j int) bool {
+		return merged.Questions[i].ID < merged.Questions[j].ID
+	})
+	return merged, nil
+}
+
+// LoadFile reads and validates a single question bank file. The format is
+// picked from the file extension.
+func LoadFile(path string) (Bank, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Bank{}, err
+	}
+
+	name := filepath.Base(path)
+	var bank Bank
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = decodeJSON(data, &bank)
+	case ".yaml", ".yml":
+		err = decodeYAML(data, &bank)
+	default:
+		err = errors.New("unsupported file type")
+	}
+	if err != nil {
+		return Bank{}, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if err := bank.Validate(); err != nil {
+		return Bank{}, fmt.Errorf("%s: %w", name, err)
+	}
+	return bank, nil
+}
+
+// Validate checks every question and quiz of the bank and makes sure no
+// question or quiz ID is used twice.
+func (b Bank) Validate() error {
+	seen := make(map[int]bool, len(b.Questions))
+	for i, question := range b.Questions {
+		if err := question.Validate(); err != nil {
+			return fmt.Errorf("question #%d: %w", i+1, err)
+		}
+		if seen[question.ID] {
+			return fmt.Errorf("question #%d: duplicate question ID %d", i+1, question.ID)
+		}
+		seen[question.ID] = true
+	}
+
+	seenQuizzes := make(map[string]bool, len(b.Quizzes))
+	for i, quiz := range b.Quizzes {
+		if err := quiz.Validate(); err != nil {
+			return fmt.Errorf("quiz #%d: %w", i+1, err)
+		}
+		if seenQuizzes[quiz.ID] {
+			return fmt.Errorf("quiz #%d: duplicate quiz ID %q", i+1, quiz.ID)
+		}
+		seenQuizzes[quiz.ID] = true
+	}
+	return nil
+}
+
+func decodeJSON(data []byte, bank *Bank) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(bank)
+}
+
+// decodeYAML decodes YAML through JSON so that both formats share the JSON
+// field names of the models.
+func decodeYAML(data []byte, bank *Bank) error {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	converted, err := json.Marshal(document)
+	if err != nil {
+		return err
+	}
+	return decodeJSON(converted, bank)
+}
@@ -0,0 +1,157 @@
+package questionbank_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/courage173/quiz-api/internal/questionbank"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeBank(t *testing.T, dir, name, content string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	writeBank(t, dir, "science.json", `{"questions": [
+		{"id": 2, "text": "What is H2O?", "options": [
+			{"id": 1, "text": "Water", "isCorrect": true},
+			{"id": 2, "text": "Salt"}
+		]}
+	]}`)
+	writeBank(t, dir, "geography.yaml", `
+questions:
+  - id: 1
+    text: What is the capital of France?
+    options:
+      - { id: 1, text: Berlin }
+      - { id: 2, text: Paris, isCorrect: true }
+`)
+	writeBank(t, dir, "quizzes.yaml", `
+quizzes:
+  - id: mixed
+    title: Mixed
+    questionIds: [2, 1]
+`)
+	writeBank(t, dir, "README.md", "ignored")
+
+	bank, err := questionbank.Load(dir)
+
+	require.NoError(t, err)
+	require.Len(t, bank.Questions, 2)
+	assert.Equal(t, 1, bank.Questions[0].ID)
+	assert.True(t, bank.Questions[0].Options[1].IsCorrect)
+	assert.Equal(t, "What is H2O?", bank.Questions[1].Text)
+	require.Len(t, bank.Quizzes, 1)
+	assert.Equal(t, []int{2, 1}, bank.Quizzes[0].QuestionIDs)
+}
+
+func TestLoad_ShippedBank(t *testing.T) {
+	bank, err := questionbank.Load("../../questions")
+
+	require.NoError(t, err)
+	assert.Len(t, bank.Questions, 10)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{
+			name:    "empty directory",
+			files:   map[string]string{},
+			wantErr: "no questions found",
+		},
+		{
+			name: "empty text",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "", "options": [
+				{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B"}]}]}`},
+			wantErr: "a.json: question #1: text: cannot be blank.",
+		},
+		{
+			name: "no correct option",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "Q", "options": [
+				{"id": 1, "text": "A"}, {"id": 2, "text": "B"}]}]}`},
+			wantErr: "a.json: question #1: options: exactly one option must be correct.",
+		},
+		{
+			name: "two correct options",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "Q", "options": [
+				{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B", "isCorrect": true}]}]}`},
+			wantErr: "a.json: question #1: options: exactly one option must be correct.",
+		},
+		{
+			name: "duplicate option IDs",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "Q", "options": [
+				{"id": 1, "text": "A", "isCorrect": true}, {"id": 1, "text": "B"}]}]}`},
+			wantErr: "a.json: question #1: options: option IDs must be unique.",
+		},
+		{
+			name: "duplicate question IDs across files",
+			files: map[string]string{
+				"a.json": `{"questions": [{"id": 1, "text": "Q", "options": [
+					{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B"}]}]}`,
+				"b.yml": "questions:\n  - {id: 1, text: Q, options: [{id: 1, text: A, isCorrect: true}, {id: 2, text: B}]}\n",
+			},
+			wantErr: "b.yml: question 1 is already defined in a.json",
+		},
+		{
+			name: "invalid quiz ID",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "Q", "options": [
+				{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B"}]}],
+				"quizzes": [{"id": "Not A Slug", "title": "Quiz"}]}`},
+			wantErr: "a.json: quiz #1: id: must be in a valid format.",
+		},
+		{
+			name: "negative attempt limit",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "Q", "options": [
+				{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B"}]}],
+				"quizzes": [{"id": "quiz", "title": "Quiz", "maxAttempts": -1}]}`},
+			wantErr: "a.json: quiz #1: maxAttempts: must be no less than 0.",
+		},
+		{
+			name: "quiz with unknown question",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "Q", "options": [
+				{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B"}]}],
+				"quizzes": [{"id": "quiz", "title": "Quiz", "questionIds": [1, 5]}]}`},
+			wantErr: `a.json: quiz "quiz" lists unknown question 5`,
+		},
+		{
+			name: "blueprint with too few matching questions",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "Q", "tags": ["science"], "options": [
+				{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B"}]}],
+				"quizzes": [{"id": "quiz", "title": "Quiz", "blueprint": [{"tag": "science", "difficulty": "hard", "count": 1}]}]}`},
+			wantErr: `a.json: quiz "quiz": blueprint rule 1 asks for 1 questions but only 0 match`,
+		},
+		{
+			name: "invalid difficulty",
+			files: map[string]string{"a.json": `{"questions": [{"id": 1, "text": "Q", "difficulty": "tricky", "options": [
+				{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B"}]}]}`},
+			wantErr: "a.json: question #1: difficulty: must be a valid value.",
+		},
+		{
+			name:    "unknown field",
+			files:   map[string]string{"a.json": `{"question": []}`},
+			wantErr: `a.json: json: unknown field "question"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				writeBank(t, dir, name, content)
+			}
+
+			_, err := questionbank.Load(dir)
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
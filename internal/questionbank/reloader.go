@@ -0,0 +1,148 @@
+package questionbank
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/pkg/log"
+)
+
+// Store is the part of the storage the reloader swaps question sets in.
+type Store interface {
+	SetQuestionBank(questions []models.Question, quizzes []models.Quiz) (int, error)
+}
+
+// Status describes the outcome of the latest reload.
+type Status struct {
+	Dir           string    `json:"dir"`
+	Version       int       `json:"version"`
+	QuestionCount int       `json:"questionCount"`
+	QuizCount     int       `json:"quizCount"`
+	LoadedAt      time.Time `json:"loadedAt"`
+	LastAttemptAt time.Time `json:"lastAttemptAt"`
+	LastError     string    `json:"lastError,omitempty"`
+}
+
+// Reloader loads the question banks of a directory into a Store and reloads
+// them whenever the directory changes. A bank that fails to load or validate
+// is never swapped in; the previous version keeps being served.
+type Reloader struct {
+	dir    string
+	store  Store
+	logger log.Logger
+
+	mu          sync.Mutex
+	status      Status
+	fingerprint string
+}
+
+func NewReloader(dir string, store Store, logger log.Logger) *Reloader {
+	return &Reloader{
+		dir:    dir,
+		store:  store,
+		logger: logger,
+		status: Status{Dir: dir},
+	}
+}
+
+// Reload loads the question banks and swaps them into the store as a new
+// question set version.
+func (r *Reloader) Reload() (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fingerprint, _ := r.snapshotDir()
+	return r.reload(fingerprint)
+}
+
+func (r *Reloader) reload(fingerprint string) (Status, error) {
+	r.status.LastAttemptAt = time.Now()
+	// remember the attempt even if it fails so that a broken bank is only
+	// reported once instead of on every poll
+	r.fingerprint = fingerprint
+
+	bank, err := Load(r.dir)
+	if err == nil {
+		var version int
+		// the quizzes are swapped together with the questions they refer to
+		if version, err = r.store.SetQuestionBank(bank.Questions, bank.Quizzes); err == nil {
+			r.status.Version = version
+			r.status.QuestionCount = len(bank.Questions)
+			r.status.QuizCount = len(bank.Quizzes)
+			r.status.LoadedAt = r.status.LastAttemptAt
+			r.status.LastError = ""
+			r.logger.Infof("Loaded %d questions and %d quizzes from %s as version %d", len(bank.Questions), len(bank.Quizzes), r.dir, version)
+			return r.status, nil
+		}
+	}
+
+	r.status.LastError = err.Error()
+	r.logger.Errorf("Could not reload question banks from %s: %v", r.dir, err)
+	return r.status, err
+}
+
+// Status returns the outcome of the latest reload.
+func (r *Reloader) Status() Status {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// Watch polls the bank directory every interval and reloads the banks when a
+// file was added, removed or modified. It returns when ctx is done.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.poll()
+		}
+	}
+}
+
+func (r *Reloader) poll() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	fingerprint, err := r.snapshotDir()
+	if err != nil {
+		r.logger.Errorf("Could not read question bank directory %s: %v", r.dir, err)
+		return
+	}
+	if fingerprint == r.fingerprint {
+		return
+	}
+	r.reload(fingerprint)
+}
+
+// snapshotDir returns a fingerprint of the names, sizes and modification
+// times of the files in the bank directory.
+func (r *Reloader) snapshotDir() (string, error) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		return "", err
+	}
+
+	parts := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// the file was removed while reading the directory
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", entry.Name(), info.Size(), info.ModTime().UnixNano()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|"), nil
+}
@@ -0,0 +1,73 @@
+package questionbank_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/questionbank"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const validBank = `{"questions": [{"id": 1, "text": "Question 1", "options": [
+	{"id": 1, "text": "A", "isCorrect": true}, {"id": 2, "text": "B"}]}]}`
+
+const updatedBank = `{"questions": [{"id": 1, "text": "Question 1 updated", "options": [
+	{"id": 1, "text": "A"}, {"id": 2, "text": "B", "isCorrect": true}]}]}`
+
+func TestReloader_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writeBank(t, dir, "bank.json", validBank)
+
+	store := storage.NewStorage(storage.RankLatest)
+	logger, _ := log.NewForTest()
+	reloader := questionbank.NewReloader(dir, store, logger)
+
+	status, err := reloader.Reload()
+	require.NoError(t, err)
+	assert.Equal(t, 2, status.Version)
+	assert.Equal(t, 1, status.QuestionCount)
+	assert.Len(t, store.GetQuestions(), 1)
+
+	// a broken bank is reported and the previous version keeps being served
+	writeBank(t, dir, "bank.json", `{"questions": [{"id": 1}]}`)
+	status, err = reloader.Reload()
+	assert.Error(t, err)
+	assert.Equal(t, 2, status.Version)
+	assert.NotEmpty(t, status.LastError)
+	assert.Equal(t, "Question 1", store.GetQuestions()[0].Text)
+	assert.Equal(t, status, reloader.Status())
+}
+
+func TestReloader_Watch(t *testing.T) {
+	dir := t.TempDir()
+	writeBank(t, dir, "bank.json", validBank)
+
+	store := storage.NewStorage(storage.RankLatest)
+	logger, _ := log.NewForTest()
+	reloader := questionbank.NewReloader(dir, store, logger)
+	_, err := reloader.Reload()
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go reloader.Watch(ctx, 10*time.Millisecond)
+
+	writeBank(t, dir, "bank.json", updatedBank)
+
+	assert.Eventually(t, func() bool {
+		return reloader.Status().Version == 3
+	}, time.Second, 10*time.Millisecond)
+
+	// the version in-flight submissions were started against is still there
+	previous, err := store.GetQuestionSet(2)
+	require.NoError(t, err)
+	assert.Equal(t, "Question 1", previous.Questions[0].Text)
+
+	current, err := store.GetQuestionSet(0)
+	require.NoError(t, err)
+	assert.Equal(t, "Question 1 updated", current.Questions[0].Text)
+}
@@ -1,69 +1,401 @@
 package quiz
 
 import (
+	stderrors "errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/auth"
+
 	"github.com/courage173/quiz-api/internal/errors"
 
 	"github.com/courage173/quiz-api/internal/models"
 
+	"github.com/courage173/quiz-api/internal/storage"
+
 	"github.com/courage173/quiz-api/pkg/log"
 
 	routing "github.com/go-ozzo/ozzo-routing/v2"
 )
 
-func RegisterHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
-	rg.Get("", getQuiz(service, logger))
-	rg.Get("/submission/<username>", getUserSubmission(service, logger))
-	rg.Post("/submit", submitQuiz(service, logger))
+// quizIDFunc resolves the ID of the quiz a request is about.
+type quizIDFunc func(c *routing.Context) string
+
+// defaultQuiz serves the routes that predate multiple quizzes.
+func defaultQuiz(*routing.Context) string {
+	return models.DefaultQuizID
+}
+
+func quizIDParam(c *routing.Context) string {
+	return c.Param("id")
+}
+
+// RegisterHandlers registers the routes of the default quiz. authHandler
+// guards the routes that submit, or read the submissions of, a user.
+func RegisterHandlers(rg *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	rg.Get("", getQuiz(service, defaultQuiz, logger))
+	rg.Get("/submission/<username>", authHandler, getUserSubmission(service, defaultQuiz, logger))
+	rg.Get("/submission/<username>/attempts", authHandler, getUserAttempts(service, defaultQuiz, logger))
+	rg.Post("/submit", authHandler, submitQuiz(service, defaultQuiz, logger))
+	rg.Post("/sessions", authHandler, startSession(service, defaultQuiz, logger))
+	rg.Get("/leaderboard", getLeaderboard(service, defaultQuiz, logger))
+	rg.Get("/leaderboard/around/<username>", getLeaderboardAround(service, defaultQuiz, logger))
+	rg.Get("/statistics", getStatistics(service, defaultQuiz, logger))
+}
+
+// RegisterQuizzesHandlers registers the routes addressing quizzes by ID.
+func RegisterQuizzesHandlers(rg *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	rg.Get("", listQuizzes(service, logger))
+	rg.Get("/<id>", getQuizDetails(service, logger))
+	rg.Get("/<id>/submission/<username>", authHandler, getUserSubmission(service, quizIDParam, logger))
+	rg.Get("/<id>/submission/<username>/attempts", authHandler, getUserAttempts(service, quizIDParam, logger))
+	rg.Post("/<id>/submit", authHandler, submitQuiz(service, quizIDParam, logger))
+	rg.Post("/<id>/sessions", authHandler, startSession(service, quizIDParam, logger))
+	rg.Get("/<id>/leaderboard", getLeaderboard(service, quizIDParam, logger))
+	rg.Get("/<id>/leaderboard/around/<username>", getLeaderboardAround(service, quizIDParam, logger))
+	rg.Get("/<id>/statistics", getStatistics(service, quizIDParam, logger))
+}
+
+// RegisterAdminHandlers registers the routes that expose the answer key. The
+// route group is expected to be restricted to authors.
+func RegisterAdminHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
+	rg.Get("", getQuizWithAnswers(service, defaultQuiz, logger))
+	rg.Get("/<id>", getQuizWithAnswers(service, quizIDParam, logger))
+	rg.Get("/sessions/<sessionId>", getSession(service, logger))
+}
+
+// versionHeader carries the question set version the returned questions
+// belong to. Clients send it back as the version of their submission.
+const versionHeader = "X-Question-Version"
+
+// idempotencyKeyHeader carries the key clients choose to make retries of a
+// submission safe. Responses returned again to a retry carry replayedHeader.
+const (
+	idempotencyKeyHeader    = "Idempotency-Key"
+	replayedHeader          = "Idempotent-Replayed"
+	maxIdempotencyKeyLength = 255
+)
 
+// toErrorResponse maps errors returned by the service to error responses.
+// Error responses and validation errors are passed on as they are, and any
+// other error is left to the errors middleware to report as a 500 without
+// its details.
+func toErrorResponse(err error) error {
+	var response errors.ErrorResponse
+	if stderrors.As(err, &response) {
+		return response
+	}
+	switch {
+	case stderrors.Is(err, storage.ErrQuizNotFound), stderrors.Is(err, storage.ErrSessionNotFound),
+		stderrors.Is(err, storage.ErrSubmissionNotFound):
+		return errors.NotFound(err.Error())
+	case stderrors.Is(err, storage.ErrVersionNotFound):
+		return errors.BadRequest(err.Error())
+	}
+	return err
 }
 
-func getQuiz(service Service, logger log.Logger) routing.Handler {
+// currentUser returns the authenticated user of the request. The admin token
+// and API keys minted for no user authenticate no user and cannot take
+// quizzes.
+func currentUser(c *routing.Context) (auth.Principal, error) {
+	principal, ok := auth.CurrentPrincipal(c.Request.Context())
+	if !ok {
+		return auth.Principal{}, errors.Unauthorized("")
+	}
+	if principal.UserID == "" {
+		return auth.Principal{}, errors.Forbidden("Only users can take quizzes")
+	}
+	return principal, nil
+}
+
+// ownUser returns the user name in the path if the authenticated user may
+// read its submissions: users may read their own, admins anyone's.
+func ownUser(c *routing.Context) (string, error) {
+	username := c.Param("username")
+	principal, ok := auth.CurrentPrincipal(c.Request.Context())
+	if !ok {
+		return "", errors.Unauthorized("")
+	}
+	if username != principal.UserName && !principal.Allows(models.RoleAdmin) {
+		return "", errors.Forbidden("")
+	}
+	return username, nil
+}
+
+func listQuizzes(service Service, logger log.Logger) routing.Handler {
 	return func(c *routing.Context) error {
-		response := service.GetQuestions()
+		response, err := service.GetQuizzes()
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting quizzes: %v", err)
+			return err
+		}
+		return c.Write(response)
+	}
+}
+
+func getQuizDetails(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.GetQuiz(c.Param("id"))
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting quiz: %v", err)
+			return toErrorResponse(err)
+		}
+		c.Response.Header().Set(versionHeader, strconv.Itoa(response.Version))
+		return c.Write(response)
+	}
+}
 
-		if len(response) == 0 {
+func getQuiz(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.GetQuestions(quizID(c))
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting questions: %v", err)
+			return toErrorResponse(err)
+		}
+
+		if len(response.Questions) == 0 {
 			logger.With(c.Request.Context()).Infof("No questions found")
 			return errors.NotFound("")
 		}
-		return c.Write(response)
+		c.Response.Header().Set(versionHeader, strconv.Itoa(response.Version))
+		return c.Write(response.Questions)
 	}
 }
 
-func submitQuiz(service Service, logger log.Logger) routing.Handler {
+func getQuizWithAnswers(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
 	return func(c *routing.Context) error {
+		response, err := service.GetQuestionsWithAnswers(quizID(c))
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting questions: %v", err)
+			return toErrorResponse(err)
+		}
+
+		if len(response.Questions) == 0 {
+			logger.With(c.Request.Context()).Infof("No questions found")
+			return errors.NotFound("")
+		}
+		c.Response.Header().Set(versionHeader, strconv.Itoa(response.Version))
+		return c.Write(response.Questions)
+	}
+}
+
+func submitQuiz(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		principal, err := currentUser(c)
+		if err != nil {
+			return err
+		}
+
 		var req models.Submission
 
 		if err := c.Read(&req); err != nil {
 			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
 			return errors.BadRequest("")
 		}
+		req.UserName, req.UserID = principal.UserName, principal.UserID
 
 		if err := req.Validate(); err != nil {
 			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
 			return err
 		}
 
-		response, err := service.SubmitQuiz(req)
+		key := c.Request.Header.Get(idempotencyKeyHeader)
+		if key == "" {
+			response, err := service.SubmitQuiz(quizID(c), req)
 
+			if err != nil {
+				logger.With(c.Request.Context()).Errorf("Error submitting quiz: %v", err)
+				return toErrorResponse(err)
+			}
+
+			return c.Write(response)
+		}
+
+		if len(key) > maxIdempotencyKeyLength {
+			return errors.BadRequest(fmt.Sprintf("The %s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength))
+		}
+		response, replayed, err := service.SubmitQuizOnce(quizID(c), key, req)
 		if err != nil {
 			logger.With(c.Request.Context()).Errorf("Error submitting quiz: %v", err)
-			return errors.BadRequest(err.Error())
+			return toErrorResponse(err)
+		}
+		if replayed {
+			c.Response.Header().Set(replayedHeader, "true")
 		}
-
 		return c.Write(response)
 	}
 }
 
-func getUserSubmission(service Service, logger log.Logger) routing.Handler {
+func getUserSubmission(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
 	return func(c *routing.Context) error {
-		username := c.Param("username")
-		response, err := service.GetUserSubmission(username)
+		username, err := ownUser(c)
+		if err != nil {
+			return err
+		}
+		window, err := windowQuery(c, time.Now())
+		if err != nil {
+			return err
+		}
+		response, err := service.GetUserSubmission(quizID(c), username, window)
 
 		if err != nil {
 			logger.With(c.Request.Context()).Errorf("Error getting user submission: %v", err)
-			return errors.BadRequest(err.Error())
+			return toErrorResponse(err)
+		}
+
+		return c.Write(response)
+	}
+}
+
+func getUserAttempts(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		username, err := ownUser(c)
+		if err != nil {
+			return err
+		}
+
+		response, err := service.GetUserAttempts(quizID(c), username)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting user attempts: %v", err)
+			return toErrorResponse(err)
 		}
 
 		return c.Write(response)
 	}
 }
+
+func startSession(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		principal, err := currentUser(c)
+		if err != nil {
+			return err
+		}
+
+		response, err := service.StartSession(quizID(c), principal.UserName)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error starting session: %v", err)
+			return toErrorResponse(err)
+		}
+
+		c.Response.Header().Set(versionHeader, strconv.Itoa(response.Version))
+		return c.WriteWithStatus(response, http.StatusCreated)
+	}
+}
+
+func getSession(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.GetSession(c.Param("sessionId"))
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting session: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func getLeaderboard(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		limit, err := intQuery(c, "limit")
+		if err != nil {
+			return errors.BadRequest("The limit must be a number")
+		}
+
+		window, err := windowQuery(c, time.Now())
+		if err != nil {
+			return err
+		}
+
+		response, err := service.GetLeaderboard(quizID(c), window, limit, c.Query("cursor"))
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting leaderboard: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func getLeaderboardAround(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		neighbours, err := intQuery(c, "neighbours")
+		if err != nil {
+			return errors.BadRequest("The neighbours must be a number")
+		}
+
+		window, err := windowQuery(c, time.Now())
+		if err != nil {
+			return err
+		}
+
+		response, err := service.GetLeaderboardAround(quizID(c), c.Param("username"), window, neighbours)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting leaderboard: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func getStatistics(service Service, quizID quizIDFunc, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		window, err := windowQuery(c, time.Now())
+		if err != nil {
+			return err
+		}
+
+		response, err := service.GetStatistics(quizID(c), window)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting statistics: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+// intQuery returns the integer query parameter with the given name, or 0 if
+// it is missing.
+func intQuery(c *routing.Context, name string) (int, error) {
+	value := c.Query(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// windowQuery returns the window the rankings of the request are limited to:
+// either the current window of the period query parameter, or the range
+// between the from and to query parameters, given as RFC 3339 times.
+func windowQuery(c *routing.Context, now time.Time) (models.Window, error) {
+	period, from, to := c.Query("period"), c.Query("from"), c.Query("to")
+	if from == "" && to == "" {
+		window, err := models.Period(period).Window(now)
+		if err != nil {
+			return models.Window{}, errors.BadRequest("The period must be all, daily, weekly or monthly")
+		}
+		return window, nil
+	}
+	if period != "" {
+		return models.Window{}, errors.BadRequest("Either a period or a from and to range can be given")
+	}
+
+	var window models.Window
+	for _, bound := range []struct {
+		value string
+		time  *time.Time
+	}{{from, &window.From}, {to, &window.To}} {
+		if bound.value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, bound.value)
+		if err != nil {
+			return models.Window{}, errors.BadRequest("The from and to times must be RFC 3339 times")
+		}
+		*bound.time = parsed.UTC()
+	}
+	if !window.From.IsZero() && !window.To.IsZero() && !window.From.Before(window.To) {
+		return models.Window{}, errors.BadRequest("The from time must be before the to time")
+	}
+	return window, nil
+}
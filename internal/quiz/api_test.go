@@ -3,14 +3,21 @@ package quiz_test
 import (
 	"bytes"
 	"encoding/json"
+	stderrors "errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/courage173/quiz-api/internal/auth"
+	"github.com/courage173/quiz-api/internal/errors"
 	"github.com/courage173/quiz-api/internal/models"
 	"github.com/courage173/quiz-api/internal/quiz"
+	"github.com/courage173/quiz-api/internal/storage"
 	"github.com/courage173/quiz-api/pkg/log"
 	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -19,38 +26,101 @@ type MockService struct {
 	mock.Mock
 }
 
-func (m *MockService) GetQuestions() []models.Question {
+func (m *MockService) GetQuizzes() ([]models.QuizSummary, error) {
 	args := m.Called()
-	return args.Get(0).([]models.Question)
+	return args.Get(0).([]models.QuizSummary), args.Error(1)
 }
 
-func (m *MockService) SubmitQuiz(submission models.Submission) (models.SubmissionResponse, error) {
-	args := m.Called(submission)
+func (m *MockService) GetQuiz(quizID string) (models.QuizDetails, error) {
+	args := m.Called(quizID)
+	return args.Get(0).(models.QuizDetails), args.Error(1)
+}
+
+func (m *MockService) GetQuestions(quizID string) (models.PublicQuestionSet, error) {
+	args := m.Called(quizID)
+	return args.Get(0).(models.PublicQuestionSet), args.Error(1)
+}
+
+func (m *MockService) GetQuestionsWithAnswers(quizID string) (models.QuestionSet, error) {
+	args := m.Called(quizID)
+	return args.Get(0).(models.QuestionSet), args.Error(1)
+}
+
+func (m *MockService) SubmitQuiz(quizID string, submission models.Submission) (models.SubmissionResponse, error) {
+	args := m.Called(quizID, submission)
 	return args.Get(0).(models.SubmissionResponse), args.Error(1)
 }
 
-func (m *MockService) GetUserSubmission(userName string) (models.GetSubmissionResponse, error) {
-	args := m.Called(userName)
+func (m *MockService) SubmitQuizOnce(quizID, key string, submission models.Submission) (json.RawMessage, bool, error) {
+	args := m.Called(quizID, key, submission)
+	return args.Get(0).(json.RawMessage), args.Bool(1), args.Error(2)
+}
+
+func (m *MockService) GetUserSubmission(quizID, userName string, window models.Window) (models.GetSubmissionResponse, error) {
+	args := m.Called(quizID, userName, window)
 	return args.Get(0).(models.GetSubmissionResponse), args.Error(1)
 }
 
+func (m *MockService) GetUserAttempts(quizID, userName string) (models.AttemptsResponse, error) {
+	args := m.Called(quizID, userName)
+	return args.Get(0).(models.AttemptsResponse), args.Error(1)
+}
+
+func (m *MockService) StartSession(quizID, userName string) (models.SessionResponse, error) {
+	args := m.Called(quizID, userName)
+	return args.Get(0).(models.SessionResponse), args.Error(1)
+}
+
+func (m *MockService) GetSession(sessionID string) (models.SessionDetails, error) {
+	args := m.Called(sessionID)
+	return args.Get(0).(models.SessionDetails), args.Error(1)
+}
+
+func (m *MockService) GetLeaderboard(quizID string, window models.Window, limit int, cursor string) (models.Leaderboard, error) {
+	args := m.Called(quizID, window, limit, cursor)
+	return args.Get(0).(models.Leaderboard), args.Error(1)
+}
+
+func (m *MockService) GetLeaderboardAround(quizID, userName string, window models.Window, neighbours int) (models.Leaderboard, error) {
+	args := m.Called(quizID, userName, window, neighbours)
+	return args.Get(0).(models.Leaderboard), args.Error(1)
+}
+
+func (m *MockService) GetStatistics(quizID string, window models.Window) (models.Statistics, error) {
+	args := m.Called(quizID, window)
+	return args.Get(0).(models.Statistics), args.Error(1)
+}
+
+var tokens = auth.NewTokens([]byte("secret"), time.Hour)
+
 func setupRouter(service *MockService, logger log.Logger) *routing.Router {
 	router := routing.New()
+	router.Use(content.TypeNegotiator(content.JSON), auth.Handler(tokens, nil, "admin-secret"))
 	rg := router.Group("/v1")
 
-	quiz.RegisterHandlers(rg.Group("/quiz"), service, logger)
+	authHandler := auth.RequireRole(models.RoleParticipant)
+	quiz.RegisterHandlers(rg.Group("/quiz"), service, authHandler, logger)
+	quiz.RegisterQuizzesHandlers(rg.Group("/quizzes"), service, authHandler, logger)
+	quiz.RegisterAdminHandlers(rg.Group("/admin/quiz"), service, logger)
 	return router
 }
 
+// authorize authenticates the request as testUser.
+func authorize(t *testing.T, req *http.Request) {
+	token, _, err := tokens.Issue(models.User{ID: "user-1", UserName: "testUser", Role: models.RoleParticipant})
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
 func TestGetQuizHandler(t *testing.T) {
 	mockService := new(MockService)
 	logger, _ := log.NewForTest()
 	router := setupRouter(mockService, logger)
 
 	// Mock the GetQuestions method
-	mockService.On("GetQuestions").Return([]models.Question{
-		{ID: 1, Text: "Question 1", Options: []models.Option{{ID: 1, Text: "Option 1"}}},
-	})
+	mockService.On("GetQuestions", models.DefaultQuizID).Return(models.PublicQuestionSet{Version: 3, Questions: []models.PublicQuestion{
+		{ID: 1, Text: "Question 1", Options: []models.PublicOption{{ID: 1, Text: "Option 1"}}},
+	}}, nil)
 
 	req := httptest.NewRequest("GET", "/v1/quiz", nil)
 	resp := httptest.NewRecorder()
@@ -58,6 +128,27 @@ func TestGetQuizHandler(t *testing.T) {
 	router.ServeHTTP(resp, req)
 
 	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, "3", resp.Header().Get("X-Question-Version"))
+	assert.NotContains(t, resp.Body.String(), "isCorrect")
+	mockService.AssertExpectations(t)
+}
+
+func TestGetQuizWithAnswersHandler(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := log.NewForTest()
+	router := setupRouter(mockService, logger)
+
+	mockService.On("GetQuestionsWithAnswers", models.DefaultQuizID).Return(models.QuestionSet{Version: 1, Questions: []models.Question{
+		{ID: 1, Text: "Question 1", Options: []models.Option{{ID: 1, Text: "Option 1", IsCorrect: true}}},
+	}}, nil)
+
+	req := httptest.NewRequest("GET", "/v1/admin/quiz", nil)
+	resp := httptest.NewRecorder()
+
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"isCorrect":true`)
 	mockService.AssertExpectations(t)
 }
 
@@ -68,20 +159,25 @@ func TestSubmitQuizHandler(t *testing.T) {
 
 	validSubmission := models.Submission{
 		UserName: "testUser",
+		UserID:   "user-1",
 		Answers: []models.Answer{
 			{QuestionID: 1, OptionID: 2},
 		},
 	}
 
-	mockService.On("SubmitQuiz", validSubmission).Return(models.SubmissionResponse{
-		Message:               "You got 1 questions out of 1",
+	mockService.On("SubmitQuiz", models.DefaultQuizID, validSubmission).Return(models.SubmissionResponse{
+		Message:               "You scored 1 out of 1 points",
 		Score:                 1,
+		MaxScore:              1,
+		Percentage:            100,
 		TotalQuestionAnswered: 1,
 	}, nil)
 
-	body, _ := json.Marshal(validSubmission)
+	// the user name is taken from the token rather than the body
+	body, _ := json.Marshal(models.Submission{UserName: "someoneElse", Answers: validSubmission.Answers})
 	req := httptest.NewRequest("POST", "/v1/quiz/submit", bytes.NewReader(body))
 	req.Header.Set("Content-Type", "application/json")
+	authorize(t, req)
 	resp := httptest.NewRecorder()
 
 	router.ServeHTTP(resp, req)
@@ -90,12 +186,49 @@ func TestSubmitQuizHandler(t *testing.T) {
 	mockService.AssertExpectations(t)
 }
 
+func TestSubmitQuizHandler_IdempotencyKey(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := log.NewForTest()
+	router := setupRouter(mockService, logger)
+
+	submission := models.Submission{
+		UserName: "testUser",
+		UserID:   "user-1",
+		Answers:  []models.Answer{{QuestionID: 1, OptionID: 2}},
+	}
+	mockService.On("SubmitQuizOnce", "space", "retry-1", submission).Return(json.RawMessage(`{"score":1}`), false, nil).Once()
+	mockService.On("SubmitQuizOnce", "space", "retry-1", submission).Return(json.RawMessage(`{"score":1}`), true, nil).Once()
+
+	body, _ := json.Marshal(submission)
+	submit := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/v1/quizzes/space/submit", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		authorize(t, req)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	first := submit("retry-1")
+	assert.Equal(t, http.StatusOK, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	replay := submit("retry-1")
+	assert.Equal(t, http.StatusOK, replay.Code)
+	assert.Equal(t, "true", replay.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Body.String(), replay.Body.String())
+
+	assert.Equal(t, http.StatusBadRequest, submit(strings.Repeat("k", 256)).Code)
+	mockService.AssertExpectations(t)
+}
+
 func TestGetUserSubmissionHandler(t *testing.T) {
 	mockService := new(MockService)
 	logger, _ := log.NewForTest()
 	router := setupRouter(mockService, logger)
 
-	mockService.On("GetUserSubmission", "testUser").Return(models.GetSubmissionResponse{
+	mockService.On("GetUserSubmission", models.DefaultQuizID, "testUser", models.Window{}).Return(models.GetSubmissionResponse{
 		Message:               "You were better than 75.00% of all quizzers",
 		Score:                 8,
 		Rank:                  "75.00%",
@@ -103,6 +236,7 @@ func TestGetUserSubmissionHandler(t *testing.T) {
 	}, nil)
 
 	req := httptest.NewRequest("GET", "/v1/quiz/submission/testUser", nil)
+	authorize(t, req)
 	resp := httptest.NewRecorder()
 
 	router.ServeHTTP(resp, req)
@@ -110,3 +244,191 @@ func TestGetUserSubmissionHandler(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.Code)
 	mockService.AssertExpectations(t)
 }
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode int
+		wantBody string
+	}{
+		{"no submission", storage.ErrSubmissionNotFound, http.StatusNotFound, "submission not found"},
+		{"unknown quiz", storage.ErrQuizNotFound, http.StatusNotFound, "quiz not found"},
+		{"storage failure", stderrors.New("database is locked"), http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockService := new(MockService)
+			logger, _ := log.NewForTest()
+			router := routing.New()
+			router.Use(errors.Handler(logger), content.TypeNegotiator(content.JSON), auth.Handler(tokens, nil, "admin-secret"))
+			quiz.RegisterHandlers(router.Group("/v1/quiz"), mockService, auth.RequireRole(models.RoleParticipant), logger)
+
+			mockService.On("GetUserSubmission", models.DefaultQuizID, "testUser", models.Window{}).Return(models.GetSubmissionResponse{}, tt.err)
+
+			req := httptest.NewRequest("GET", "/v1/quiz/submission/testUser", nil)
+			authorize(t, req)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantCode, resp.Code)
+			assert.Contains(t, resp.Body.String(), tt.wantBody)
+			assert.NotContains(t, resp.Body.String(), "database is locked")
+		})
+	}
+}
+
+func TestQuizzesHandlers(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := log.NewForTest()
+	router := setupRouter(mockService, logger)
+
+	mockService.On("GetQuizzes").Return([]models.QuizSummary{{ID: "space", Title: "Space", QuestionCount: 2}}, nil)
+	mockService.On("GetQuiz", "space").Return(models.QuizDetails{ID: "space", Title: "Space", Version: 2}, nil)
+	mockService.On("GetQuiz", "unknown").Return(models.QuizDetails{}, storage.ErrQuizNotFound)
+	mockService.On("SubmitQuiz", "space", mock.Anything).Return(models.SubmissionResponse{Score: 1}, nil)
+	mockService.On("SubmitQuiz", "limited", mock.Anything).Return(models.SubmissionResponse{}, errors.Forbidden("You have used all 2 attempts of this quiz"))
+	mockService.On("GetUserSubmission", "space", "testUser", models.Window{}).Return(models.GetSubmissionResponse{Score: 1}, nil)
+	mockService.On("StartSession", "space", "testUser").Return(models.SessionResponse{Session: models.Session{ID: "abc", Version: 2}}, nil)
+	mockService.On("StartSession", models.DefaultQuizID, "testUser").Return(models.SessionResponse{Session: models.Session{ID: "def", Version: 2}}, nil)
+	mockService.On("GetUserAttempts", "space", "testUser").Return(models.AttemptsResponse{UserName: "testUser"}, nil)
+	mockService.On("GetUserAttempts", models.DefaultQuizID, "testUser").Return(models.AttemptsResponse{UserName: "testUser"}, nil)
+	mockService.On("GetLeaderboard", "space", models.Window{}, 5, "abc").Return(models.Leaderboard{QuizID: "space"}, nil)
+	mockService.On("GetLeaderboard", models.DefaultQuizID, models.Window{}, 0, "").Return(models.Leaderboard{QuizID: models.DefaultQuizID}, nil)
+	mockService.On("GetLeaderboard", "space", models.Window{
+		From: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+	}, 0, "").Return(models.Leaderboard{QuizID: "space"}, nil)
+	mockService.On("GetLeaderboard", "space", mock.MatchedBy(func(window models.Window) bool {
+		return window.To.Sub(window.From) == 24*time.Hour
+	}), 0, "").Return(models.Leaderboard{QuizID: "space"}, nil)
+	mockService.On("GetStatistics", "space", models.Window{}).Return(models.Statistics{QuizID: "space"}, nil)
+	mockService.On("GetStatistics", models.DefaultQuizID, mock.MatchedBy(func(window models.Window) bool {
+		return window.To.Sub(window.From) >= 28*24*time.Hour
+	})).Return(models.Statistics{QuizID: models.DefaultQuizID}, nil)
+	mockService.On("GetLeaderboardAround", "space", "testUser", models.Window{}, 2).Return(models.Leaderboard{QuizID: "space"}, nil)
+	mockService.On("GetLeaderboardAround", models.DefaultQuizID, "testUser", models.Window{}, 0).Return(models.Leaderboard{QuizID: models.DefaultQuizID}, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		body       string
+		wantStatus int
+	}{
+		{"list quizzes", "GET", "/v1/quizzes", "", http.StatusOK},
+		{"get quiz", "GET", "/v1/quizzes/space", "", http.StatusOK},
+		{"unknown quiz", "GET", "/v1/quizzes/unknown", "", http.StatusNotFound},
+		{"submit", "POST", "/v1/quizzes/space/submit", `{"userName": "testUser", "answers": [{"questionId": 1, "optionId": 1}]}`, http.StatusOK},
+		{"submit after the last attempt", "POST", "/v1/quizzes/limited/submit", `{"userName": "testUser", "answers": [{"questionId": 1, "optionId": 1}]}`, http.StatusForbidden},
+		{"get submission", "GET", "/v1/quizzes/space/submission/testUser", "", http.StatusOK},
+		{"start session", "POST", "/v1/quizzes/space/sessions", "", http.StatusCreated},
+		{"start default quiz session", "POST", "/v1/quiz/sessions", "", http.StatusCreated},
+		{"get attempts", "GET", "/v1/quizzes/space/submission/testUser/attempts", "", http.StatusOK},
+		{"get default quiz attempts", "GET", "/v1/quiz/submission/testUser/attempts", "", http.StatusOK},
+		{"get leaderboard", "GET", "/v1/quizzes/space/leaderboard?limit=5&cursor=abc", "", http.StatusOK},
+		{"get default quiz leaderboard", "GET", "/v1/quiz/leaderboard", "", http.StatusOK},
+		{"invalid leaderboard limit", "GET", "/v1/quiz/leaderboard?limit=ten", "", http.StatusBadRequest},
+		{"get daily leaderboard", "GET", "/v1/quizzes/space/leaderboard?period=daily", "", http.StatusOK},
+		{"get leaderboard in range", "GET", "/v1/quizzes/space/leaderboard?from=2024-05-01T00:00:00Z&to=2024-06-01T00:00:00Z", "", http.StatusOK},
+		{"unknown leaderboard period", "GET", "/v1/quiz/leaderboard?period=hourly", "", http.StatusBadRequest},
+		{"leaderboard period and range", "GET", "/v1/quiz/leaderboard?period=daily&from=2024-05-01T00:00:00Z", "", http.StatusBadRequest},
+		{"inverted leaderboard range", "GET", "/v1/quiz/leaderboard?from=2024-06-01T00:00:00Z&to=2024-05-01T00:00:00Z", "", http.StatusBadRequest},
+		{"invalid leaderboard range", "GET", "/v1/quiz/leaderboard?from=yesterday", "", http.StatusBadRequest},
+		{"get leaderboard around user", "GET", "/v1/quizzes/space/leaderboard/around/testUser?neighbours=2", "", http.StatusOK},
+		{"get default quiz leaderboard around user", "GET", "/v1/quiz/leaderboard/around/testUser", "", http.StatusOK},
+		{"get statistics", "GET", "/v1/quizzes/space/statistics", "", http.StatusOK},
+		{"get default quiz monthly statistics", "GET", "/v1/quiz/statistics?period=monthly", "", http.StatusOK},
+		{"unknown statistics period", "GET", "/v1/quiz/statistics?period=yearly", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewReader([]byte(tt.body)))
+			req.Header.Set("Content-Type", "application/json")
+			authorize(t, req)
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatus, resp.Code)
+		})
+	}
+}
+
+func TestUserHandlersRequireAuthentication(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := log.NewForTest()
+	router := setupRouter(mockService, logger)
+
+	expired, _, err := auth.NewTokens([]byte("secret"), -time.Hour).Issue(models.User{ID: "user-1", UserName: "testUser"})
+	assert.NoError(t, err)
+	forged, _, err := auth.NewTokens([]byte("other"), time.Hour).Issue(models.User{ID: "user-1", UserName: "testUser"})
+	assert.NoError(t, err)
+	valid, _, err := tokens.Issue(models.User{ID: "user-1", UserName: "testUser"})
+	assert.NoError(t, err)
+
+	mockService.On("GetUserSubmission", models.DefaultQuizID, "otherUser", models.Window{}).Return(models.GetSubmissionResponse{Score: 1}, nil)
+
+	tests := []struct {
+		name       string
+		method     string
+		url        string
+		token      string
+		wantStatus int
+	}{
+		{"submit without token", "POST", "/v1/quiz/submit", "", http.StatusUnauthorized},
+		{"submit with expired token", "POST", "/v1/quizzes/space/submit", expired, http.StatusUnauthorized},
+		{"submit with forged token", "POST", "/v1/quiz/submit", forged, http.StatusUnauthorized},
+		{"start session without token", "POST", "/v1/quiz/sessions", "", http.StatusUnauthorized},
+		{"get submission without token", "GET", "/v1/quiz/submission/testUser", "", http.StatusUnauthorized},
+		{"get submission of another user", "GET", "/v1/quiz/submission/otherUser", valid, http.StatusForbidden},
+		{"get attempts of another user", "GET", "/v1/quizzes/space/submission/otherUser/attempts", valid, http.StatusForbidden},
+		{"get submission of another user as admin", "GET", "/v1/quiz/submission/otherUser", "admin-secret", http.StatusOK},
+		{"submit as admin", "POST", "/v1/quiz/submit", "admin-secret", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.url, bytes.NewReader([]byte(`{"answers": [{"questionId": 1, "optionId": 1}]}`)))
+			req.Header.Set("Content-Type", "application/json")
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			resp := httptest.NewRecorder()
+
+			router.ServeHTTP(resp, req)
+
+			assert.Equal(t, tt.wantStatus, resp.Code)
+		})
+	}
+	mockService.AssertExpectations(t)
+}
+
+func TestGetSessionHandler(t *testing.T) {
+	mockService := new(MockService)
+	logger, _ := log.NewForTest()
+	router := setupRouter(mockService, logger)
+
+	mockService.On("GetSession", "abc").Return(models.SessionDetails{Session: models.Session{ID: "abc", Seed: 7}, Questions: []models.Question{
+		{ID: 2, Text: "Question 2", Options: []models.Option{{ID: 1, Text: "Option 1", IsCorrect: true}}},
+	}}, nil)
+	mockService.On("GetSession", "unknown").Return(models.SessionDetails{}, storage.ErrSessionNotFound)
+
+	req := httptest.NewRequest("GET", "/v1/admin/quiz/sessions/abc", nil)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"seed":7`)
+	assert.Contains(t, resp.Body.String(), "isCorrect")
+
+	req = httptest.NewRequest("GET", "/v1/admin/quiz/sessions/unknown", nil)
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	mockService.AssertExpectations(t)
+}
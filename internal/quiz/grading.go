@@ -0,0 +1,296 @@
+package quiz
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	apierrors "github.com/courage173/quiz-api/internal/errors"
+	"github.com/courage173/quiz-api/internal/models"
+
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+)
+
+// numericEpsilon absorbs floating point errors when comparing numeric answers
+// to the edge of their tolerance.
+const numericEpsilon = 1e-9
+
+// grader returns the share of the question's points the answer earns, from 0
+// for a wrong answer to 1 for a correct one. It fails if the answer does not
+// carry the kind of value the question type expects.
+type grader func(question models.Question, answer models.Answer) (float64, error)
+
+var graders = map[models.QuestionType]grader{
+	models.QuestionSingleChoice:   gradeSingleChoice,
+	models.QuestionMultipleChoice: gradeMultipleChoice,
+	models.QuestionTrueFalse:      gradeTrueFalse,
+	models.QuestionNumeric:        gradeNumeric,
+	models.QuestionText:           gradeText,
+}
+
+// grading is the outcome of grading a submission.
+type grading struct {
+	Score    float64
+	MaxScore float64
+	// Answered is the number of questions that were answered rather than
+	// skipped.
+	Answered int
+	// Feedback holds the grading of every question, in the order of the
+	// questions.
+	Feedback []models.AnswerFeedback
+}
+
+// gradeAnswers grades the answers to the questions. Questions without answer
+// count as skipped. Answers to questions that are not among questions, to
+// questions answered before and answers with the wrong kind of value are
+// reported together through errors.InvalidInput, keyed by their index.
+func gradeAnswers(questions []models.Question, answers []models.Answer) (grading, error) {
+	byID := make(map[int]models.Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+
+	invalid := validation.Errors{}
+	graded := make(map[int]models.AnswerFeedback, len(answers))
+	for i, answer := range answers {
+		field := fmt.Sprintf("answers[%d]", i)
+		question, exists := byID[answer.QuestionID]
+		if !exists {
+			invalid[field] = fmt.Errorf("question %d is not part of this quiz", answer.QuestionID)
+			continue
+		}
+		if _, seen := graded[answer.QuestionID]; seen {
+			invalid[field] = fmt.Errorf("question %d is answered more than once", answer.QuestionID)
+			continue
+		}
+		if answer.Skipped {
+			graded[answer.QuestionID] = skipped(question)
+			continue
+		}
+
+		feedback, err := grade(question, answer)
+		var answerErr validation.Error
+		if errors.As(err, &answerErr) {
+			invalid[field] = err
+			continue
+		}
+		if err != nil {
+			return grading{}, err
+		}
+		graded[answer.QuestionID] = feedback
+	}
+	if len(invalid) > 0 {
+		return grading{}, apierrors.InvalidInput(invalid)
+	}
+
+	result := grading{Feedback: make([]models.AnswerFeedback, 0, len(questions))}
+	for _, question := range questions {
+		feedback, answered := graded[question.ID]
+		if !answered {
+			feedback = skipped(question)
+		}
+		result.Feedback = append(result.Feedback, feedback)
+		result.MaxScore += feedback.MaxPoints
+		result.Score += feedback.Points
+		if !feedback.Skipped {
+			result.Answered++
+		}
+	}
+	// penalties never take the score below zero
+	result.Score = math.Max(0, math.Round(result.Score*100)/100)
+	return result, nil
+}
+
+// grade grades the answer with the grader of the question's type. A correct
+// answer scores its share of the question's points, a wrong one costs the
+// penalty of the question.
+func grade(question models.Question, answer models.Answer) (models.AnswerFeedback, error) {
+	grader, exists := graders[question.QuestionType()]
+	if !exists {
+		return models.AnswerFeedback{}, fmt.Errorf("question %d has unknown type %q", question.ID, question.Type)
+	}
+	share, err := grader(question, answer)
+	if err != nil {
+		return models.AnswerFeedback{}, err
+	}
+
+	feedback := skipped(question)
+	feedback.Answer = &answer
+	feedback.Skipped = false
+	feedback.Correct = share == 1
+	switch {
+	case share > 0:
+		feedback.Points = share * question.MaxPoints()
+	case question.Penalty > 0:
+		feedback.Points = -question.Penalty
+	}
+	return feedback, nil
+}
+
+// skipped returns the feedback of the question if it is not answered.
+func skipped(question models.Question) models.AnswerFeedback {
+	correct := correctAnswer(question)
+	return models.AnswerFeedback{
+		QuestionID:    question.ID,
+		Skipped:       true,
+		MaxPoints:     question.MaxPoints(),
+		CorrectAnswer: &correct,
+		Explanation:   question.Explanation,
+	}
+}
+
+// correctOption returns the first correct option of a choice question.
+func correctOption(question models.Question) (models.Option, error) {
+	for _, option := range question.Options {
+		if option.IsCorrect {
+			return option, nil
+		}
+	}
+	return models.Option{}, fmt.Errorf("question %d has no correct option", question.ID)
+}
+
+// correctAnswer returns an answer to the question that scores every point.
+// Text questions only accepting a pattern have no such answer beyond the
+// question ID.
+func correctAnswer(question models.Question) models.Answer {
+	answer := models.Answer{QuestionID: question.ID}
+	switch question.QuestionType() {
+	case models.QuestionSingleChoice:
+		if option, err := correctOption(question); err == nil {
+			answer.OptionID = option.ID
+		}
+	case models.QuestionMultipleChoice:
+		answer.OptionIDs = []int{}
+		for _, option := range question.Options {
+			if option.IsCorrect {
+				answer.OptionIDs = append(answer.OptionIDs, option.ID)
+			}
+		}
+	case models.QuestionTrueFalse:
+		if question.IsTrue != nil {
+			isTrue := *question.IsTrue
+			answer.Boolean = &isTrue
+		}
+	case models.QuestionNumeric:
+		if question.NumericKey != nil {
+			value := question.NumericKey.Value
+			answer.Number = &value
+		}
+	case models.QuestionText:
+		if question.TextKey != nil && len(question.TextKey.Accepted) > 0 {
+			text := question.TextKey.Accepted[0]
+			answer.Text = &text
+		}
+	}
+	return answer
+}
+
+// credit converts whether an answer is correct to its share of the points.
+func credit(correct bool) float64 {
+	if correct {
+		return 1
+	}
+	return 0
+}
+
+// invalidAnswer is returned by graders for answers carrying the wrong kind of
+// value, which is the participant's mistake rather than the question's.
+func invalidAnswer(field string) error {
+	return validation.NewError("validation_answer_kind", "must be answered with "+field)
+}
+
+func gradeSingleChoice(question models.Question, answer models.Answer) (float64, error) {
+	if answer.OptionID == 0 {
+		return 0, invalidAnswer("optionId")
+	}
+	correct, err := correctOption(question)
+	if err != nil {
+		return 0, err
+	}
+	return credit(correct.ID == answer.OptionID), nil
+}
+
+// gradeMultipleChoice fully credits answers choosing every correct option and
+// no other. With proportional scoring, every correct option chosen earns its
+// share of the points and every other option chosen takes one back.
+func gradeMultipleChoice(question models.Question, answer models.Answer) (float64, error) {
+	if answer.OptionIDs == nil {
+		return 0, invalidAnswer("optionIds")
+	}
+	chosen := make(map[int]bool, len(answer.OptionIDs))
+	for _, id := range answer.OptionIDs {
+		chosen[id] = true
+	}
+
+	correct, hits := 0, 0
+	for _, option := range question.Options {
+		if option.IsCorrect {
+			correct++
+			if chosen[option.ID] {
+				hits++
+			}
+		}
+	}
+	// options the question does not have count as incorrect ones
+	misses := len(chosen) - hits
+
+	if question.Scoring != models.ScoringProportional {
+		return credit(hits == correct && misses == 0), nil
+	}
+	return math.Max(0, float64(hits-misses)/float64(correct)), nil
+}
+
+func gradeTrueFalse(question models.Question, answer models.Answer) (float64, error) {
+	if answer.Boolean == nil {
+		return 0, invalidAnswer("boolean")
+	}
+	if question.IsTrue == nil {
+		return 0, fmt.Errorf("question %d has no answer key", question.ID)
+	}
+	return credit(*answer.Boolean == *question.IsTrue), nil
+}
+
+func gradeNumeric(question models.Question, answer models.Answer) (float64, error) {
+	if answer.Number == nil {
+		return 0, invalidAnswer("number")
+	}
+	key := question.NumericKey
+	if key == nil {
+		return 0, fmt.Errorf("question %d has no answer key", question.ID)
+	}
+	return credit(math.Abs(*answer.Number-key.Value) <= key.Tolerance+numericEpsilon), nil
+}
+
+func gradeText(question models.Question, answer models.Answer) (float64, error) {
+	if answer.Text == nil {
+		return 0, invalidAnswer("text")
+	}
+	key := question.TextKey
+	if key == nil {
+		return 0, fmt.Errorf("question %d has no answer key", question.ID)
+	}
+
+	text := normalizeText(*answer.Text, key.CaseSensitive)
+	for _, accepted := range key.Accepted {
+		if text == normalizeText(accepted, key.CaseSensitive) {
+			return 1, nil
+		}
+	}
+
+	pattern, err := key.Regexp()
+	if err != nil {
+		return 0, err
+	}
+	return credit(pattern != nil && pattern.MatchString(strings.TrimSpace(*answer.Text))), nil
+}
+
+// normalizeText trims the text and collapses runs of whitespace, and lower
+// cases it unless the comparison is case sensitive.
+func normalizeText(text string, caseSensitive bool) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if !caseSensitive {
+		text = strings.ToLower(text)
+	}
+	return text
+}
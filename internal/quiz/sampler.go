@@ -0,0 +1,46 @@
+package quiz
+
+import (
+	"fmt"
+	mathrand "math/rand"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// draw draws questions out of pool as the blueprint asks, rule by rule. Every
+// rule draws from the questions the earlier rules left, so no question is
+// issued twice. The draw only depends on the seed and the order of pool.
+func draw(blueprint []models.BlueprintRule, pool []models.Question, seed int64) ([]models.Question, error) {
+	rng := mathrand.New(mathrand.NewSource(seed))
+	issued := make(map[int]bool)
+	drawn := make([]models.Question, 0, len(pool))
+	for i, rule := range blueprint {
+		var candidates []models.Question
+		for _, question := range pool {
+			if !issued[question.ID] && rule.Matches(question) {
+				candidates = append(candidates, question)
+			}
+		}
+		if len(candidates) < rule.Count {
+			return nil, fmt.Errorf("blueprint rule %d asks for %d questions but only %d are left to draw from", i+1, rule.Count, len(candidates))
+		}
+
+		rng.Shuffle(len(candidates), func(i, j int) {
+			candidates[i], candidates[j] = candidates[j], candidates[i]
+		})
+		for _, question := range candidates[:rule.Count] {
+			issued[question.ID] = true
+			drawn = append(drawn, question)
+		}
+	}
+	return drawn, nil
+}
+
+// questionIDs returns the IDs of the questions.
+func questionIDs(questions []models.Question) []int {
+	ids := make([]int, 0, len(questions))
+	for _, question := range questions {
+		ids = append(ids, question.ID)
+	}
+	return ids
+}
@@ -1,7 +1,17 @@
 package quiz
 
 import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
 	"fmt"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/errors"
 
 	"github.com/courage173/quiz-api/internal/storage"
 
@@ -11,11 +21,45 @@ import (
 )
 
 type Service interface {
-	SubmitQuiz(submission models.Submission) (models.SubmissionResponse, error)
-	GetQuestions() []models.Question
-	GetUserSubmission(userName string) (models.GetSubmissionResponse, error)
+	GetQuizzes() ([]models.QuizSummary, error)
+	GetQuiz(quizID string) (models.QuizDetails, error)
+	SubmitQuiz(quizID string, submission models.Submission) (models.SubmissionResponse, error)
+	SubmitQuizOnce(quizID, key string, submission models.Submission) (json.RawMessage, bool, error)
+	GetQuestions(quizID string) (models.PublicQuestionSet, error)
+	GetQuestionsWithAnswers(quizID string) (models.QuestionSet, error)
+	GetUserSubmission(quizID, userName string, window models.Window) (models.GetSubmissionResponse, error)
+	GetUserAttempts(quizID, userName string) (models.AttemptsResponse, error)
+	StartSession(quizID, userName string) (models.SessionResponse, error)
+	GetSession(sessionID string) (models.SessionDetails, error)
+	GetLeaderboard(quizID string, window models.Window, limit int, cursor string) (models.Leaderboard, error)
+	GetLeaderboardAround(quizID, userName string, window models.Window, neighbours int) (models.Leaderboard, error)
+	GetStatistics(quizID string, window models.Window) (models.Statistics, error)
 }
 
+const (
+	// DefaultTimeLimit is the duration of sessions of quizzes without a time
+	// limit.
+	DefaultTimeLimit = 30 * time.Minute
+
+	// sessionGracePeriod is added to session deadlines to make up for the
+	// time the submission spends in transit.
+	sessionGracePeriod = 2 * time.Second
+
+	// DefaultLeaderboardLimit is the size of leaderboard pages if no limit is
+	// given, and MaxLeaderboardLimit the largest page that can be asked for.
+	DefaultLeaderboardLimit = 10
+	MaxLeaderboardLimit     = 100
+	// DefaultLeaderboardNeighbours is the number of entries shown before and
+	// after a user on their part of the leaderboard.
+	DefaultLeaderboardNeighbours = 5
+
+	// IdempotencyKeyTTL is how long the response to a submission made with an
+	// idempotency key is returned to retries. idempotencyLockTimeout is how
+	// long a submission in progress holds its key, should it never finish.
+	IdempotencyKeyTTL      = 24 * time.Hour
+	idempotencyLockTimeout = time.Minute
+)
+
 type service struct {
 	storage storage.Storage
 	logger  log.Logger
@@ -28,59 +72,687 @@ func NewService(storage storage.Storage, logger log.Logger) Service {
 	}
 }
 
-func (s service) SubmitQuiz(submission models.Submission) (models.SubmissionResponse, error) {
-	correctCount := 0
+func (s service) GetQuizzes() ([]models.QuizSummary, error) {
+	set, err := s.storage.GetQuestionSet(0)
+	if err != nil {
+		return nil, err
+	}
 
-	totalQuestions := s.storage.Count()
+	quizzes := s.storage.GetQuizzes()
+	summaries := make([]models.QuizSummary, 0, len(quizzes))
+	for _, quiz := range quizzes {
+		questionCount := quiz.BlueprintSize()
+		if len(quiz.Blueprint) == 0 {
+			questionCount = len(quizQuestions(quiz, set.Questions))
+		}
+		summaries = append(summaries, models.QuizSummary{
+			ID:               quiz.ID,
+			Title:            quiz.Title,
+			Description:      quiz.Description,
+			QuestionCount:    questionCount,
+			MaxAttempts:      quiz.MaxAttempts,
+			CooldownSeconds:  quiz.CooldownSeconds,
+			TimeLimitSeconds: quiz.TimeLimitSeconds,
+		})
+	}
+	return summaries, nil
+}
 
-	if totalQuestions != len(submission.Answers) {
-		return models.SubmissionResponse{}, fmt.Errorf("invalid submission: expected %d answers, got %d", totalQuestions, len(submission.Answers))
+func (s service) GetQuiz(quizID string) (models.QuizDetails, error) {
+	quiz, err := s.storage.GetQuiz(quizID)
+	if err != nil {
+		return models.QuizDetails{}, err
 	}
 
-	for _, question := range submission.Answers {
-		correctOption, err := s.storage.GetCorrectOption(question.QuestionID)
-		if err != nil {
-			s.logger.Error("Error getting correct option: ", err)
+	set, err := s.questionSet(quiz, 0)
+	if err != nil {
+		return models.QuizDetails{}, err
+	}
+	questions, err := s.preview(quiz, set.Questions)
+	if err != nil {
+		return models.QuizDetails{}, err
+	}
+
+	return models.QuizDetails{
+		ID:               quiz.ID,
+		Title:            quiz.Title,
+		Description:      quiz.Description,
+		Version:          set.Version,
+		MaxAttempts:      quiz.MaxAttempts,
+		CooldownSeconds:  quiz.CooldownSeconds,
+		TimeLimitSeconds: quiz.TimeLimitSeconds,
+		Questions:        toPublicQuestions(questions),
+	}, nil
+}
+
+func (s service) SubmitQuiz(quizID string, submission models.Submission) (models.SubmissionResponse, error) {
+	quiz, err := s.storage.GetQuiz(quizID)
+	if err != nil {
+		return models.SubmissionResponse{}, err
+	}
+
+	if err := s.checkAttemptLimits(quiz, submission.UserName); err != nil {
+		return models.SubmissionResponse{}, err
+	}
+
+	submittedAt := time.Now().UTC()
+	var session models.Session
+	if submission.SessionID != "" {
+		if session, err = s.checkSession(quiz, submission, submittedAt); err != nil {
 			return models.SubmissionResponse{}, err
 		}
-		if correctOption.ID == question.OptionID {
-			correctCount++
-		}
+	} else if quiz.TimeLimitSeconds > 0 {
+		return models.SubmissionResponse{}, errors.BadRequest("This quiz is timed and can only be submitted within a session")
+	} else if len(quiz.Blueprint) > 0 {
+		return models.SubmissionResponse{}, errors.BadRequest("This quiz draws its questions at random and can only be submitted within a session")
 	}
 
-	result := &models.Result{UserName: submission.UserName, Score: correctCount, TotalQuestionAnswered: totalQuestions}
+	// grade against the version the participant was shown, even if the
+	// questions have been reloaded since
+	var set models.QuestionSet
+	if session.ID != "" {
+		set, err = s.sessionQuestionSet(quiz, session)
+	} else {
+		set, err = s.questionSet(quiz, submission.Version)
+	}
+	if err != nil {
+		s.logger.Error("Error getting question set: ", err)
+		return models.SubmissionResponse{}, err
+	}
 
-	s.storage.AddUserSubmission(*result)
+	graded, err := gradeAnswers(set.Questions, submission.Answers)
+	if err != nil {
+		return models.SubmissionResponse{}, err
+	}
+	feedback := quiz.Feedback
+	if session.Feedback != "" {
+		feedback = session.Feedback
+	}
+
+	result := models.Result{
+		QuizID:                quizID,
+		UserName:              submission.UserName,
+		UserID:                submission.UserID,
+		Score:                 graded.Score,
+		MaxScore:              graded.MaxScore,
+		Percentage:            models.Percentage(graded.Score, graded.MaxScore),
+		TotalQuestionAnswered: graded.Answered,
+		SubmittedAt:           submittedAt,
+	}
+	// the limits were checked above, but only the storage can enforce them
+	// against concurrent submissions
+	limits := storage.AttemptLimits{
+		MaxAttempts: quiz.MaxAttempts,
+		Cooldown:    time.Duration(quiz.CooldownSeconds) * time.Second,
+	}
+	if session.ID != "" {
+		// the session is finished with the attempt, so that it cannot be
+		// submitted twice but stays open if the attempt is rejected
+		result.ElapsedMillis = submittedAt.Sub(session.StartedAt).Milliseconds()
+		result, err = s.storage.AddSessionSubmission(session.ID, result, limits)
+	} else {
+		result, err = s.storage.AddLimitedSubmission(result, limits)
+	}
+	if stderrors.Is(err, storage.ErrSessionFinished) {
+		return models.SubmissionResponse{}, errors.Forbidden("The session has already been submitted")
+	}
+	if stderrors.Is(err, storage.ErrNoAttemptsLeft) || stderrors.Is(err, storage.ErrCoolingDown) {
+		if limitErr := s.checkAttemptLimits(quiz, submission.UserName); limitErr != nil {
+			return models.SubmissionResponse{}, limitErr
+		}
+		return models.SubmissionResponse{}, errors.Forbidden("You cannot try this quiz again yet")
+	}
+	if err != nil {
+		s.logger.Error("Error saving submission: ", err)
+		return models.SubmissionResponse{}, err
+	}
 
-	message := fmt.Sprintf("You got %d questions out of %d", result.Score, totalQuestions)
+	message := fmt.Sprintf("You scored %g out of %g points, answering %d of %d questions", result.Score, result.MaxScore, result.TotalQuestionAnswered, len(set.Questions))
 
 	return models.SubmissionResponse{
 		Message:               message,
+		Attempt:               result.Attempt,
 		Score:                 result.Score,
-		TotalQuestionAnswered: totalQuestions,
+		MaxScore:              result.MaxScore,
+		Percentage:            result.Percentage,
+		TotalQuestionAnswered: result.TotalQuestionAnswered,
+		QuestionCount:         len(set.Questions),
+		ElapsedMillis:         result.ElapsedMillis,
+		Answers:               answerFeedback(feedback, graded.Feedback),
 	}, nil
 }
 
-func (s service) GetUserSubmission(userName string) (models.GetSubmissionResponse, error) {
-	submission, err := s.storage.GetUserSubmission(userName)
+// SubmitQuizOnce submits the quiz like SubmitQuiz, but only once per key and
+// user. It returns the JSON encoded response and whether it is the response
+// of an earlier submission with the key, which is returned as it is, without
+// grading again, for IdempotencyKeyTTL. Reusing the key for a different
+// submission is rejected, as are retries while the first submission is in
+// progress. Submissions that fail free the key to be retried.
+func (s service) SubmitQuizOnce(quizID, key string, submission models.Submission) (json.RawMessage, bool, error) {
+	fingerprint, err := json.Marshal(submission)
+	if err != nil {
+		return nil, false, err
+	}
+	sum := sha256.Sum256(fingerprint)
+
+	now := time.Now().UTC()
+	record := models.IdempotencyRecord{
+		// keys are scoped to the user and quiz so that they cannot be used
+		// to read the responses of others
+		Key:         submission.UserID + "/" + quizID + "/" + key,
+		Fingerprint: hex.EncodeToString(sum[:]),
+		ExpiresAt:   now.Add(idempotencyLockTimeout),
+	}
+	existing, err := s.storage.ReserveIdempotencyKey(record, now)
+	if stderrors.Is(err, storage.ErrIdempotencyKeyUsed) {
+		switch {
+		case existing.Fingerprint != record.Fingerprint:
+			return nil, false, errors.UnprocessableEntity("The idempotency key was used for a different submission")
+		case len(existing.Response) == 0:
+			return nil, false, errors.Conflict("A submission with this idempotency key is in progress")
+		}
+		return existing.Response, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	response, err := s.SubmitQuiz(quizID, submission)
+	if err != nil {
+		if err := s.storage.ReleaseIdempotencyKey(record.Key); err != nil {
+			s.logger.Error("Error releasing idempotency key: ", err)
+		}
+		return nil, false, err
+	}
+
+	// encoded as the JSON data writer does, so that the response does not
+	// change when it is returned again
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(response); err != nil {
+		return nil, false, err
+	}
+	encoded := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if err := s.storage.CompleteIdempotencyKey(record.Key, encoded, time.Now().UTC().Add(IdempotencyKeyTTL)); err != nil {
+		s.logger.Error("Error saving idempotent response: ", err)
+	}
+	return encoded, false, nil
+}
+
+// answerFeedback returns as much of the per-answer feedback as the feedback
+// policy of the quiz reveals.
+func answerFeedback(policy models.Feedback, feedback []models.AnswerFeedback) []models.AnswerFeedback {
+	switch policy {
+	case models.FeedbackFull:
+		return feedback
+	case models.FeedbackResults:
+		results := make([]models.AnswerFeedback, len(feedback))
+		for i, answer := range feedback {
+			answer.CorrectAnswer = nil
+			answer.Explanation = ""
+			results[i] = answer
+		}
+		return results
+	default:
+		return nil
+	}
+}
+
+// StartSession starts a timed session of the quiz for the user on the current
+// question set.
+func (s service) StartSession(quizID, userName string) (models.SessionResponse, error) {
+	quiz, err := s.storage.GetQuiz(quizID)
+	if err != nil {
+		return models.SessionResponse{}, err
+	}
+
+	if err := s.checkAttemptLimits(quiz, userName); err != nil {
+		return models.SessionResponse{}, err
+	}
+
+	set, err := s.questionSet(quiz, 0)
+	if err != nil {
+		return models.SessionResponse{}, err
+	}
+
+	id, err := newSessionID()
+	if err != nil {
+		return models.SessionResponse{}, err
+	}
+	seed, err := newSeed()
+	if err != nil {
+		return models.SessionResponse{}, err
+	}
+	if len(quiz.Blueprint) > 0 {
+		questions, err := draw(quiz.Blueprint, set.Questions, seed)
+		if err != nil {
+			s.logger.Errorf("Error drawing the questions of quiz %s: %v", quiz.ID, err)
+			return models.SessionResponse{}, errors.InternalServerError("")
+		}
+		set.Questions = questions
+	}
+	feedback := quiz.Feedback
+	if feedback == "" {
+		feedback = models.FeedbackNone
+	}
+
+	timeLimit := DefaultTimeLimit
+	if quiz.TimeLimitSeconds > 0 {
+		timeLimit = time.Duration(quiz.TimeLimitSeconds) * time.Second
+	}
+	startedAt := time.Now().UTC()
+	session := models.Session{
+		ID:               id,
+		QuizID:           quiz.ID,
+		UserName:         userName,
+		Version:          set.Version,
+		StartedAt:        startedAt,
+		Deadline:         startedAt.Add(timeLimit),
+		Seed:             seed,
+		ShuffleQuestions: quiz.ShuffleQuestions,
+		ShuffleOptions:   quiz.ShuffleOptions,
+		QuestionIDs:      questionIDs(set.Questions),
+		Feedback:         feedback,
+	}
+	if err := s.storage.CreateSession(session); err != nil {
+		s.logger.Error("Error creating session: ", err)
+		return models.SessionResponse{}, err
+	}
+
+	return models.SessionResponse{Session: session, Questions: toPublicQuestions(shuffle(set.Questions, session))}, nil
+}
+
+// GetSession returns the session with the questions in the order they were
+// shown to the user.
+func (s service) GetSession(sessionID string) (models.SessionDetails, error) {
+	session, err := s.storage.GetSession(sessionID)
+	if err != nil {
+		return models.SessionDetails{}, err
+	}
+
+	quiz, err := s.storage.GetQuiz(session.QuizID)
+	if err != nil {
+		return models.SessionDetails{}, err
+	}
+
+	set, err := s.sessionQuestionSet(quiz, session)
+	if err != nil {
+		return models.SessionDetails{}, err
+	}
+	return models.SessionDetails{Session: session, Questions: set.Questions}, nil
+}
+
+// sessionQuestionSet returns the questions of the session in the order it
+// showed them.
+func (s service) sessionQuestionSet(quiz models.Quiz, session models.Session) (models.QuestionSet, error) {
+	set, err := s.storage.GetQuestionSet(session.Version)
+	if err != nil {
+		return models.QuestionSet{}, err
+	}
+
+	if len(session.QuestionIDs) > 0 {
+		// the questions of the session count even if the quiz changed since
+		set.Questions = pickQuestions(session.QuestionIDs, set.Questions)
+	} else {
+		// sessions started before their questions were recorded
+		set.Questions = quizQuestions(quiz, set.Questions)
+	}
+	set.Questions = shuffle(set.Questions, session)
+	return set, nil
+}
+
+// preview returns the questions of the quiz as shown outside of sessions.
+// Quizzes with a blueprint show a fresh draw that is not recorded anywhere.
+func (s service) preview(quiz models.Quiz, questions []models.Question) ([]models.Question, error) {
+	if len(quiz.Blueprint) == 0 {
+		return questions, nil
+	}
+
+	seed, err := newSeed()
+	if err != nil {
+		return nil, err
+	}
+	drawn, err := draw(quiz.Blueprint, questions, seed)
+	if err != nil {
+		s.logger.Errorf("Error drawing the questions of quiz %s: %v", quiz.ID, err)
+		return nil, errors.InternalServerError("")
+	}
+	return drawn, nil
+}
+
+// checkSession returns the session of the submission if it may still be
+// submitted.
+func (s service) checkSession(quiz models.Quiz, submission models.Submission, submittedAt time.Time) (models.Session, error) {
+	session, err := s.storage.GetSession(submission.SessionID)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	switch {
+	case session.QuizID != quiz.ID || session.UserName != submission.UserName:
+		return models.Session{}, errors.Forbidden("The session belongs to another quiz or user")
+	case session.FinishedAt != nil:
+		return models.Session{}, errors.Forbidden("The session has already been submitted")
+	case submittedAt.After(session.Deadline.Add(sessionGracePeriod)):
+		return models.Session{}, errors.Forbidden(fmt.Sprintf("The session ended at %s", session.Deadline.Format(time.RFC3339)))
+	}
+	return session, nil
+}
+
+// newSessionID returns a random, unguessable session ID.
+func newSessionID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
+
+// checkAttemptLimits rejects the submission if the user used up the attempts
+// of the quiz or is still cooling down from the previous attempt.
+func (s service) checkAttemptLimits(quiz models.Quiz, userName string) error {
+	if quiz.MaxAttempts == 0 && quiz.CooldownSeconds == 0 {
+		return nil
+	}
 
+	attempts, err := s.storage.GetUserAttempts(quiz.ID, userName)
+	if stderrors.Is(err, storage.ErrSubmissionNotFound) {
+		return nil
+	}
 	if err != nil {
+		return err
+	}
+
+	if quiz.MaxAttempts > 0 && len(attempts) >= quiz.MaxAttempts {
+		return errors.Forbidden(fmt.Sprintf("You have used all %d attempts of this quiz", quiz.MaxAttempts))
+	}
+
+	cooldown := time.Duration(quiz.CooldownSeconds) * time.Second
+	wait := attempts[len(attempts)-1].SubmittedAt.Add(cooldown).Sub(time.Now())
+	if wait > 0 {
+		return errors.Forbidden(fmt.Sprintf("You can try this quiz again in %s", wait.Round(time.Second)))
+	}
+	return nil
+}
+
+// GetUserSubmission returns the ranked attempt of the user among the attempts
+// submitted in the window, and how it compares to the other users' attempts
+// in the window.
+func (s service) GetUserSubmission(quizID, userName string, window models.Window) (models.GetSubmissionResponse, error) {
+	if _, err := s.storage.GetQuiz(quizID); err != nil {
 		return models.GetSubmissionResponse{}, err
 	}
 
-	scoreRankPercentage := s.storage.CalculateScoreRankPercentage(submission.Score)
-	formattedValue := fmt.Sprintf("%.2f%%", scoreRankPercentage)
+	submission, err := s.rankedAttempt(quizID, userName, window)
+
+	if err != nil {
+		return models.GetSubmissionResponse{}, err
+	}
+
+	standing, err := s.storage.GetStanding(quizID, window, submission.Percentage)
+	if err != nil {
+		return models.GetSubmissionResponse{}, err
+	}
+	percentile := standing.Percentile()
+	formattedValue := fmt.Sprintf("%.2f%%", percentile)
 
 	message := fmt.Sprintf("You were better than %s of all quizzers", formattedValue)
 
 	return models.GetSubmissionResponse{
 		Message:               message,
+		Attempt:               submission.Attempt,
 		Score:                 submission.Score,
+		MaxScore:              submission.MaxScore,
+		Percentage:            submission.Percentage,
 		Rank:                  formattedValue,
+		Position:              standing.Rank,
+		Participants:          standing.Participants,
+		Percentile:            percentile,
 		TotalQuestionAnswered: submission.TotalQuestionAnswered,
+		ElapsedMillis:         submission.ElapsedMillis,
 	}, nil
 }
 
-func (s service) GetQuestions() []models.Question {
-	return s.storage.GetQuestions()
+// rankedAttempt returns the attempt of the user that counts toward the
+// ranking of the quiz in the window.
+func (s service) rankedAttempt(quizID, userName string, window models.Window) (models.Result, error) {
+	if window.AllTime() {
+		return s.storage.GetUserSubmission(quizID, userName)
+	}
+
+	attempts, err := s.storage.GetUserAttempts(quizID, userName)
+	if err != nil {
+		return models.Result{}, err
+	}
+	var inWindow []models.Result
+	for _, attempt := range attempts {
+		if window.Contains(attempt.SubmittedAt) {
+			inWindow = append(inWindow, attempt)
+		}
+	}
+	if len(inWindow) == 0 {
+		return models.Result{}, storage.ErrSubmissionNotFound
+	}
+	return s.storage.RankingPolicy().RankedAttempt(inWindow), nil
+}
+
+func (s service) GetUserAttempts(quizID, userName string) (models.AttemptsResponse, error) {
+	if _, err := s.storage.GetQuiz(quizID); err != nil {
+		return models.AttemptsResponse{}, err
+	}
+
+	attempts, err := s.storage.GetUserAttempts(quizID, userName)
+	if err != nil {
+		return models.AttemptsResponse{}, err
+	}
+
+	ranked, err := s.storage.GetUserSubmission(quizID, userName)
+	if err != nil {
+		return models.AttemptsResponse{}, err
+	}
+
+	return models.AttemptsResponse{
+		UserName:      userName,
+		RankingPolicy: string(s.storage.RankingPolicy()),
+		RankedAttempt: ranked.Attempt,
+		Attempts:      attempts,
+	}, nil
+}
+
+// GetLeaderboard returns a page of the leaderboard of the quiz in the window,
+// starting after the entry the cursor points to, or from the top if it is
+// empty.
+func (s service) GetLeaderboard(quizID string, window models.Window, limit int, cursor string) (models.Leaderboard, error) {
+	if _, err := s.storage.GetQuiz(quizID); err != nil {
+		return models.Leaderboard{}, err
+	}
+	if limit == 0 {
+		limit = DefaultLeaderboardLimit
+	}
+	if limit < 0 || limit > MaxLeaderboardLimit {
+		return models.Leaderboard{}, errors.BadRequest(fmt.Sprintf("The limit must be between 1 and %d", MaxLeaderboardLimit))
+	}
+
+	var after *models.LeaderboardCursor
+	if cursor != "" {
+		decoded, err := decodeCursor(cursor)
+		if err != nil {
+			return models.Leaderboard{}, errors.BadRequest("The cursor is invalid")
+		}
+		after = &decoded
+	}
+
+	// one more entry than asked for tells whether there is a next page
+	entries, err := s.storage.GetLeaderboard(quizID, window, after, limit+1)
+	if err != nil {
+		return models.Leaderboard{}, err
+	}
+
+	leaderboard := newLeaderboard(quizID, window, entries)
+	if len(entries) > limit {
+		leaderboard.Entries = entries[:limit]
+		last := entries[limit-1]
+		leaderboard.NextCursor = encodeCursor(models.LeaderboardCursor{Percentage: last.Percentage, ElapsedMillis: last.ElapsedMillis, UserName: last.UserName})
+	}
+	return leaderboard, nil
+}
+
+// GetLeaderboardAround returns the part of the leaderboard of the quiz in the
+// window around the user.
+func (s service) GetLeaderboardAround(quizID, userName string, window models.Window, neighbours int) (models.Leaderboard, error) {
+	if _, err := s.storage.GetQuiz(quizID); err != nil {
+		return models.Leaderboard{}, err
+	}
+	if neighbours == 0 {
+		neighbours = DefaultLeaderboardNeighbours
+	}
+	if neighbours < 0 || neighbours > MaxLeaderboardLimit/2 {
+		return models.Leaderboard{}, errors.BadRequest(fmt.Sprintf("The neighbours must be between 1 and %d", MaxLeaderboardLimit/2))
+	}
+
+	entries, err := s.storage.GetLeaderboardAround(quizID, userName, window, neighbours)
+	if err != nil {
+		return models.Leaderboard{}, err
+	}
+	return newLeaderboard(quizID, window, entries), nil
+}
+
+// GetStatistics summarises the percentages the users ranked in the window
+// scored at the quiz.
+func (s service) GetStatistics(quizID string, window models.Window) (models.Statistics, error) {
+	if _, err := s.storage.GetQuiz(quizID); err != nil {
+		return models.Statistics{}, err
+	}
+
+	percentages, err := s.storage.GetRankedPercentages(quizID, window)
+	if err != nil {
+		return models.Statistics{}, err
+	}
+
+	statistics := summarise(percentages)
+	statistics.QuizID = quizID
+	if !window.From.IsZero() {
+		statistics.From = &window.From
+	}
+	if !window.To.IsZero() {
+		statistics.To = &window.To
+	}
+	return statistics, nil
+}
+
+func newLeaderboard(quizID string, window models.Window, entries []models.LeaderboardEntry) models.Leaderboard {
+	leaderboard := models.Leaderboard{QuizID: quizID, Entries: entries}
+	if !window.From.IsZero() {
+		leaderboard.From = &window.From
+	}
+	if !window.To.IsZero() {
+		leaderboard.To = &window.To
+	}
+	return leaderboard
+}
+
+func (s service) GetQuestions(quizID string) (models.PublicQuestionSet, error) {
+	quiz, err := s.storage.GetQuiz(quizID)
+	if err != nil {
+		return models.PublicQuestionSet{}, err
+	}
+	set, err := s.questionSet(quiz, 0)
+	if err != nil {
+		return models.PublicQuestionSet{}, err
+	}
+	questions, err := s.preview(quiz, set.Questions)
+	if err != nil {
+		return models.PublicQuestionSet{}, err
+	}
+	return models.PublicQuestionSet{Version: set.Version, Questions: toPublicQuestions(questions)}, nil
+}
+
+func (s service) GetQuestionsWithAnswers(quizID string) (models.QuestionSet, error) {
+	return s.getQuestionSet(quizID, 0)
+}
+
+// getQuestionSet returns the questions of the quiz from the question set of
+// the given version, or the current one if version is 0.
+func (s service) getQuestionSet(quizID string, version int) (models.QuestionSet, error) {
+	quiz, err := s.storage.GetQuiz(quizID)
+	if err != nil {
+		return models.QuestionSet{}, err
+	}
+	return s.questionSet(quiz, version)
+}
+
+func (s service) questionSet(quiz models.Quiz, version int) (models.QuestionSet, error) {
+	set, err := s.storage.GetQuestionSet(version)
+	if err != nil {
+		return models.QuestionSet{}, err
+	}
+
+	set.Questions = quizQuestions(quiz, set.Questions)
+	return set, nil
+}
+
+// quizQuestions picks the questions of the quiz out of questions, in the order
+// the quiz lists them. Questions the quiz lists but questions lacks are
+// skipped.
+func quizQuestions(quiz models.Quiz, questions []models.Question) []models.Question {
+	if len(quiz.QuestionIDs) == 0 {
+		return questions
+	}
+	return pickQuestions(quiz.QuestionIDs, questions)
+}
+
+// pickQuestions picks the questions with the given IDs out of questions, in
+// the order of ids. IDs questions lacks are skipped.
+func pickQuestions(ids []int, questions []models.Question) []models.Question {
+	byID := make(map[int]models.Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+
+	picked := make([]models.Question, 0, len(ids))
+	for _, id := range ids {
+		if question, exists := byID[id]; exists {
+			picked = append(picked, question)
+		}
+	}
+	return picked
+}
+
+// toPublicQuestions strips the answer key from the given questions so they can
+// be sent to participants.
+func toPublicQuestions(questions []models.Question) []models.PublicQuestion {
+	public := make([]models.PublicQuestion, 0, len(questions))
+	for _, question := range questions {
+		options := make([]models.PublicOption, 0, len(question.Options))
+		for _, option := range question.Options {
+			options = append(options, models.PublicOption{ID: option.ID, Text: option.Text})
+		}
+		public = append(public, models.PublicQuestion{
+			ID:      question.ID,
+			Type:    question.QuestionType(),
+			Text:    question.Text,
+			Options: options,
+		})
+	}
+	return public
+}
+
+// encodeCursor returns the opaque form of the leaderboard cursor handed out
+// to clients.
+func encodeCursor(cursor models.LeaderboardCursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string) (models.LeaderboardCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return models.LeaderboardCursor{}, err
+	}
+	var decoded models.LeaderboardCursor
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return models.LeaderboardCursor{}, err
+	}
+	return decoded, nil
 }
@@ -1,14 +1,24 @@
 package quiz_test
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	apierrors "github.com/courage173/quiz-api/internal/errors"
 	"github.com/courage173/quiz-api/internal/models"
 	"github.com/courage173/quiz-api/internal/quiz"
+	"github.com/courage173/quiz-api/internal/storage"
 	"github.com/courage173/quiz-api/pkg/log"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // MockStorage is a mock implementation of the storage interface for testing
@@ -16,38 +26,233 @@ type MockStorage struct {
 	mock.Mock
 }
 
-func (m *MockStorage) Count() int {
+func (m *MockStorage) GetQuestions() []models.Question {
 	args := m.Called()
-	return args.Int(0)
+	return args.Get(0).([]models.Question)
 }
 
-func (m *MockStorage) GetCorrectOption(questionID int) (models.Option, error) {
-	args := m.Called(questionID)
-	return args.Get(0).(models.Option), args.Error(1)
+func (m *MockStorage) GetSubmissions() []models.Result {
+	args := m.Called()
+	return args.Get(0).([]models.Result)
 }
 
-func (m *MockStorage) GetQuestions() []models.Question {
+// AddUserSubmission returns the result with the attempt number it was mocked
+// with.
+func (m *MockStorage) AddUserSubmission(result models.Result) (models.Result, error) {
+	args := m.Called(result)
+	result.Attempt = args.Int(0)
+	return result, args.Error(1)
+}
+
+// AddLimitedSubmission returns the result with the attempt number it was
+// mocked with.
+func (m *MockStorage) AddLimitedSubmission(result models.Result, limits storage.AttemptLimits) (models.Result, error) {
+	args := m.Called(result, limits)
+	result.Attempt = args.Int(0)
+	return result, args.Error(1)
+}
+
+func (m *MockStorage) GetUserAttempts(quizID, userName string) ([]models.Result, error) {
+	args := m.Called(quizID, userName)
+	return args.Get(0).([]models.Result), args.Error(1)
+}
+
+func (m *MockStorage) RankingPolicy() storage.RankingPolicy {
 	args := m.Called()
-	return args.Get(0).([]models.Question)
+	return args.Get(0).(storage.RankingPolicy)
 }
 
-func (m *MockStorage) GetSubmissions() []models.Result {
+func (m *MockStorage) GetUserSubmission(quizID, userName string) (models.Result, error) {
+	args := m.Called(quizID, userName)
+	return args.Get(0).(models.Result), args.Error(1)
+}
+
+func (m *MockStorage) GetQuestionSet(version int) (models.QuestionSet, error) {
+	args := m.Called(version)
+	return args.Get(0).(models.QuestionSet), args.Error(1)
+}
+
+func (m *MockStorage) SetQuestions(questions []models.Question) (int, error) {
+	args := m.Called(questions)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockStorage) GetQuestion(id int) (models.Question, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Question), args.Error(1)
+}
+
+func (m *MockStorage) CreateQuestion(question models.Question) (models.Question, error) {
+	args := m.Called(question)
+	return args.Get(0).(models.Question), args.Error(1)
+}
+
+func (m *MockStorage) UpdateQuestion(question models.Question) error {
+	args := m.Called(question)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ModifyQuestion(id int, fn func(question models.Question) (models.Question, error)) (models.Question, error) {
+	args := m.Called(id, fn)
+	return args.Get(0).(models.Question), args.Error(1)
+}
+
+func (m *MockStorage) DeleteQuestion(id int) error {
+	args := m.Called(id)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ReorderQuestions(ids []int) error {
+	args := m.Called(ids)
+	return args.Error(0)
+}
+
+func (m *MockStorage) CreateSession(session models.Session) error {
+	args := m.Called(session)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetSession(id string) (models.Session, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Session), args.Error(1)
+}
+
+// AddSessionSubmission returns the result with the attempt number it was
+// mocked with.
+func (m *MockStorage) AddSessionSubmission(sessionID string, result models.Result, limits storage.AttemptLimits) (models.Result, error) {
+	args := m.Called(sessionID, result, limits)
+	result.Attempt = args.Int(0)
+	return result, args.Error(1)
+}
+
+func (m *MockStorage) GetStanding(quizID string, window models.Window, percentage float64) (models.Standing, error) {
+	args := m.Called(quizID, window, percentage)
+	return args.Get(0).(models.Standing), args.Error(1)
+}
+
+func (m *MockStorage) GetRankedPercentages(quizID string, window models.Window) ([]float64, error) {
+	args := m.Called(quizID, window)
+	return args.Get(0).([]float64), args.Error(1)
+}
+
+func (m *MockStorage) GetLeaderboard(quizID string, window models.Window, after *models.LeaderboardCursor, limit int) ([]models.LeaderboardEntry, error) {
+	args := m.Called(quizID, window, after, limit)
+	return args.Get(0).([]models.LeaderboardEntry), args.Error(1)
+}
+
+func (m *MockStorage) GetLeaderboardAround(quizID, userName string, window models.Window, neighbours int) ([]models.LeaderboardEntry, error) {
+	args := m.Called(quizID, userName, window, neighbours)
+	return args.Get(0).([]models.LeaderboardEntry), args.Error(1)
+}
+
+func (m *MockStorage) GetTeams() ([]models.Team, error) {
 	args := m.Called()
-	return args.Get(0).([]models.Result)
+	return args.Get(0).([]models.Team), args.Error(1)
+}
+
+func (m *MockStorage) GetTeam(id string) (models.Team, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.Team), args.Error(1)
+}
+
+func (m *MockStorage) CreateTeam(team models.Team) error {
+	args := m.Called(team)
+	return args.Error(0)
 }
 
-func (m *MockStorage) AddUserSubmission(result models.Result) {
-	m.Called(result)
+func (m *MockStorage) DeleteTeam(id string) error {
+	args := m.Called(id)
+	return args.Error(0)
 }
 
-func (m *MockStorage) GetUserSubmission(userName string) (models.Result, error) {
+func (m *MockStorage) AddTeamMember(teamID, userName string) error {
+	args := m.Called(teamID, userName)
+	return args.Error(0)
+}
+
+func (m *MockStorage) RemoveTeamMember(teamID, userName string) error {
+	args := m.Called(teamID, userName)
+	return args.Error(0)
+}
+
+func (m *MockStorage) CreateUser(user models.User) error {
+	args := m.Called(user)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetUsers() ([]models.User, error) {
+	args := m.Called()
+	return args.Get(0).([]models.User), args.Error(1)
+}
+
+func (m *MockStorage) SetUserRole(id string, role models.Role) error {
+	args := m.Called(id, role)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetUser(id string) (models.User, error) {
+	args := m.Called(id)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockStorage) GetUserByName(userName string) (models.User, error) {
 	args := m.Called(userName)
-	return args.Get(0).(models.Result), args.Error(1)
+	return args.Get(0).(models.User), args.Error(1)
+}
+
+func (m *MockStorage) CreateAPIKey(key models.APIKey) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetAPIKeys() ([]models.APIKey, error) {
+	args := m.Called()
+	return args.Get(0).([]models.APIKey), args.Error(1)
+}
+
+func (m *MockStorage) GetAPIKeyByHash(hash string) (models.APIKey, error) {
+	args := m.Called(hash)
+	return args.Get(0).(models.APIKey), args.Error(1)
+}
+
+func (m *MockStorage) RevokeAPIKey(id string, at time.Time) error {
+	args := m.Called(id, at)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ReserveIdempotencyKey(record models.IdempotencyRecord, now time.Time) (models.IdempotencyRecord, error) {
+	args := m.Called(record, now)
+	return args.Get(0).(models.IdempotencyRecord), args.Error(1)
+}
+
+func (m *MockStorage) CompleteIdempotencyKey(key string, response []byte, expiresAt time.Time) error {
+	args := m.Called(key, response, expiresAt)
+	return args.Error(0)
+}
+
+func (m *MockStorage) ReleaseIdempotencyKey(key string) error {
+	args := m.Called(key)
+	return args.Error(0)
+}
+
+func (m *MockStorage) GetQuizzes() []models.Quiz {
+	args := m.Called()
+	return args.Get(0).([]models.Quiz)
+}
+
+func (m *MockStorage) GetQuiz(quizID string) (models.Quiz, error) {
+	args := m.Called(quizID)
+	return args.Get(0).(models.Quiz), args.Error(1)
+}
+
+func (m *MockStorage) SetQuizzes(quizzes []models.Quiz) error {
+	args := m.Called(quizzes)
+	return args.Error(0)
 }
 
-func (m *MockStorage) CalculateScoreRankPercentage(score int) float64 {
-	args := m.Called(score)
-	return args.Get(0).(float64)
+func (m *MockStorage) SetQuestionBank(questions []models.Question, quizzes []models.Quiz) (int, error) {
+	args := m.Called(questions, quizzes)
+	return args.Int(0), args.Error(1)
 }
 
 // MockLogger is a mock implementation of the logger interface
@@ -59,16 +264,28 @@ func (m *MockLogger) Error(args ...interface{}) {
 	m.Called(args...)
 }
 
+func questionSet(version int, correctOptions ...int) models.QuestionSet {
+	set := models.QuestionSet{Version: version}
+	for i, correct := range correctOptions {
+		question := models.Question{ID: i + 1, Text: fmt.Sprintf("Question %d", i+1)}
+		for id := 1; id <= 4; id++ {
+			question.Options = append(question.Options, models.Option{ID: id, Text: fmt.Sprintf("Option %d", id), IsCorrect: id == correct})
+		}
+		set.Questions = append(set.Questions, question)
+	}
+	return set
+}
+
 func TestSubmitQuiz(t *testing.T) {
 	t.Run("valid submission", func(t *testing.T) {
 		mockStorage := new(MockStorage)
 		logger, _ := log.NewForTest()
 		service := quiz.NewService(mockStorage, logger)
 
-		mockStorage.On("Count").Return(2)
-		mockStorage.On("GetCorrectOption", 1).Return(models.Option{ID: 2}, nil)
-		mockStorage.On("GetCorrectOption", 2).Return(models.Option{ID: 3}, nil)
-		mockStorage.On("AddUserSubmission", mock.Anything).Return()
+		mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+
+		mockStorage.On("GetQuestionSet", 0).Return(questionSet(1, 2, 3), nil)
+		mockStorage.On("AddLimitedSubmission", mock.Anything, mock.Anything).Return(1, nil)
 
 		submission := models.Submission{
 			UserName: "Charlie",
@@ -78,43 +295,114 @@ func TestSubmitQuiz(t *testing.T) {
 			},
 		}
 
-		response, err := service.SubmitQuiz(submission)
+		response, err := service.SubmitQuiz(models.DefaultQuizID, submission)
 
 		assert.NoError(t, err)
-		assert.Equal(t, "You got 2 questions out of 2", response.Message)
-		assert.Equal(t, 2, response.Score)
+		assert.Equal(t, "You scored 2 out of 2 points, answering 2 of 2 questions", response.Message)
+		assert.Equal(t, 1, response.Attempt)
+		assert.Equal(t, 2.0, response.Score)
+		assert.Equal(t, 100.0, response.Percentage)
 		assert.Equal(t, 2, response.TotalQuestionAnswered)
 	})
 
-	t.Run("invalid submission with fewer answers", func(t *testing.T) {
+	t.Run("partial submission", func(t *testing.T) {
 		mockStorage := new(MockStorage)
 		logger, _ := log.NewForTest()
 		service := quiz.NewService(mockStorage, logger)
 
-		mockStorage.On("Count").Return(3)
+		mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
 
+		mockStorage.On("GetQuestionSet", 0).Return(questionSet(1, 2, 3, 4), nil)
+		mockStorage.On("AddLimitedSubmission", mock.Anything, mock.Anything).Return(1, nil)
+
+		// question 2 is skipped explicitly and question 3 by leaving it out
 		submission := models.Submission{
 			UserName: "Charlie",
 			Answers: []models.Answer{
 				{QuestionID: 1, OptionID: 2},
-				{QuestionID: 2, OptionID: 3},
+				{QuestionID: 2, Skipped: true},
 			},
 		}
 
-		_, err := service.SubmitQuiz(submission)
+		response, err := service.SubmitQuiz(models.DefaultQuizID, submission)
 
-		assert.Error(t, err)
-		assert.EqualError(t, err, "invalid submission: expected 3 answers, got 2")
+		require.NoError(t, err)
+		assert.Equal(t, "You scored 1 out of 3 points, answering 1 of 3 questions", response.Message)
+		assert.Equal(t, 1, response.TotalQuestionAnswered)
+		assert.Equal(t, 3, response.QuestionCount)
+		mockStorage.AssertCalled(t, "AddLimitedSubmission", mock.MatchedBy(func(result models.Result) bool {
+			return result.TotalQuestionAnswered == 1 && result.Score == 1 && result.MaxScore == 3
+		}), mock.Anything)
+	})
+
+	t.Run("graded against the submitted version", func(t *testing.T) {
+		mockStorage := new(MockStorage)
+		logger, _ := log.NewForTest()
+		service := quiz.NewService(mockStorage, logger)
+
+		mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+
+		// version 1 is still being answered although version 2 is current
+		mockStorage.On("GetQuestionSet", 1).Return(questionSet(1, 2, 3), nil)
+		mockStorage.On("AddLimitedSubmission", mock.Anything, mock.Anything).Return(1, nil)
+
+		submission := models.Submission{
+			UserName: "Charlie",
+			Version:  1,
+			Answers: []models.Answer{
+				{QuestionID: 1, OptionID: 2},
+				{QuestionID: 2, OptionID: 1},
+			},
+		}
+
+		response, err := service.SubmitQuiz(models.DefaultQuizID, submission)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, response.Score)
+		mockStorage.AssertNotCalled(t, "GetQuestionSet", 0)
+	})
+
+	t.Run("invalid answers", func(t *testing.T) {
+		mockStorage := new(MockStorage)
+		logger, _ := log.NewForTest()
+		service := quiz.NewService(mockStorage, logger)
+
+		mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+
+		mockStorage.On("GetQuestionSet", 0).Return(questionSet(1, 2, 3), nil)
+
+		submission := models.Submission{
+			UserName: "Charlie",
+			Answers: []models.Answer{
+				{QuestionID: 1, OptionID: 2},
+				{QuestionID: 7, OptionID: 3},
+				{QuestionID: 1, OptionID: 1},
+				{QuestionID: 2, OptionIDs: []int{1}},
+			},
+		}
+
+		_, err := service.SubmitQuiz(models.DefaultQuizID, submission)
+
+		var errResponse apierrors.ErrorResponse
+		require.ErrorAs(t, err, &errResponse)
+		assert.Equal(t, http.StatusBadRequest, errResponse.StatusCode())
+		body, _ := json.Marshal(errResponse.Errors)
+		assert.JSONEq(t, `[
+			{"field": "answers[1]", "error": "question 7 is not part of this quiz"},
+			{"field": "answers[2]", "error": "question 1 is answered more than once"},
+			{"field": "answers[3]", "error": "must be answered with optionId"}
+		]`, string(body))
+		mockStorage.AssertNotCalled(t, "AddLimitedSubmission", mock.Anything, mock.Anything)
 	})
 
-	t.Run("error fetching correct option", func(t *testing.T) {
+	t.Run("error fetching question set", func(t *testing.T) {
 		mockStorage := new(MockStorage)
 		logger, _ := log.NewForTest()
 		service := quiz.NewService(mockStorage, logger)
 
-		mockStorage.On("Count").Return(2)
-		mockStorage.On("GetCorrectOption", 1).Return(models.Option{ID: 2}, nil)
-		mockStorage.On("GetCorrectOption", 2).Return(models.Option{}, errors.New("database error"))
+		mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+
+		mockStorage.On("GetQuestionSet", 0).Return(models.QuestionSet{}, errors.New("database error"))
 
 		submission := models.Submission{
 			UserName: "Charlie",
@@ -124,7 +412,7 @@ func TestSubmitQuiz(t *testing.T) {
 			},
 		}
 
-		_, err := service.SubmitQuiz(submission)
+		_, err := service.SubmitQuiz(models.DefaultQuizID, submission)
 
 		assert.Error(t, err)
 		assert.EqualError(t, err, "database error")
@@ -136,17 +424,33 @@ func TestGetQuestions(t *testing.T) {
 	logger, _ := log.NewForTest()
 	service := quiz.NewService(mockStorage, logger)
 
-	questions := []models.Question{
-		{ID: 1, Text: "Question 1", Options: []models.Option{{ID: 1, Text: "Option 1"}}},
+	mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+
+	questions := models.QuestionSet{Version: 4, Questions: []models.Question{
+		{ID: 1, Text: "Question 1", Options: []models.Option{{ID: 1, Text: "Option 1", IsCorrect: true}}},
 		{ID: 2, Text: "Question 2", Options: []models.Option{{ID: 2, Text: "Option 2"}}},
-	}
+	}}
 
-	mockStorage.On("GetQuestions").Return(questions)
+	mockStorage.On("GetQuestionSet", 0).Return(questions, nil)
 
-	result := service.GetQuestions()
+	t.Run("answer key is stripped", func(t *testing.T) {
+		result, err := service.GetQuestions(models.DefaultQuizID)
 
-	assert.Equal(t, questions, result)
-	mockStorage.AssertCalled(t, "GetQuestions")
+		assert.NoError(t, err)
+		assert.Equal(t, models.PublicQuestionSet{Version: 4, Questions: []models.PublicQuestion{
+			{ID: 1, Type: models.QuestionSingleChoice, Text: "Question 1", Options: []models.PublicOption{{ID: 1, Text: "Option 1"}}},
+			{ID: 2, Type: models.QuestionSingleChoice, Text: "Question 2", Options: []models.PublicOption{{ID: 2, Text: "Option 2"}}},
+		}}, result)
+	})
+
+	t.Run("admin view keeps the answer key", func(t *testing.T) {
+		result, err := service.GetQuestionsWithAnswers(models.DefaultQuizID)
+
+		assert.NoError(t, err)
+		assert.Equal(t, questions, result)
+	})
+
+	mockStorage.AssertCalled(t, "GetQuestionSet", 0)
 }
 
 func TestGetUserSubmission(t *testing.T) {
@@ -155,19 +459,27 @@ func TestGetUserSubmission(t *testing.T) {
 		logger, _ := log.NewForTest()
 		service := quiz.NewService(mockStorage, logger)
 
-		mockStorage.On("GetUserSubmission", "Charlie").Return(models.Result{
+		mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+
+		mockStorage.On("GetUserSubmission", models.DefaultQuizID, "Charlie").Return(models.Result{
 			UserName:              "Charlie",
 			Score:                 8,
+			MaxScore:              10,
+			Percentage:            80,
 			TotalQuestionAnswered: 10,
 		}, nil)
-		mockStorage.On("CalculateScoreRankPercentage", 8).Return(75.00)
+		mockStorage.On("GetStanding", models.DefaultQuizID, models.Window{}, 80.0).Return(models.Standing{Rank: 2, Participants: 4, Lower: 2, Tied: 1}, nil)
 
-		response, err := service.GetUserSubmission("Charlie")
+		response, err := service.GetUserSubmission(models.DefaultQuizID, "Charlie", models.Window{})
 
 		assert.NoError(t, err)
-		assert.Equal(t, "You were better than 75.00% of all quizzers", response.Message)
-		assert.Equal(t, 8, response.Score)
-		assert.Equal(t, "75.00%", response.Rank)
+		assert.Equal(t, "You were better than 62.50% of all quizzers", response.Message)
+		assert.Equal(t, 8.0, response.Score)
+		assert.Equal(t, 80.0, response.Percentage)
+		assert.Equal(t, "62.50%", response.Rank)
+		assert.Equal(t, 2, response.Position)
+		assert.Equal(t, 4, response.Participants)
+		assert.Equal(t, 62.5, response.Percentile)
 		assert.Equal(t, 10, response.TotalQuestionAnswered)
 	})
 
@@ -176,11 +488,713 @@ func TestGetUserSubmission(t *testing.T) {
 		logger, _ := log.NewForTest()
 		service := quiz.NewService(mockStorage, logger)
 
-		mockStorage.On("GetUserSubmission", "UnknownUser").Return(models.Result{}, errors.New("user submission not found"))
+		mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+
+		mockStorage.On("GetUserSubmission", models.DefaultQuizID, "UnknownUser").Return(models.Result{}, errors.New("user submission not found"))
 
-		_, err := service.GetUserSubmission("UnknownUser")
+		_, err := service.GetUserSubmission(models.DefaultQuizID, "UnknownUser", models.Window{})
 
 		assert.Error(t, err)
 		assert.EqualError(t, err, "user submission not found")
 	})
+
+	t.Run("ranked attempt in a window", func(t *testing.T) {
+		mockStorage := new(MockStorage)
+		logger, _ := log.NewForTest()
+		service := quiz.NewService(mockStorage, logger)
+
+		day := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+		window := models.Window{From: day, To: day.Add(24 * time.Hour)}
+		attempts := []models.Result{
+			{UserName: "Charlie", Attempt: 1, Score: 9, MaxScore: 10, Percentage: 90, SubmittedAt: day.Add(-time.Hour)},
+			{UserName: "Charlie", Attempt: 2, Score: 6, MaxScore: 10, Percentage: 60, SubmittedAt: day.Add(time.Hour)},
+			{UserName: "Charlie", Attempt: 3, Score: 7, MaxScore: 10, Percentage: 70, SubmittedAt: day.Add(2 * time.Hour)},
+		}
+		mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+		mockStorage.On("GetUserAttempts", models.DefaultQuizID, "Charlie").Return(attempts, nil)
+		mockStorage.On("RankingPolicy").Return(storage.RankBest)
+		mockStorage.On("GetStanding", models.DefaultQuizID, window, 70.0).Return(models.Standing{Rank: 1, Participants: 1, Tied: 1}, nil)
+
+		response, err := service.GetUserSubmission(models.DefaultQuizID, "Charlie", window)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 3, response.Attempt)
+		assert.Equal(t, "50.00%", response.Rank)
+		assert.Equal(t, 1, response.Participants)
+
+		_, err = service.GetUserSubmission(models.DefaultQuizID, "Charlie", models.Window{From: day.Add(24 * time.Hour)})
+		assert.Equal(t, storage.ErrSubmissionNotFound, err)
+	})
+}
+
+func TestSubmitQuiz_AttemptLimits(t *testing.T) {
+	limited := models.Quiz{ID: "limited", Title: "Limited", MaxAttempts: 2, CooldownSeconds: 60}
+	submission := models.Submission{UserName: "Charlie", Answers: []models.Answer{{QuestionID: 1, OptionID: 2}}}
+
+	tests := []struct {
+		name     string
+		attempts []models.Result
+		wantErr  string
+	}{
+		{"first attempt", nil, ""},
+		{"cooldown passed", []models.Result{{Attempt: 1, SubmittedAt: time.Now().Add(-2 * time.Minute)}}, ""},
+		{"cooling down", []models.Result{{Attempt: 1, SubmittedAt: time.Now().Add(-15 * time.Second)}}, "You can try this quiz again in 45s"},
+		{"attempts used up", []models.Result{
+			{Attempt: 1, SubmittedAt: time.Now().Add(-time.Hour)},
+			{Attempt: 2, SubmittedAt: time.Now().Add(-time.Hour)},
+		}, "You have used all 2 attempts of this quiz"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := new(MockStorage)
+			logger, _ := log.NewForTest()
+			service := quiz.NewService(mockStorage, logger)
+
+			mockStorage.On("GetQuiz", "limited").Return(limited, nil)
+			if tt.attempts == nil {
+				mockStorage.On("GetUserAttempts", "limited", "Charlie").Return([]models.Result(nil), storage.ErrSubmissionNotFound)
+			} else {
+				mockStorage.On("GetUserAttempts", "limited", "Charlie").Return(tt.attempts, nil)
+			}
+			mockStorage.On("GetQuestionSet", 0).Return(questionSet(1, 2), nil)
+			mockStorage.On("AddLimitedSubmission", mock.Anything, mock.Anything).Return(len(tt.attempts)+1, nil)
+
+			response, err := service.SubmitQuiz("limited", submission)
+
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				assert.Equal(t, len(tt.attempts)+1, response.Attempt)
+				return
+			}
+			var errResponse apierrors.ErrorResponse
+			require.ErrorAs(t, err, &errResponse)
+			assert.Equal(t, http.StatusForbidden, errResponse.StatusCode())
+			assert.Equal(t, tt.wantErr, errResponse.Message)
+			mockStorage.AssertNotCalled(t, "AddLimitedSubmission", mock.Anything, mock.Anything)
+		})
+	}
+}
+
+func TestSubmitQuiz_QuestionTypes(t *testing.T) {
+	isTrue := true
+	number := func(value float64) *float64 { return &value }
+	text := func(value string) *string { return &value }
+	boolean := func(value bool) *bool { return &value }
+
+	choices := []models.Option{{ID: 1, Text: "A", IsCorrect: true}, {ID: 2, Text: "B"}, {ID: 3, Text: "C", IsCorrect: true}}
+	multiple := models.Question{ID: 1, Type: models.QuestionMultipleChoice, Text: "Pick", Options: choices}
+	trueFalse := models.Question{ID: 1, Type: models.QuestionTrueFalse, Text: "True?", IsTrue: &isTrue}
+	numeric := models.Question{ID: 1, Type: models.QuestionNumeric, Text: "Pi?", NumericKey: &models.NumericKey{Value: 3.14, Tolerance: 0.01}}
+	accepted := models.Question{ID: 1, Type: models.QuestionText, Text: "Capital?", TextKey: &models.TextKey{Accepted: []string{"New  Delhi"}}}
+	pattern := models.Question{ID: 1, Type: models.QuestionText, Text: "Colour?", TextKey: &models.TextKey{Pattern: "colou?r", CaseSensitive: true}}
+
+	tests := []struct {
+		name      string
+		question  models.Question
+		answer    models.Answer
+		wantScore float64
+		wantErr   string
+	}{
+		{"multiple choice, all correct options", multiple, models.Answer{OptionIDs: []int{3, 1}}, 1, ""},
+		{"multiple choice, missing option", multiple, models.Answer{OptionIDs: []int{1}}, 0, ""},
+		{"multiple choice, extra option", multiple, models.Answer{OptionIDs: []int{1, 2, 3}}, 0, ""},
+		{"multiple choice, unknown option", multiple, models.Answer{OptionIDs: []int{1, 3, 9}}, 0, ""},
+		{"multiple choice, wrong field", multiple, models.Answer{OptionID: 1}, 0, "There is some problem with the data you submitted."},
+		{"true/false, correct", trueFalse, models.Answer{Boolean: boolean(true)}, 1, ""},
+		{"true/false, wrong", trueFalse, models.Answer{Boolean: boolean(false)}, 0, ""},
+		{"numeric, within tolerance", numeric, models.Answer{Number: number(3.15)}, 1, ""},
+		{"numeric, outside tolerance", numeric, models.Answer{Number: number(3.2)}, 0, ""},
+		{"text, normalized", accepted, models.Answer{Text: text("  new delhi ")}, 1, ""},
+		{"text, wrong", accepted, models.Answer{Text: text("Mumbai")}, 0, ""},
+		{"text, pattern", pattern, models.Answer{Text: text("color")}, 1, ""},
+		{"text, pattern is case sensitive", pattern, models.Answer{Text: text("Colour")}, 0, ""},
+		{"text, pattern matches whole answer", pattern, models.Answer{Text: text("colors")}, 0, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := new(MockStorage)
+			logger, _ := log.NewForTest()
+			service := quiz.NewService(mockStorage, logger)
+
+			mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+			mockStorage.On("GetQuestionSet", 0).Return(models.QuestionSet{Version: 1, Questions: []models.Question{tt.question}}, nil)
+			mockStorage.On("AddLimitedSubmission", mock.Anything, mock.Anything).Return(1, nil)
+
+			tt.answer.QuestionID = tt.question.ID
+			response, err := service.SubmitQuiz(models.DefaultQuizID, models.Submission{UserName: "Charlie", Answers: []models.Answer{tt.answer}})
+
+			if tt.wantErr != "" {
+				assert.EqualError(t, err, tt.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.wantScore, response.Score)
+		})
+	}
+}
+
+func TestSubmitQuiz_WeightedScoring(t *testing.T) {
+	choices := []models.Option{{ID: 1, Text: "A", IsCorrect: true}, {ID: 2, Text: "B"}, {ID: 3, Text: "C", IsCorrect: true}, {ID: 4, Text: "D"}}
+	questions := []models.Question{
+		{ID: 1, Text: "Single", Points: 2, Penalty: 1, Options: choices[:2]},
+		{ID: 2, Type: models.QuestionMultipleChoice, Text: "Proportional", Points: 4, Scoring: models.ScoringProportional, Options: choices},
+		{ID: 3, Type: models.QuestionMultipleChoice, Text: "All or nothing", Options: choices},
+	}
+
+	tests := []struct {
+		name           string
+		answers        []models.Answer
+		wantScore      float64
+		wantPercentage float64
+	}{
+		{"all correct", []models.Answer{
+			{QuestionID: 1, OptionID: 1}, {QuestionID: 2, OptionIDs: []int{1, 3}}, {QuestionID: 3, OptionIDs: []int{1, 3}},
+		}, 7, 100},
+		{"partial credit", []models.Answer{
+			{QuestionID: 1, OptionID: 1}, {QuestionID: 2, OptionIDs: []int{1}}, {QuestionID: 3, OptionIDs: []int{1}},
+		}, 4, 57.14},
+		{"incorrect option takes credit back", []models.Answer{
+			{QuestionID: 1, OptionID: 1}, {QuestionID: 2, OptionIDs: []int{1, 2, 3}}, {QuestionID: 3, OptionIDs: []int{1, 2, 3}},
+		}, 4, 57.14},
+		{"penalty", []models.Answer{
+			{QuestionID: 1, OptionID: 2}, {QuestionID: 2, OptionIDs: []int{1, 3}}, {QuestionID: 3, OptionIDs: []int{}},
+		}, 3, 42.86},
+		{"score never drops below zero", []models.Answer{
+			{QuestionID: 1, OptionID: 2}, {QuestionID: 2, OptionIDs: []int{2, 4}}, {QuestionID: 3, OptionIDs: []int{}},
+		}, 0, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := new(MockStorage)
+			logger, _ := log.NewForTest()
+			service := quiz.NewService(mockStorage, logger)
+
+			mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+			mockStorage.On("GetQuestionSet", 0).Return(models.QuestionSet{Version: 1, Questions: questions}, nil)
+			mockStorage.On("AddLimitedSubmission", mock.Anything, mock.Anything).Return(1, nil)
+
+			response, err := service.SubmitQuiz(models.DefaultQuizID, models.Submission{UserName: "Charlie", Answers: tt.answers})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantScore, response.Score)
+			assert.Equal(t, 7.0, response.MaxScore)
+			assert.Equal(t, tt.wantPercentage, response.Percentage)
+			mockStorage.AssertCalled(t, "AddLimitedSubmission", mock.MatchedBy(func(result models.Result) bool {
+				return result.Score == tt.wantScore && result.MaxScore == 7 && result.Percentage == tt.wantPercentage
+			}), mock.Anything)
+		})
+	}
+}
+
+func TestSubmitQuiz_Feedback(t *testing.T) {
+	questions := []models.Question{
+		{ID: 1, Text: "Single", Points: 2, Explanation: "Because.", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}, {ID: 2, Text: "B"}}},
+		{ID: 2, Type: models.QuestionNumeric, Text: "Numeric", NumericKey: &models.NumericKey{Value: 42}},
+	}
+	answers := []models.Answer{{QuestionID: 1, OptionID: 2}}
+	correctOption, correctNumber := models.Answer{QuestionID: 1, OptionID: 1}, 42.0
+
+	full := []models.AnswerFeedback{
+		{QuestionID: 1, Answer: &answers[0], Points: 0, MaxPoints: 2, CorrectAnswer: &correctOption, Explanation: "Because."},
+		{QuestionID: 2, Skipped: true, MaxPoints: 1, CorrectAnswer: &models.Answer{QuestionID: 2, Number: &correctNumber}},
+	}
+	results := []models.AnswerFeedback{
+		{QuestionID: 1, Answer: &answers[0], Points: 0, MaxPoints: 2},
+		{QuestionID: 2, Skipped: true, MaxPoints: 1},
+	}
+
+	tests := []struct {
+		feedback models.Feedback
+		want     []models.AnswerFeedback
+	}{
+		{"", nil},
+		{models.FeedbackNone, nil},
+		{models.FeedbackResults, results},
+		{models.FeedbackFull, full},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.feedback), func(t *testing.T) {
+			mockStorage := new(MockStorage)
+			logger, _ := log.NewForTest()
+			service := quiz.NewService(mockStorage, logger)
+
+			mockStorage.On("GetQuiz", "feedback").Return(models.Quiz{ID: "feedback", Title: "Feedback", Feedback: tt.feedback}, nil)
+			mockStorage.On("GetQuestionSet", 0).Return(models.QuestionSet{Version: 1, Questions: questions}, nil)
+			mockStorage.On("AddLimitedSubmission", mock.Anything, mock.Anything).Return(1, nil)
+
+			response, err := service.SubmitQuiz("feedback", models.Submission{UserName: "Charlie", Answers: answers})
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, response.Answers)
+		})
+	}
+}
+
+func TestStartSession(t *testing.T) {
+	mockStorage := new(MockStorage)
+	logger, _ := log.NewForTest()
+	service := quiz.NewService(mockStorage, logger)
+
+	timed := models.Quiz{ID: "timed", Title: "Timed", TimeLimitSeconds: 90}
+	mockStorage.On("GetQuiz", "timed").Return(timed, nil)
+	mockStorage.On("GetQuestionSet", 0).Return(questionSet(3, 1, 2), nil)
+	mockStorage.On("CreateSession", mock.Anything).Return(nil)
+
+	response, err := service.StartSession("timed", "Charlie")
+
+	require.NoError(t, err)
+	assert.Len(t, response.ID, 32)
+	assert.Equal(t, "timed", response.QuizID)
+	assert.Equal(t, "Charlie", response.UserName)
+	assert.Equal(t, 3, response.Version)
+	assert.Equal(t, 90*time.Second, response.Deadline.Sub(response.StartedAt))
+	assert.Len(t, response.Questions, 2)
+	mockStorage.AssertCalled(t, "CreateSession", response.Session)
+}
+
+func TestSessionShuffles(t *testing.T) {
+	mockStorage := new(MockStorage)
+	logger, _ := log.NewForTest()
+	service := quiz.NewService(mockStorage, logger)
+
+	shuffled := models.Quiz{ID: "shuffled", Title: "Shuffled", ShuffleQuestions: true, ShuffleOptions: true}
+	set := questionSet(1, 1, 2, 3, 4, 1, 2, 3, 4)
+	mockStorage.On("GetQuiz", "shuffled").Return(shuffled, nil)
+	mockStorage.On("GetQuestionSet", 0).Return(set, nil)
+	mockStorage.On("GetQuestionSet", 1).Return(set, nil)
+	mockStorage.On("CreateSession", mock.Anything).Return(nil)
+
+	response, err := service.StartSession("shuffled", "Charlie")
+	require.NoError(t, err)
+	assert.NotZero(t, response.Seed)
+	assert.True(t, response.ShuffleQuestions)
+	assert.True(t, response.ShuffleOptions)
+
+	mockStorage.On("GetSession", response.ID).Return(response.Session, nil)
+	details, err := service.GetSession(response.ID)
+	require.NoError(t, err)
+	require.Len(t, details.Questions, len(set.Questions))
+
+	// the audit shows exactly what the participant saw
+	seen := map[int]bool{}
+	for i, question := range details.Questions {
+		shown := response.Questions[i]
+		assert.Equal(t, shown.ID, question.ID)
+		require.Len(t, question.Options, 4)
+		for j, option := range question.Options {
+			assert.Equal(t, shown.Options[j].ID, option.ID)
+		}
+		seen[question.ID] = true
+	}
+	assert.Len(t, seen, len(set.Questions))
+	// the shuffles never touch the stored question set
+	assert.Equal(t, questionSet(1, 1, 2, 3, 4, 1, 2, 3, 4), set)
+}
+
+func TestBlueprint(t *testing.T) {
+	// questions 1-4 are easy geography, 5-8 hard science
+	set := questionSet(1, 1, 1, 1, 1, 2, 2, 2, 2)
+	for i := range set.Questions {
+		set.Questions[i].Tags, set.Questions[i].Difficulty = []string{"geography"}, models.DifficultyEasy
+		if i >= 4 {
+			set.Questions[i].Tags, set.Questions[i].Difficulty = []string{"science"}, models.DifficultyHard
+		}
+	}
+	drawn := models.Quiz{ID: "drawn", Title: "Drawn", Blueprint: []models.BlueprintRule{
+		{Tag: "geography", Difficulty: models.DifficultyEasy, Count: 3},
+		{Tag: "science", Count: 2},
+	}}
+
+	mockStorage := new(MockStorage)
+	logger, _ := log.NewForTest()
+	service := quiz.NewService(mockStorage, logger)
+
+	mockStorage.On("GetQuiz", "drawn").Return(drawn, nil)
+	mockStorage.On("GetQuestionSet", 0).Return(set, nil)
+	mockStorage.On("GetQuestionSet", 1).Return(set, nil)
+	mockStorage.On("CreateSession", mock.Anything).Return(nil)
+	mockStorage.On("AddSessionSubmission", mock.Anything, mock.Anything, mock.Anything).Return(1, nil)
+
+	response, err := service.StartSession("drawn", "Charlie")
+	require.NoError(t, err)
+	require.Len(t, response.Questions, 5)
+	require.Len(t, response.QuestionIDs, 5)
+	for i, question := range response.Questions {
+		assert.Equal(t, response.QuestionIDs[i], question.ID)
+		if i < 3 {
+			assert.LessOrEqual(t, question.ID, 4)
+		} else {
+			assert.Greater(t, question.ID, 4)
+		}
+	}
+
+	details, err := service.GetQuiz("drawn")
+	require.NoError(t, err)
+	assert.Len(t, details.Questions, 5)
+
+	_, err = service.SubmitQuiz("drawn", models.Submission{UserName: "Charlie", Answers: []models.Answer{{QuestionID: 1, OptionID: 1}}})
+	assert.EqualError(t, err, "This quiz draws its questions at random and can only be submitted within a session")
+
+	// graded against the issued questions only, so an answer to any other
+	// question of the pool is rejected
+	session := response.Session
+	session.StartedAt = time.Now().UTC()
+	mockStorage.On("GetSession", session.ID).Return(session, nil)
+	answers := []models.Answer{{QuestionID: response.QuestionIDs[0], OptionID: 1}}
+	submitted, err := service.SubmitQuiz("drawn", models.Submission{UserName: "Charlie", SessionID: session.ID, Answers: answers})
+	require.NoError(t, err)
+	assert.Equal(t, 5, submitted.QuestionCount)
+	assert.Equal(t, 1.0, submitted.Score)
+
+	for id := 1; id <= 8; id++ {
+		if !slices.Contains(response.QuestionIDs, id) {
+			answers = []models.Answer{{QuestionID: id, OptionID: 1}}
+			break
+		}
+	}
+	_, err = service.SubmitQuiz("drawn", models.Submission{UserName: "Charlie", SessionID: session.ID, Answers: answers})
+	assert.ErrorContains(t, err, "There is some problem with the data you submitted")
+}
+
+func TestGetLeaderboard(t *testing.T) {
+	entries := []models.LeaderboardEntry{
+		{Rank: 1, UserName: "Alice", Percentage: 90},
+		{Rank: 2, UserName: "Bob", Percentage: 80},
+		{Rank: 2, UserName: "Charlie", Percentage: 80},
+	}
+
+	mockStorage := new(MockStorage)
+	logger, _ := log.NewForTest()
+	service := quiz.NewService(mockStorage, logger)
+
+	mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+	mockStorage.On("GetLeaderboard", models.DefaultQuizID, models.Window{}, (*models.LeaderboardCursor)(nil), 3).Return(entries, nil)
+	mockStorage.On("GetLeaderboard", models.DefaultQuizID, models.Window{}, &models.LeaderboardCursor{Percentage: 80, UserName: "Bob"}, 3).Return(entries[2:], nil)
+
+	first, err := service.GetLeaderboard(models.DefaultQuizID, models.Window{}, 2, "")
+	require.NoError(t, err)
+	assert.Equal(t, entries[:2], first.Entries)
+	require.NotEmpty(t, first.NextCursor)
+
+	second, err := service.GetLeaderboard(models.DefaultQuizID, models.Window{}, 2, first.NextCursor)
+	require.NoError(t, err)
+	assert.Equal(t, entries[2:], second.Entries)
+	assert.Empty(t, second.NextCursor)
+
+	_, err = service.GetLeaderboard(models.DefaultQuizID, models.Window{}, 2, "not a cursor")
+	assert.EqualError(t, err, "The cursor is invalid")
+	_, err = service.GetLeaderboard(models.DefaultQuizID, models.Window{}, quiz.MaxLeaderboardLimit+1, "")
+	assert.EqualError(t, err, "The limit must be between 1 and 100")
+
+	mockStorage.On("GetLeaderboardAround", models.DefaultQuizID, "Bob", models.Window{}, quiz.DefaultLeaderboardNeighbours).Return(entries, nil)
+	around, err := service.GetLeaderboardAround(models.DefaultQuizID, "Bob", models.Window{}, 0)
+	require.NoError(t, err)
+	assert.Equal(t, entries, around.Entries)
+}
+
+func TestSubmitQuiz_Sessions(t *testing.T) {
+	timed := models.Quiz{ID: "timed", Title: "Timed", TimeLimitSeconds: 60}
+	startedAt := time.Now().UTC().Add(-30 * time.Second)
+	session := models.Session{ID: "abc", QuizID: "timed", UserName: "Charlie", Version: 1, StartedAt: startedAt, Deadline: startedAt.Add(time.Minute)}
+	finishedAt := startedAt.Add(10 * time.Second)
+
+	tests := []struct {
+		name      string
+		sessionID string
+		session   models.Session
+		submitErr error
+		wantErr   string
+	}{
+		{name: "in time", sessionID: "abc", session: session},
+		{name: "without session", wantErr: "This quiz is timed and can only be submitted within a session"},
+		{name: "unknown session", sessionID: "unknown", wantErr: "session not found"},
+		{name: "late", sessionID: "abc", session: models.Session{ID: "abc", QuizID: "timed", UserName: "Charlie", Version: 1,
+			StartedAt: startedAt.Add(-time.Hour), Deadline: startedAt.Add(-59 * time.Minute)}, wantErr: "The session ended at"},
+		{name: "other user", sessionID: "abc", session: models.Session{ID: "abc", QuizID: "timed", UserName: "Alice", Version: 1,
+			StartedAt: startedAt, Deadline: session.Deadline}, wantErr: "The session belongs to another quiz or user"},
+		{name: "submitted before", sessionID: "abc", session: models.Session{ID: "abc", QuizID: "timed", UserName: "Charlie", Version: 1,
+			StartedAt: startedAt, Deadline: session.Deadline, FinishedAt: &finishedAt}, wantErr: "The session has already been submitted"},
+		{name: "submitted concurrently", sessionID: "abc", session: session, submitErr: storage.ErrSessionFinished, wantErr: "The session has already been submitted"},
+		{name: "attempted concurrently", sessionID: "abc", session: session, submitErr: storage.ErrCoolingDown, wantErr: "You cannot try this quiz again yet"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := new(MockStorage)
+			logger, _ := log.NewForTest()
+			service := quiz.NewService(mockStorage, logger)
+
+			mockStorage.On("GetQuiz", "timed").Return(timed, nil)
+			mockStorage.On("GetSession", "abc").Return(tt.session, nil)
+			mockStorage.On("GetSession", "unknown").Return(models.Session{}, storage.ErrSessionNotFound)
+			// the session pins version 1 although the submission asks for 2
+			mockStorage.On("GetQuestionSet", 1).Return(questionSet(1, 2), nil)
+			mockStorage.On("AddSessionSubmission", "abc", mock.Anything, mock.Anything).Return(1, tt.submitErr)
+
+			response, err := service.SubmitQuiz("timed", models.Submission{
+				UserName:  "Charlie",
+				SessionID: tt.sessionID,
+				Version:   2,
+				Answers:   []models.Answer{{QuestionID: 1, OptionID: 2}},
+			})
+
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				mockStorage.AssertNotCalled(t, "AddLimitedSubmission", mock.Anything, mock.Anything)
+				return
+			}
+			require.NoError(t, err)
+			mockStorage.AssertNotCalled(t, "AddLimitedSubmission", mock.Anything, mock.Anything)
+			assert.Equal(t, 1.0, response.Score)
+			assert.InDelta(t, 30000, response.ElapsedMillis, 1000)
+		})
+	}
+}
+
+func TestSubmitQuiz_ConcurrentAttempts(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	service := quiz.NewService(store, logger)
+	require.NoError(t, store.SetQuizzes([]models.Quiz{{ID: "limited", Title: "Limited", MaxAttempts: 2}}))
+
+	var wg sync.WaitGroup
+	var accepted atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := service.SubmitQuiz("limited", models.Submission{UserName: "Charlie", Answers: []models.Answer{{QuestionID: 1, OptionID: 1}}})
+			if err == nil {
+				accepted.Add(1)
+				return
+			}
+			var errResponse apierrors.ErrorResponse
+			if assert.ErrorAs(t, err, &errResponse) {
+				assert.Equal(t, http.StatusForbidden, errResponse.StatusCode())
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(2), accepted.Load())
+	attempts, err := store.GetUserAttempts("limited", "Charlie")
+	require.NoError(t, err)
+	assert.Len(t, attempts, 2)
+}
+
+func TestSubmitQuiz_SessionKeepsQuiz(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	service := quiz.NewService(store, logger)
+
+	questions := questionSet(0, 1, 2, 3).Questions
+	_, err := store.SetQuestionBank(questions, []models.Quiz{{ID: "space", Title: "Space", QuestionIDs: []int{1, 2}, Feedback: models.FeedbackFull}})
+	require.NoError(t, err)
+
+	session, err := service.StartSession("space", "Charlie")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, session.QuestionIDs)
+
+	// the quiz changes while the session is running
+	_, err = store.SetQuestionBank(questions, []models.Quiz{{ID: "space", Title: "Space", QuestionIDs: []int{3}}})
+	require.NoError(t, err)
+
+	response, err := service.SubmitQuiz("space", models.Submission{
+		UserName:  "Charlie",
+		SessionID: session.ID,
+		Answers:   []models.Answer{{QuestionID: 1, OptionID: 1}, {QuestionID: 2, OptionID: 2}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, response.QuestionCount)
+	assert.Equal(t, 2.0, response.Score)
+	assert.Len(t, response.Answers, 2)
+}
+
+func TestGetUserAttempts(t *testing.T) {
+	mockStorage := new(MockStorage)
+	logger, _ := log.NewForTest()
+	service := quiz.NewService(mockStorage, logger)
+
+	attempts := []models.Result{
+		{QuizID: models.DefaultQuizID, UserName: "Charlie", Attempt: 1, Score: 8},
+		{QuizID: models.DefaultQuizID, UserName: "Charlie", Attempt: 2, Score: 5},
+	}
+	mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+	mockStorage.On("GetUserAttempts", models.DefaultQuizID, "Charlie").Return(attempts, nil)
+	mockStorage.On("GetUserSubmission", models.DefaultQuizID, "Charlie").Return(attempts[0], nil)
+	mockStorage.On("RankingPolicy").Return(storage.RankBest)
+
+	response, err := service.GetUserAttempts(models.DefaultQuizID, "Charlie")
+
+	assert.NoError(t, err)
+	assert.Equal(t, models.AttemptsResponse{
+		UserName:      "Charlie",
+		RankingPolicy: "best",
+		RankedAttempt: 1,
+		Attempts:      attempts,
+	}, response)
+}
+
+func TestQuizzes_TimeLimit(t *testing.T) {
+	mockStorage := new(MockStorage)
+	logger, _ := log.NewForTest()
+	service := quiz.NewService(mockStorage, logger)
+
+	timed := models.Quiz{ID: "timed", Title: "Timed", TimeLimitSeconds: 90}
+	mockStorage.On("GetQuestionSet", 0).Return(questionSet(1, 1, 2), nil)
+	mockStorage.On("GetQuizzes").Return([]models.Quiz{timed})
+	mockStorage.On("GetQuiz", "timed").Return(timed, nil)
+
+	summaries, err := service.GetQuizzes()
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, 90, summaries[0].TimeLimitSeconds)
+
+	details, err := service.GetQuiz("timed")
+	require.NoError(t, err)
+	assert.Equal(t, 90, details.TimeLimitSeconds)
+}
+
+func TestQuizzes(t *testing.T) {
+	mockStorage := new(MockStorage)
+	logger, _ := log.NewForTest()
+	service := quiz.NewService(mockStorage, logger)
+
+	space := models.Quiz{ID: "space", Title: "Space", QuestionIDs: []int{3, 1}}
+	mockStorage.On("GetQuestionSet", 0).Return(questionSet(2, 1, 1, 1), nil)
+	mockStorage.On("GetQuizzes").Return([]models.Quiz{storage.DefaultQuiz(), space})
+	mockStorage.On("GetQuiz", "space").Return(space, nil)
+	mockStorage.On("GetQuiz", "unknown").Return(models.Quiz{}, storage.ErrQuizNotFound)
+
+	t.Run("list quizzes", func(t *testing.T) {
+		summaries, err := service.GetQuizzes()
+
+		assert.NoError(t, err)
+		assert.Equal(t, []models.QuizSummary{
+			{ID: models.DefaultQuizID, Title: "General Knowledge", Description: "Every question of the current question set.", QuestionCount: 3},
+			{ID: "space", Title: "Space", QuestionCount: 2},
+		}, summaries)
+	})
+
+	t.Run("quiz questions in quiz order", func(t *testing.T) {
+		details, err := service.GetQuiz("space")
+
+		assert.NoError(t, err)
+		assert.Equal(t, 2, details.Version)
+		assert.Len(t, details.Questions, 2)
+		assert.Equal(t, 3, details.Questions[0].ID)
+		assert.Equal(t, 1, details.Questions[1].ID)
+	})
+
+	t.Run("submission graded against the quiz questions", func(t *testing.T) {
+		mockStorage.On("AddLimitedSubmission", mock.Anything, mock.Anything).Return(1, nil).Once()
+
+		response, err := service.SubmitQuiz("space", models.Submission{
+			UserName: "Charlie",
+			Answers:  []models.Answer{{QuestionID: 1, OptionID: 1}, {QuestionID: 3, OptionID: 2}},
+		})
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1.0, response.Score)
+		mockStorage.AssertCalled(t, "AddLimitedSubmission", mock.MatchedBy(func(result models.Result) bool {
+			return result.QuizID == "space" && result.UserName == "Charlie" && result.Score == 1 && result.TotalQuestionAnswered == 2
+		}), mock.Anything)
+	})
+
+	t.Run("unknown quiz", func(t *testing.T) {
+		_, err := service.GetQuiz("unknown")
+		assert.ErrorIs(t, err, storage.ErrQuizNotFound)
+
+		_, err = service.SubmitQuiz("unknown", models.Submission{UserName: "Charlie"})
+		assert.ErrorIs(t, err, storage.ErrQuizNotFound)
+	})
+}
+
+func TestGetStatistics(t *testing.T) {
+	mockStorage := new(MockStorage)
+	logger, _ := log.NewForTest()
+	service := quiz.NewService(mockStorage, logger)
+
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	window := models.Window{From: day, To: day.Add(24 * time.Hour)}
+	mockStorage.On("GetQuiz", models.DefaultQuizID).Return(storage.DefaultQuiz(), nil)
+	mockStorage.On("GetQuiz", "unknown").Return(models.Quiz{}, storage.ErrQuizNotFound)
+	mockStorage.On("GetRankedPercentages", models.DefaultQuizID, window).Return([]float64{100, 90, 50, 50, 5, 0}, nil)
+	mockStorage.On("GetRankedPercentages", models.DefaultQuizID, models.Window{}).Return([]float64{}, nil)
+
+	statistics, err := service.GetStatistics(models.DefaultQuizID, window)
+	require.NoError(t, err)
+	assert.Equal(t, models.DefaultQuizID, statistics.QuizID)
+	assert.Equal(t, &window.From, statistics.From)
+	assert.Equal(t, 6, statistics.Participants)
+	assert.Equal(t, 49.17, statistics.Mean)
+	assert.Equal(t, 50.0, statistics.Median)
+	assert.Equal(t, 37.91, statistics.StandardDeviation)
+	require.Len(t, statistics.Histogram, 10)
+	counts := make([]int, 0, len(statistics.Histogram))
+	for _, bucket := range statistics.Histogram {
+		counts = append(counts, bucket.Count)
+	}
+	assert.Equal(t, []int{2, 0, 0, 0, 0, 2, 0, 0, 0, 2}, counts)
+	assert.Equal(t, models.HistogramBucket{From: 90, To: 100, Count: 2}, statistics.Histogram[9])
+
+	empty, err := service.GetStatistics(models.DefaultQuizID, models.Window{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, empty.Participants)
+	assert.Nil(t, empty.From)
+	assert.Len(t, empty.Histogram, 10)
+
+	_, err = service.GetStatistics("unknown", models.Window{})
+	assert.ErrorIs(t, err, storage.ErrQuizNotFound)
+}
+
+func TestSubmitQuizOnce(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	service := quiz.NewService(store, logger)
+
+	submission := models.Submission{UserName: "Charlie", UserID: "u1", Answers: []models.Answer{{QuestionID: 1, OptionID: 1}}}
+
+	first, replayed, err := service.SubmitQuizOnce(models.DefaultQuizID, "k1", submission)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+
+	// a retry gets the same response without being graded again
+	again, replayed, err := service.SubmitQuizOnce(models.DefaultQuizID, "k1", submission)
+	require.NoError(t, err)
+	assert.True(t, replayed)
+	assert.Equal(t, string(first), string(again))
+	attempts, err := store.GetUserAttempts(models.DefaultQuizID, "Charlie")
+	require.NoError(t, err)
+	assert.Len(t, attempts, 1)
+
+	// the key cannot be reused for other answers
+	other := submission
+	other.Answers = []models.Answer{{QuestionID: 1, OptionID: 2}}
+	_, _, err = service.SubmitQuizOnce(models.DefaultQuizID, "k1", other)
+	var response apierrors.ErrorResponse
+	require.ErrorAs(t, err, &response)
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode())
+
+	// keys are scoped to the user
+	dana := models.Submission{UserName: "Dana", UserID: "u2", Answers: submission.Answers}
+	_, replayed, err = service.SubmitQuizOnce(models.DefaultQuizID, "k1", dana)
+	require.NoError(t, err)
+	assert.False(t, replayed)
+
+	// failed submissions free the key, so that retries fail the same way
+	// rather than as in progress
+	stale := models.Submission{UserName: "Charlie", UserID: "u1", Version: 99, Answers: submission.Answers}
+	_, _, failed := service.SubmitQuizOnce(models.DefaultQuizID, "k2", stale)
+	require.Error(t, failed)
+	_, _, err = service.SubmitQuizOnce(models.DefaultQuizID, "k2", stale)
+	assert.Equal(t, failed, err)
+	attempts, err = store.GetUserAttempts(models.DefaultQuizID, "Charlie")
+	require.NoError(t, err)
+	assert.Len(t, attempts, 1)
 }
@@ -0,0 +1,45 @@
+package quiz
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	mathrand "math/rand"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// shuffle returns the questions in the order the session shows them. The
+// shuffles only depend on the seed of the session and the order of
+// questions, so they are reproduced exactly when grading and auditing.
+func shuffle(questions []models.Question, session models.Session) []models.Question {
+	if !session.ShuffleQuestions && !session.ShuffleOptions {
+		return questions
+	}
+
+	rng := mathrand.New(mathrand.NewSource(session.Seed))
+	shuffled := append([]models.Question(nil), questions...)
+	if session.ShuffleQuestions {
+		rng.Shuffle(len(shuffled), func(i, j int) {
+			shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+		})
+	}
+	if session.ShuffleOptions {
+		for i := range shuffled {
+			options := append([]models.Option(nil), shuffled[i].Options...)
+			rng.Shuffle(len(options), func(i, j int) {
+				options[i], options[j] = options[j], options[i]
+			})
+			shuffled[i].Options = options
+		}
+	}
+	return shuffled
+}
+
+// newSeed returns a random shuffle seed.
+func newSeed() (int64, error) {
+	seed := make([]byte, 8)
+	if _, err := rand.Read(seed); err != nil {
+		return 0, err
+	}
+	return int64(binary.BigEndian.Uint64(seed)), nil
+}
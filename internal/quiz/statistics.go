@@ -0,0 +1,57 @@
+package quiz
+
+import (
+	"math"
+	"sort"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// summarise computes the statistics of the percentages. The standard
+// deviation is that of the population, as every participant is counted.
+func summarise(percentages []float64) models.Statistics {
+	statistics := models.Statistics{
+		Participants: len(percentages),
+		Histogram:    make([]models.HistogramBucket, 0, 100/models.HistogramBucketWidth),
+	}
+	for from := 0; from < 100; from += models.HistogramBucketWidth {
+		statistics.Histogram = append(statistics.Histogram, models.HistogramBucket{
+			From: float64(from),
+			To:   float64(min(from+models.HistogramBucketWidth, 100)),
+		})
+	}
+	if len(percentages) == 0 {
+		return statistics
+	}
+
+	sorted := append([]float64(nil), percentages...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, percentage := range sorted {
+		sum += percentage
+		bucket := min(int(percentage)/models.HistogramBucketWidth, len(statistics.Histogram)-1)
+		statistics.Histogram[max(bucket, 0)].Count++
+	}
+	mean := sum / float64(len(sorted))
+
+	var squares float64
+	for _, percentage := range sorted {
+		squares += (percentage - mean) * (percentage - mean)
+	}
+
+	median := sorted[len(sorted)/2]
+	if len(sorted)%2 == 0 {
+		median = (sorted[len(sorted)/2-1] + median) / 2
+	}
+
+	statistics.Mean = round(mean)
+	statistics.Median = round(median)
+	statistics.StandardDeviation = round(math.Sqrt(squares / float64(len(sorted))))
+	return statistics
+}
+
+// round rounds x to two decimals.
+func round(x float64) float64 {
+	return math.Round(x*100) / 100
+}
@@ -0,0 +1,112 @@
+// Package ratelimit provides a middleware throttling clients with token
+// buckets.
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limit lets a client make Requests requests every Per. Clients may use them
+// in a burst, after which they are refilled evenly over Per.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+}
+
+// Result is the outcome of taking a request from a bucket.
+type Result struct {
+	Allowed bool
+	// Limit is the size of the bucket and Remaining the requests left in it.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again and RetryAfter how
+	// long until the next request is allowed.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter keeps a token bucket of the same Limit for every client. A bucket
+// is kept as the time it is full again, which is all the state it needs since
+// it refills at a constant rate. Buckets that have filled up again are
+// dropped, so idle clients cost nothing.
+type Limiter struct {
+	limit    Limit
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	fullAt    map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewLimiter returns a Limiter applying the limit, whose Requests and Per must
+// be positive, to every client. now is the clock the buckets are refilled by;
+// time.Now is used if it is nil.
+func NewLimiter(limit Limit, now func() time.Time) *Limiter {
+	if now == nil {
+		now = time.Now
+	}
+	return &Limiter{
+		limit:     limit,
+		interval:  limit.Per / time.Duration(limit.Requests),
+		now:       now,
+		fullAt:    make(map[string]time.Time),
+		lastSweep: now(),
+	}
+}
+
+// Take takes a request from the bucket of the client identified by key,
+// unless the bucket is empty.
+func (l *Limiter) Take(key string) Result {
+	return l.take(key, true)
+}
+
+// Peek tells whether a request could be taken from the bucket of the client
+// identified by key, without taking it.
+func (l *Limiter) Peek(key string) Result {
+	return l.take(key, false)
+}
+
+func (l *Limiter) take(key string, consume bool) Result {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	fullAt, exists := l.fullAt[key]
+	if !exists || fullAt.Before(now) {
+		fullAt = now
+	}
+
+	result := Result{Limit: l.limit.Requests}
+	// taking a request delays the time the bucket is full by one interval,
+	// which is only allowed while that is at most Per away
+	if next := fullAt.Add(l.interval); next.Sub(now) <= l.limit.Per {
+		if consume {
+			fullAt = next
+			l.fullAt[key] = fullAt
+		}
+		result.Allowed = true
+	} else {
+		result.RetryAfter = next.Sub(now) - l.limit.Per
+	}
+	result.Reset = fullAt.Sub(now)
+	result.Remaining = int((l.limit.Per - result.Reset) / l.interval)
+	return result
+}
+
+// sweep drops the buckets that are full at the given time, at most once every
+// Per. Callers must hold l.mu.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.limit.Per {
+		return
+	}
+	for key, fullAt := range l.fullAt {
+		if !fullAt.After(now) {
+			delete(l.fullAt, key)
+		}
+	}
+	l.lastSweep = now
+}
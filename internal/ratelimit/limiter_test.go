@@ -0,0 +1,77 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/ratelimit"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a clock that only moves when advanced.
+type fakeClock struct {
+	now time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func TestLimiter_Take(t *testing.T) {
+	clock := newFakeClock()
+	limiter := ratelimit.NewLimiter(ratelimit.Limit{Requests: 3, Per: time.Minute}, clock.Now)
+
+	// the bucket starts full and is used up in a burst
+	for remaining := 2; remaining >= 0; remaining-- {
+		result := limiter.Take("ann")
+		assert.True(t, result.Allowed)
+		assert.Equal(t, 3, result.Limit)
+		assert.Equal(t, remaining, result.Remaining)
+	}
+	result := limiter.Take("ann")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, 20*time.Second, result.RetryAfter)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	// other clients have buckets of their own
+	assert.True(t, limiter.Take("bob").Allowed)
+
+	// a request is refilled every 20 seconds
+	clock.Advance(19 * time.Second)
+	result = limiter.Take("ann")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Second, result.RetryAfter)
+	clock.Advance(time.Second)
+	result = limiter.Take("ann")
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+	assert.Equal(t, time.Minute, result.Reset)
+
+	// and never beyond the size of the bucket
+	clock.Advance(time.Hour)
+	result = limiter.Take("ann")
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 2, result.Remaining)
+	assert.Equal(t, 20*time.Second, result.Reset)
+}
+
+func TestLimiter_Peek(t *testing.T) {
+	clock := newFakeClock()
+	limiter := ratelimit.NewLimiter(ratelimit.Limit{Requests: 1, Per: time.Minute}, clock.Now)
+
+	// peeking takes nothing from the bucket
+	assert.True(t, limiter.Peek("ann").Allowed)
+	assert.True(t, limiter.Take("ann").Allowed)
+	result := limiter.Peek("ann")
+	assert.False(t, result.Allowed)
+	assert.Equal(t, time.Minute, result.RetryAfter)
+}
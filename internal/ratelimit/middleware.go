@@ -0,0 +1,123 @@
+package ratelimit
+
+import (
+	stderrors "errors"
+	"math"
+	"net"
+	"net/http"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/auth"
+
+	"github.com/courage173/quiz-api/internal/errors"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// Rule applies its own Limiter to the requests matching Method and Path. Path
+// is a pattern as understood by path.Match, so that "/v1/quizzes/*/submit"
+// matches the submissions of every quiz. An empty Method matches any method.
+type Rule struct {
+	Method  string
+	Path    string
+	Limiter *Limiter
+}
+
+// Handler returns a middleware that takes every request from the bucket of its
+// client in the Limiter of the first matching rule, or else in limiter. A nil
+// limiter leaves the requests matching no rule unlimited.
+//
+// Clients are told their limit in the RateLimit-Limit, RateLimit-Remaining
+// and RateLimit-Reset headers. Requests beyond it are rejected with 429 and a
+// Retry-After header.
+//
+// Clients are told apart by their API key or user, so the middleware must
+// come after the auth middlewares, and by their IP otherwise.
+func Handler(limiter *Limiter, rules ...Rule) routing.Handler {
+	return func(c *routing.Context) error {
+		current := limiter
+		for _, rule := range rules {
+			if rule.matches(c) {
+				current = rule.Limiter
+				break
+			}
+		}
+		if current == nil {
+			return nil
+		}
+
+		result := current.Take(clientKey(c))
+		header := c.Response.Header()
+		header.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		header.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("RateLimit-Reset", seconds(result.Reset))
+		if !result.Allowed {
+			header.Set("Retry-After", seconds(result.RetryAfter))
+			return errors.TooManyRequests("")
+		}
+		return nil
+	}
+}
+
+// FailureHandler returns a middleware that takes a request from the bucket of
+// the IP of every request rejected with 401, be it for an invalid token or API
+// key or a wrong password. Requests of IPs whose bucket is empty are rejected
+// with 429 before they are authenticated, so that credentials cannot be
+// guessed faster than the limit. It must come before the auth middlewares,
+// which reject invalid credentials before Handler sees the request.
+func FailureHandler(limiter *Limiter) routing.Handler {
+	return func(c *routing.Context) error {
+		key := ipKey(c)
+		if result := limiter.Peek(key); !result.Allowed {
+			c.Response.Header().Set("Retry-After", seconds(result.RetryAfter))
+			return errors.TooManyRequests("")
+		}
+
+		err := c.Next()
+		var response errors.ErrorResponse
+		if stderrors.As(err, &response) && response.Status == http.StatusUnauthorized {
+			limiter.Take(key)
+		}
+		return err
+	}
+}
+
+func (r Rule) matches(c *routing.Context) bool {
+	if r.Method != "" && r.Method != c.Request.Method {
+		return false
+	}
+	matched, _ := path.Match(r.Path, c.Request.URL.Path)
+	return matched
+}
+
+// clientKey identifies the client of the request: the API key it carries, the
+// user it is authenticated as or else its IP.
+func clientKey(c *routing.Context) string {
+	if principal, ok := auth.CurrentPrincipal(c.Request.Context()); ok {
+		switch {
+		case principal.KeyID != "":
+			return "key:" + principal.KeyID
+		case principal.UserID != "":
+			return "user:" + principal.UserID
+		default:
+			return "user:" + principal.UserName
+		}
+	}
+	return ipKey(c)
+}
+
+// ipKey identifies the client of the request by its IP.
+func ipKey(c *routing.Context) string {
+	host, _, err := net.SplitHostPort(c.Request.RemoteAddr)
+	if err != nil {
+		host = c.Request.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// seconds formats the duration as whole seconds, rounded up.
+func seconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,137 @@
+package ratelimit_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/auth"
+	"github.com/courage173/quiz-api/internal/errors"
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/ratelimit"
+	"github.com/courage173/quiz-api/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	clock := newFakeClock()
+	tokens := auth.NewTokens([]byte("secret"), 24*time.Hour)
+
+	router := routing.New()
+	router.Use(
+		errors.Handler(logger),
+		content.TypeNegotiator(content.JSON),
+		auth.Handler(tokens, nil, ""),
+		ratelimit.Handler(
+			ratelimit.NewLimiter(ratelimit.Limit{Requests: 3, Per: time.Minute}, clock.Now),
+			ratelimit.Rule{Method: "POST", Path: "/v1/quizzes/*/submit", Limiter: ratelimit.NewLimiter(ratelimit.Limit{Requests: 1, Per: time.Minute}, clock.Now)},
+		),
+	)
+	ok := func(c *routing.Context) error { return c.Write("ok") }
+	router.Get("/v1/quiz", ok)
+	router.Post("/v1/quizzes/<id>/submit", ok)
+
+	ann, _, err := tokens.Issue(models.User{ID: "u1", UserName: "ann"})
+	require.NoError(t, err)
+
+	do := func(method, url, ip, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, url, nil)
+		req.RemoteAddr = ip + ":1234"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	for remaining := 2; remaining >= 0; remaining-- {
+		resp := do("GET", "/v1/quiz", "10.0.0.1", "")
+		require.Equal(t, http.StatusOK, resp.Code)
+		assert.Equal(t, "3", resp.Header().Get("RateLimit-Limit"))
+		assert.Equal(t, strconv.Itoa(remaining), resp.Header().Get("RateLimit-Remaining"))
+	}
+
+	resp := do("GET", "/v1/quiz", "10.0.0.1", "")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "20", resp.Header().Get("Retry-After"))
+	assert.Equal(t, "60", resp.Header().Get("RateLimit-Reset"))
+	assert.Contains(t, resp.Body.String(), `"status":429`)
+
+	// other IPs and users are limited separately
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/quiz", "10.0.0.2", "").Code)
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/quiz", "10.0.0.1", ann).Code)
+
+	// submissions have a limit of their own, whatever the quiz
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/quizzes/general/submit", "10.0.0.1", ann).Code)
+	resp = do("POST", "/v1/quizzes/space/submit", "10.0.0.1", ann)
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "1", resp.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "60", resp.Header().Get("Retry-After"))
+
+	clock.Advance(time.Minute)
+	assert.Equal(t, http.StatusOK, do("GET", "/v1/quiz", "10.0.0.1", "").Code)
+	assert.Equal(t, http.StatusOK, do("POST", "/v1/quizzes/general/submit", "10.0.0.1", ann).Code)
+}
+
+type noKeys struct{}
+
+func (noKeys) Resolve(string) (auth.Principal, error) {
+	return auth.Principal{}, auth.ErrInvalidToken
+}
+
+func TestFailureHandler(t *testing.T) {
+	logger, _ := log.NewForTest()
+	clock := newFakeClock()
+	tokens := auth.NewTokens([]byte("secret"), 24*time.Hour)
+
+	router := routing.New()
+	router.Use(
+		errors.Handler(logger),
+		content.TypeNegotiator(content.JSON),
+		ratelimit.FailureHandler(ratelimit.NewLimiter(ratelimit.Limit{Requests: 3, Per: time.Minute}, clock.Now)),
+		auth.Handler(tokens, nil, "admin-secret"),
+		auth.APIKeyHandler(noKeys{}),
+	)
+	router.Get("/v1/quiz", func(c *routing.Context) error { return c.Write("ok") })
+
+	ann, _, err := tokens.Issue(models.User{ID: "u1", UserName: "ann"})
+	require.NoError(t, err)
+
+	do := func(ip, header, value string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/v1/quiz", nil)
+		req.RemoteAddr = ip + ":1234"
+		req.Header.Set(header, value)
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// successful authentications take nothing from the bucket
+	for i := 0; i < 5; i++ {
+		require.Equal(t, http.StatusOK, do("10.0.0.1", "Authorization", "Bearer "+ann).Code)
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, do("10.0.0.1", "Authorization", "Bearer guess-1").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("10.0.0.1", "Authorization", "Bearer guess-2").Code)
+	assert.Equal(t, http.StatusUnauthorized, do("10.0.0.1", auth.APIKeyHeader, "qk_guess").Code)
+
+	// guesses of tokens and API keys use up the same bucket, after which the
+	// IP is rejected before its credentials are checked
+	resp := do("10.0.0.1", "Authorization", "Bearer admin-secret")
+	assert.Equal(t, http.StatusTooManyRequests, resp.Code)
+	assert.Equal(t, "20", resp.Header().Get("Retry-After"))
+	assert.Equal(t, http.StatusTooManyRequests, do("10.0.0.1", auth.APIKeyHeader, "qk_guess").Code)
+
+	// other IPs are limited separately
+	assert.Equal(t, http.StatusUnauthorized, do("10.0.0.2", "Authorization", "Bearer guess-1").Code)
+
+	clock.Advance(20 * time.Second)
+	assert.Equal(t, http.StatusOK, do("10.0.0.1", "Authorization", "Bearer admin-secret").Code)
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+func (s *memoryStorage) CreateAPIKey(key models.APIKey) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.APIKeys[key.ID] = key
+	return nil
+}
+
+func (s *memoryStorage) GetAPIKeys() ([]models.APIKey, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	keys := make([]models.APIKey, 0, len(s.APIKeys))
+	for _, key := range s.APIKeys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Name != keys[j].Name {
+			return keys[i].Name < keys[j].Name
+		}
+		return keys[i].ID < keys[j].ID
+	})
+	return keys, nil
+}
+
+func (s *memoryStorage) GetAPIKeyByHash(hash string) (models.APIKey, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	for _, key := range s.APIKeys {
+		if key.Hash == hash {
+			return key, nil
+		}
+	}
+	return models.APIKey{}, ErrAPIKeyNotFound
+}
+
+func (s *memoryStorage) RevokeAPIKey(id string, at time.Time) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	key, exists := s.APIKeys[id]
+	if !exists {
+		return ErrAPIKeyNotFound
+	}
+	if key.RevokedAt == nil {
+		at = at.UTC()
+		key.RevokedAt = &at
+		s.APIKeys[id] = key
+	}
+	return nil
+}
@@ -0,0 +1,873 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/pkg/log"
+)
+
+const (
+	logFileName      = "submissions.log"
+	snapshotFileName = "snapshot.json"
+
+	// DefaultSnapshotInterval is the number of log records after which the log
+	// is compacted into a snapshot.
+	DefaultSnapshotInterval = 1000
+
+	// recordHeaderSize is the size of the length and checksum prefix of a log record.
+	recordHeaderSize = 8
+	// maxRecordSize bounds the payload length read from a record header, so a
+	// corrupted length is taken for a torn record rather than allocated.
+	maxRecordSize = 64 << 20
+
+	opAddSubmission = "add_submission"
+	opSetQuestions  = "set_questions"
+	opSetQuizzes    = "set_quizzes"
+	opSetBank       = "set_question_bank"
+	opCreateSession = "create_session"
+	opFinishSession = "finish_session"
+	opSubmitSession = "submit_session"
+	opCreateTeam    = "create_team"
+	opDeleteTeam    = "delete_team"
+	opAddMember     = "add_team_member"
+	opRemoveMember  = "remove_team_member"
+	opCreateUser    = "create_user"
+	opSetUserRole   = "set_user_role"
+	opCreateAPIKey  = "create_api_key"
+	opRevokeAPIKey  = "revoke_api_key"
+	opReserveKey    = "reserve_idempotency_key"
+	opCompleteKey   = "complete_idempotency_key"
+	opReleaseKey    = "release_idempotency_key"
+)
+
+// record is a single entry of the append-only log. Every record is stored as
+// a 4 byte payload length, a 4 byte CRC-32 checksum of the payload and the
+// JSON encoded payload itself.
+type record struct {
+	Seq  uint64          `json:"seq"`
+	Op   string          `json:"op"`
+	Data json.RawMessage `json:"data"`
+}
+
+// snapshot is the compacted state of the log up to and including Seq. The
+// ranking is rebuilt from the attempts on load so that the ranking policy can
+// change between restarts.
+type snapshot struct {
+	Seq      uint64                                `json:"seq"`
+	Version  int                                   `json:"version,omitempty"`
+	Versions map[int][]models.Question             `json:"versions,omitempty"`
+	Quizzes  map[string]models.Quiz                `json:"quizzes,omitempty"`
+	Attempts map[string]map[string][]models.Result `json:"attempts,omitempty"`
+	Sessions map[string]models.Session             `json:"sessions,omitempty"`
+	Teams    map[string]models.Team                `json:"teams,omitempty"`
+	Users    map[string]models.User                `json:"users,omitempty"`
+	APIKeys  map[string]models.APIKey              `json:"apiKeys,omitempty"`
+	// Idempotency may hold expired records, which are dropped by the next
+	// periodic sweep of a reservation.
+	Idempotency map[string]models.IdempotencyRecord `json:"idempotency,omitempty"`
+	// Submissions is only read from snapshots written before attempts were
+	// kept. Each of them becomes the first attempt of its user.
+	Submissions map[string]map[string]models.Result `json:"submissions,omitempty"`
+}
+
+// fileStorage is a Storage that keeps its state in memory and persists every
+// change to an append-only log before applying it. The log is periodically
+// compacted into a snapshot and both are replayed on startup.
+type fileStorage struct {
+	*memoryStorage
+
+	dir              string
+	snapshotInterval int
+	logger           log.Logger
+
+	mu      sync.Mutex
+	logFile *os.File
+	seq     uint64
+	pending int
+}
+
+// NewFileStorage opens the file storage kept in dir, creating it if needed, and
+// restores its state from the snapshot and log found there. A torn record at
+// the end of the log, as left behind by a crash, is discarded.
+func NewFileStorage(dir string, snapshotInterval int, policy RankingPolicy, logger log.Logger) (Storage, error) {
+	if snapshotInterval <= 0 {
+		snapshotInterval = DefaultSnapshotInterval
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating data directory: %w", err)
+	}
+
+	s := &fileStorage{
+		memoryStorage:    NewStorage(policy).(*memoryStorage),
+		dir:              dir,
+		snapshotInterval: snapshotInterval,
+		logger:           logger,
+	}
+
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replayLog(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// AddUserSubmission logs the submission with its attempt number and time so
+// that replaying it restores the same attempt.
+func (s *fileStorage) AddUserSubmission(submission models.Result) (models.Result, error) {
+	return s.AddLimitedSubmission(submission, AttemptLimits{})
+}
+
+// AddLimitedSubmission checks the limits under the log lock, which every
+// submission takes, and only logs the submissions that pass them.
+func (s *fileStorage) AddLimitedSubmission(submission models.Result, limits AttemptLimits) (models.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if submission.SubmittedAt.IsZero() {
+		submission.SubmittedAt = time.Now().UTC()
+	}
+	s.Mutex.RLock()
+	attempts := s.Attempts[submission.QuizID][submission.UserName]
+	submission.Attempt = len(attempts) + 1
+	err := limits.checkAttempts(attempts, submission.SubmittedAt)
+	s.Mutex.RUnlock()
+	if err != nil {
+		return models.Result{}, err
+	}
+
+	if err := s.commitLocked(opAddSubmission, submission); err != nil {
+		return models.Result{}, err
+	}
+	return submission, nil
+}
+
+// sessionSubmission is the log record of AddSessionSubmission.
+type sessionSubmission struct {
+	SessionID  string        `json:"sessionId"`
+	Submission models.Result `json:"submission"`
+}
+
+// AddSessionSubmission logs the submission and the session it finishes as a
+// single record, once both the session and the limits are checked.
+func (s *fileStorage) AddSessionSubmission(sessionID string, submission models.Result, limits AttemptLimits) (models.Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if submission.SubmittedAt.IsZero() {
+		submission.SubmittedAt = time.Now().UTC()
+	}
+	s.Mutex.RLock()
+	err := s.checkSession(sessionID)
+	attempts := s.Attempts[submission.QuizID][submission.UserName]
+	submission.Attempt = len(attempts) + 1
+	if err == nil {
+		err = limits.checkAttempts(attempts, submission.SubmittedAt)
+	}
+	s.Mutex.RUnlock()
+	if err != nil {
+		return models.Result{}, err
+	}
+
+	if err := s.commitLocked(opSubmitSession, sessionSubmission{SessionID: sessionID, Submission: submission}); err != nil {
+		return models.Result{}, err
+	}
+	return submission, nil
+}
+
+// SetQuestions logs the complete question set, which replays as a new
+// version.
+func (s *fileStorage) SetQuestions(questions []models.Question) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.commitLocked(opSetQuestions, questions); err != nil {
+		return 0, err
+	}
+	return s.currentVersion(), nil
+}
+
+func (s *fileStorage) SetQuizzes(quizzes []models.Quiz) error {
+	return s.commit(opSetQuizzes, quizzes)
+}
+
+type questionBank struct {
+	Questions []models.Question `json:"questions"`
+	Quizzes   []models.Quiz     `json:"quizzes"`
+}
+
+// SetQuestionBank logs the question set and the quizzes as a single record,
+// so that a crash never leaves one without the other.
+func (s *fileStorage) SetQuestionBank(questions []models.Question, quizzes []models.Quiz) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.commitLocked(opSetBank, questionBank{Questions: questions, Quizzes: quizzes}); err != nil {
+		return 0, err
+	}
+	return s.currentVersion(), nil
+}
+
+func (s *fileStorage) CreateQuestion(question models.Question) (models.Question, error) {
+	var created models.Question
+	err := s.mutateQuestions(func(questions []models.Question) ([]models.Question, error) {
+		next, question, err := createQuestion(questions, question)
+		created = question
+		return next, err
+	})
+	return created, err
+}
+
+func (s *fileStorage) UpdateQuestion(question models.Question) error {
+	return s.mutateQuestions(func(questions []models.Question) ([]models.Question, error) {
+		return updateQuestion(questions, question)
+	})
+}
+
+func (s *fileStorage) ModifyQuestion(id int, fn func(question models.Question) (models.Question, error)) (models.Question, error) {
+	var modified models.Question
+	err := s.mutateQuestions(func(questions []models.Question) ([]models.Question, error) {
+		next, question, err := modifyQuestion(questions, id, fn)
+		modified = question
+		return next, err
+	})
+	return modified, err
+}
+
+// DeleteQuestion checks the quizzes under the log lock, which every change to
+// them takes as well.
+func (s *fileStorage) DeleteQuestion(id int) error {
+	return s.mutateQuestions(func(questions []models.Question) ([]models.Question, error) {
+		return deleteUnusedQuestion(questions, s.GetQuizzes(), id)
+	})
+}
+
+func (s *fileStorage) ReorderQuestions(ids []int) error {
+	return s.mutateQuestions(func(questions []models.Question) ([]models.Question, error) {
+		return reorderQuestions(questions, ids)
+	})
+}
+
+func (s *fileStorage) CreateSession(session models.Session) error {
+	return s.commit(opCreateSession, session)
+}
+
+// finishedSession is the log record sessions used to be finished with,
+// apart from their submission.
+type finishedSession struct {
+	ID         string    `json:"id"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
+
+// teamMember is the log record of AddTeamMember and RemoveTeamMember.
+type teamMember struct {
+	TeamID   string `json:"teamId"`
+	UserName string `json:"userName"`
+}
+
+// CreateTeam, like the other team changes, is checked against the current
+// state before it is logged, so that replaying the log never fails.
+func (s *fileStorage) CreateTeam(team models.Team) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.GetTeam(team.ID); err == nil {
+		return ErrTeamExists
+	}
+	return s.commitLocked(opCreateTeam, team)
+}
+
+func (s *fileStorage) DeleteTeam(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.GetTeam(id); err != nil {
+		return err
+	}
+	return s.commitLocked(opDeleteTeam, id)
+}
+
+func (s *fileStorage) AddTeamMember(teamID, userName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.GetTeam(teamID); err != nil {
+		return err
+	}
+	return s.commitLocked(opAddMember, teamMember{TeamID: teamID, UserName: userName})
+}
+
+func (s *fileStorage) RemoveTeamMember(teamID, userName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	team, err := s.GetTeam(teamID)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(team.Members, userName) {
+		return ErrMemberNotFound
+	}
+	return s.commitLocked(opRemoveMember, teamMember{TeamID: teamID, UserName: userName})
+}
+
+// CreateUser is checked against the current users before it is logged, as
+// the team changes are.
+func (s *fileStorage) CreateUser(user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.GetUser(user.ID); err == nil {
+		return ErrUserExists
+	}
+	if _, err := s.GetUserByName(user.UserName); err == nil {
+		return ErrUserExists
+	}
+	s.Mutex.RLock()
+	used := s.hasAttempts(user.UserName)
+	s.Mutex.RUnlock()
+	if used {
+		return ErrUserNameUsed
+	}
+	return s.commitLocked(opCreateUser, user)
+}
+
+// userRole is the log record of SetUserRole.
+type userRole struct {
+	ID   string      `json:"id"`
+	Role models.Role `json:"role"`
+}
+
+func (s *fileStorage) SetUserRole(id string, role models.Role) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, err := s.GetUser(id); err != nil {
+		return err
+	}
+	return s.commitLocked(opSetUserRole, userRole{ID: id, Role: role})
+}
+
+func (s *fileStorage) CreateAPIKey(key models.APIKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commitLocked(opCreateAPIKey, key)
+}
+
+// apiKeyRevocation is the log record of RevokeAPIKey.
+type apiKeyRevocation struct {
+	ID string    `json:"id"`
+	At time.Time `json:"at"`
+}
+
+func (s *fileStorage) RevokeAPIKey(id string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Mutex.RLock()
+	_, exists := s.APIKeys[id]
+	s.Mutex.RUnlock()
+	if !exists {
+		return ErrAPIKeyNotFound
+	}
+	return s.commitLocked(opRevokeAPIKey, apiKeyRevocation{ID: id, At: at})
+}
+
+// idempotencyReservation is the log record of ReserveIdempotencyKey. Now is
+// logged so that replaying it drops the same expired records.
+type idempotencyReservation struct {
+	Record models.IdempotencyRecord `json:"record"`
+	Now    time.Time                `json:"now"`
+}
+
+// ReserveIdempotencyKey is checked against the current records before it is
+// logged, so that only reservations that succeed are.
+func (s *fileStorage) ReserveIdempotencyKey(record models.IdempotencyRecord, now time.Time) (models.IdempotencyRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Mutex.RLock()
+	existing, exists := s.Idempotency[record.Key]
+	s.Mutex.RUnlock()
+	if exists && existing.ExpiresAt.After(now) {
+		return existing, ErrIdempotencyKeyUsed
+	}
+	if err := s.commitLocked(opReserveKey, idempotencyReservation{Record: record, Now: now}); err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+	return record, nil
+}
+
+// idempotencyCompletion is the log record of CompleteIdempotencyKey.
+type idempotencyCompletion struct {
+	Key       string    `json:"key"`
+	Response  []byte    `json:"response"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+func (s *fileStorage) CompleteIdempotencyKey(key string, response []byte, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commitLocked(opCompleteKey, idempotencyCompletion{Key: key, Response: response, ExpiresAt: expiresAt})
+}
+
+func (s *fileStorage) ReleaseIdempotencyKey(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commitLocked(opReleaseKey, key)
+}
+
+// mutateQuestions derives a new question set from the current one using fn
+// and logs it. Holding the log lock keeps concurrent changes from deriving
+// from the same version.
+func (s *fileStorage) mutateQuestions(fn func(questions []models.Question) ([]models.Question, error)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	questions, err := fn(s.GetQuestions())
+	if err != nil {
+		return err
+	}
+	return s.commitLocked(opSetQuestions, questions)
+}
+
+func (s *fileStorage) currentVersion() int {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+	return s.Version
+}
+
+// Close compacts the log into a snapshot and closes the log file.
+func (s *fileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending > 0 {
+		if err := s.compact(); err != nil {
+			s.logger.Errorf("Error compacting log on close: %v", err)
+		}
+	}
+	return s.logFile.Close()
+}
+
+// commit appends the operation to the log, syncs it to disk and then applies
+// it to the in-memory state.
+func (s *fileStorage) commit(op string, value interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.commitLocked(op, value)
+}
+
+// commitLocked is commit for callers already holding s.mu.
+func (s *fileStorage) commitLocked(op string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	rec := record{Seq: s.seq + 1, Op: op, Data: data}
+	if err := s.appendRecord(rec); err != nil {
+		return err
+	}
+	s.seq = rec.Seq
+	s.pending++
+
+	if err := s.apply(rec); err != nil {
+		return err
+	}
+
+	if s.pending >= s.snapshotInterval {
+		// the record is already durable, so a failed compaction is retried
+		// on the next write rather than failing this one
+		if err := s.compact(); err != nil {
+			s.logger.Errorf("Error compacting log: %v", err)
+		}
+	}
+	return nil
+}
+
+// apply replays a single log record against the in-memory state.
+func (s *fileStorage) apply(rec record) error {
+	switch rec.Op {
+	case opAddSubmission:
+		var submission models.Result
+		if err := json.Unmarshal(rec.Data, &submission); err != nil {
+			return err
+		}
+		_, err := s.memoryStorage.AddUserSubmission(upgradeResult(submission))
+		return err
+	case opSetQuestions:
+		var questions []models.Question
+		if err := json.Unmarshal(rec.Data, &questions); err != nil {
+			return err
+		}
+		_, err := s.memoryStorage.SetQuestions(questions)
+		return err
+	case opSetQuizzes:
+		var quizzes []models.Quiz
+		if err := json.Unmarshal(rec.Data, &quizzes); err != nil {
+			return err
+		}
+		return s.memoryStorage.SetQuizzes(quizzes)
+	case opSetBank:
+		var bank questionBank
+		if err := json.Unmarshal(rec.Data, &bank); err != nil {
+			return err
+		}
+		_, err := s.memoryStorage.SetQuestionBank(bank.Questions, bank.Quizzes)
+		return err
+	case opCreateSession:
+		var session models.Session
+		if err := json.Unmarshal(rec.Data, &session); err != nil {
+			return err
+		}
+		return s.memoryStorage.CreateSession(session)
+	case opFinishSession:
+		var finished finishedSession
+		if err := json.Unmarshal(rec.Data, &finished); err != nil {
+			return err
+		}
+		s.Mutex.Lock()
+		err := s.checkSession(finished.ID)
+		if err == nil {
+			s.finishSession(finished.ID, finished.FinishedAt)
+		}
+		s.Mutex.Unlock()
+		return err
+	case opSubmitSession:
+		var submission sessionSubmission
+		if err := json.Unmarshal(rec.Data, &submission); err != nil {
+			return err
+		}
+		_, err := s.memoryStorage.AddSessionSubmission(submission.SessionID, submission.Submission, AttemptLimits{})
+		return err
+	case opCreateTeam:
+		var team models.Team
+		if err := json.Unmarshal(rec.Data, &team); err != nil {
+			return err
+		}
+		return s.memoryStorage.CreateTeam(team)
+	case opDeleteTeam:
+		var id string
+		if err := json.Unmarshal(rec.Data, &id); err != nil {
+			return err
+		}
+		return s.memoryStorage.DeleteTeam(id)
+	case opAddMember:
+		var member teamMember
+		if err := json.Unmarshal(rec.Data, &member); err != nil {
+			return err
+		}
+		return s.memoryStorage.AddTeamMember(member.TeamID, member.UserName)
+	case opRemoveMember:
+		var member teamMember
+		if err := json.Unmarshal(rec.Data, &member); err != nil {
+			return err
+		}
+		return s.memoryStorage.RemoveTeamMember(member.TeamID, member.UserName)
+	case opCreateUser:
+		var user models.User
+		if err := json.Unmarshal(rec.Data, &user); err != nil {
+			return err
+		}
+		return s.memoryStorage.CreateUser(user)
+	case opSetUserRole:
+		var role userRole
+		if err := json.Unmarshal(rec.Data, &role); err != nil {
+			return err
+		}
+		return s.memoryStorage.SetUserRole(role.ID, role.Role)
+	case opCreateAPIKey:
+		var key models.APIKey
+		if err := json.Unmarshal(rec.Data, &key); err != nil {
+			return err
+		}
+		return s.memoryStorage.CreateAPIKey(key)
+	case opRevokeAPIKey:
+		var revocation apiKeyRevocation
+		if err := json.Unmarshal(rec.Data, &revocation); err != nil {
+			return err
+		}
+		return s.memoryStorage.RevokeAPIKey(revocation.ID, revocation.At)
+	case opReserveKey:
+		var reservation idempotencyReservation
+		if err := json.Unmarshal(rec.Data, &reservation); err != nil {
+			return err
+		}
+		_, err := s.memoryStorage.ReserveIdempotencyKey(reservation.Record, reservation.Now)
+		return err
+	case opCompleteKey:
+		var completion idempotencyCompletion
+		if err := json.Unmarshal(rec.Data, &completion); err != nil {
+			return err
+		}
+		return s.memoryStorage.CompleteIdempotencyKey(completion.Key, completion.Response, completion.ExpiresAt)
+	case opReleaseKey:
+		var key string
+		if err := json.Unmarshal(rec.Data, &key); err != nil {
+			return err
+		}
+		return s.memoryStorage.ReleaseIdempotencyKey(key)
+	default:
+		return fmt.Errorf("unknown log operation %q", rec.Op)
+	}
+}
+
+func (s *fileStorage) appendRecord(rec record) error {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+	copy(buf[recordHeaderSize:], payload)
+
+	offset, err := s.logFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("appending to log: %w", err)
+	}
+	if _, err := s.logFile.Write(buf); err != nil {
+		return s.truncateLog(offset, fmt.Errorf("appending to log: %w", err))
+	}
+	if err := s.logFile.Sync(); err != nil {
+		return s.truncateLog(offset, fmt.Errorf("syncing log: %w", err))
+	}
+	return nil
+}
+
+// truncateLog cuts the log back to offset after a failed append, so that the
+// next record is not written after a partial one, and returns cause.
+func (s *fileStorage) truncateLog(offset int64, cause error) error {
+	if err := s.logFile.Truncate(offset); err != nil {
+		return errors.Join(cause, fmt.Errorf("truncating log: %w", err))
+	}
+	if _, err := s.logFile.Seek(offset, io.SeekStart); err != nil {
+		return errors.Join(cause, fmt.Errorf("truncating log: %w", err))
+	}
+	return cause
+}
+
+func (s *fileStorage) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("decoding snapshot: %w", err)
+	}
+
+	s.seq = snap.Seq
+	if snap.Version > 0 && snap.Versions[snap.Version] != nil {
+		s.Version = snap.Version
+		s.Versions = snap.Versions
+		s.Questions = snap.Versions[snap.Version]
+	}
+	if snap.Quizzes != nil {
+		s.Quizzes = snap.Quizzes
+	}
+	if snap.Attempts != nil {
+		s.Attempts = snap.Attempts
+	}
+	for _, users := range s.Attempts {
+		for _, attempts := range users {
+			for i := range attempts {
+				attempts[i] = upgradeResult(attempts[i])
+			}
+		}
+	}
+	if snap.Sessions != nil {
+		s.Sessions = snap.Sessions
+	}
+	if snap.Teams != nil {
+		s.Teams = snap.Teams
+	}
+	if snap.Users != nil {
+		s.Users = snap.Users
+	}
+	if snap.APIKeys != nil {
+		s.APIKeys = snap.APIKeys
+	}
+	if snap.Idempotency != nil {
+		s.Idempotency = snap.Idempotency
+	}
+	for quizID, users := range snap.Submissions {
+		if s.Attempts[quizID] == nil {
+			s.Attempts[quizID] = make(map[string][]models.Result, len(users))
+		}
+		for userName, submission := range users {
+			submission.Attempt = 1
+			s.Attempts[quizID][userName] = []models.Result{upgradeResult(submission)}
+		}
+	}
+	s.rebuildRanking()
+	return nil
+}
+
+// upgradeResult fills in the maximum score and percentage of results logged
+// before scores were weighted, when every answer was worth one point.
+func upgradeResult(result models.Result) models.Result {
+	if result.MaxScore == 0 && result.TotalQuestionAnswered > 0 {
+		result.MaxScore = float64(result.TotalQuestionAnswered)
+		result.Percentage = models.Percentage(result.Score, result.MaxScore)
+	}
+	return result
+}
+
+// replayLog applies every complete record of the log newer than the snapshot
+// and truncates the log after the last valid record.
+func (s *fileStorage) replayLog() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, logFileName), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return fmt.Errorf("opening log: %w", err)
+	}
+
+	reader := bufio.NewReader(f)
+	var offset int64
+	for {
+		rec, size, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			s.logger.Infof("Discarding torn log record at offset %d: %v", offset, err)
+			break
+		}
+		offset += size
+
+		if rec.Seq <= s.seq {
+			// already part of the snapshot
+			continue
+		}
+		if err := s.apply(rec); err != nil {
+			s.logger.Errorf("Error replaying log record %d: %v", rec.Seq, err)
+		}
+		s.seq = rec.Seq
+		s.pending++
+	}
+
+	if err := f.Truncate(offset); err != nil {
+		f.Close()
+		return fmt.Errorf("truncating log: %w", err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return fmt.Errorf("seeking log: %w", err)
+	}
+	s.logFile = f
+	return nil
+}
+
+// readRecord reads the next record from r and returns it with its size on
+// disk. io.EOF is returned only when r ends exactly on a record boundary.
+func readRecord(r io.Reader) (record, int64, error) {
+	header := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return record{}, 0, io.EOF
+	}
+	if err != nil {
+		return record{}, 0, fmt.Errorf("short header (%d bytes): %w", n, err)
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+	if length > maxRecordSize {
+		return record{}, 0, fmt.Errorf("record length %d exceeds %d bytes", length, maxRecordSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return record{}, 0, fmt.Errorf("short payload: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return record{}, 0, errors.New("checksum mismatch")
+	}
+
+	var rec record
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return record{}, 0, err
+	}
+	return rec, int64(recordHeaderSize) + int64(length), nil
+}
+
+// compact writes the current state to a new snapshot and empties the log. The
+// snapshot is written to a temporary file and renamed so that a crash never
+// leaves a partially written snapshot behind. Records already covered by the
+// snapshot are skipped on replay should the crash happen before truncation.
+func (s *fileStorage) compact() error {
+	s.Mutex.RLock()
+	data, err := json.Marshal(snapshot{
+		Seq:         s.seq,
+		Version:     s.Version,
+		Versions:    s.Versions,
+		Quizzes:     s.Quizzes,
+		Attempts:    s.Attempts,
+		Sessions:    s.Sessions,
+		Teams:       s.Teams,
+		Users:       s.Users,
+		APIKeys:     s.APIKeys,
+		Idempotency: s.Idempotency,
+	})
+	s.Mutex.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, snapshotFileName+".tmp")
+	if err := writeFileSync(tmp, data); err != nil {
+		return fmt.Errorf("writing snapshot: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("renaming snapshot: %w", err)
+	}
+
+	if err := s.logFile.Truncate(0); err != nil {
+		return fmt.Errorf("truncating log: %w", err)
+	}
+	if _, err := s.logFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking log: %w", err)
+	}
+	s.pending = 0
+	return nil
+}
+
+func writeFileSync(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,432 @@
+package storage_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func openFileStorage(t *testing.T, dir string, snapshotInterval int) storage.Storage {
+	return openRankedFileStorage(t, dir, snapshotInterval, storage.RankLatest)
+}
+
+func openRankedFileStorage(t *testing.T, dir string, snapshotInterval int, policy storage.RankingPolicy) storage.Storage {
+	logger, _ := log.NewForTest()
+	store, err := storage.NewFileStorage(dir, snapshotInterval, policy, logger)
+	require.NoError(t, err)
+	return store
+}
+
+func closeStorage(t *testing.T, store storage.Storage) {
+	require.NoError(t, store.(io.Closer).Close())
+}
+
+func TestFileStorage_ReplaysLogOnStartup(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 5, MaxScore: 10, Percentage: 50, TotalQuestionAnswered: 10})
+	stored := addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User2", Score: 8, MaxScore: 10, Percentage: 80, TotalQuestionAnswered: 10})
+
+	// reopen without closing to simulate a crash that skipped compaction
+	reopened := openFileStorage(t, dir, 100)
+	defer closeStorage(t, reopened)
+
+	submission, err := reopened.GetUserSubmission(models.DefaultQuizID, "User2")
+	assert.NoError(t, err)
+	assert.Equal(t, stored, submission)
+	assert.Equal(t, 1, standing(t, reopened, models.DefaultQuizID, models.Window{}, 80).Rank)
+}
+
+func TestFileStorage_RecoversFromTornRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 5, MaxScore: 10, Percentage: 50})
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User2", Score: 7, MaxScore: 10, Percentage: 70})
+
+	// chop the last record in half as if the process died mid-write
+	logPath := filepath.Join(dir, "submissions.log")
+	info, err := os.Stat(logPath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(logPath, info.Size()-5))
+
+	reopened := openFileStorage(t, dir, 100)
+
+	_, err = reopened.GetUserSubmission(models.DefaultQuizID, "User1")
+	assert.NoError(t, err)
+	_, err = reopened.GetUserSubmission(models.DefaultQuizID, "User2")
+	assert.EqualError(t, err, "submission not found")
+
+	// new writes must land after the last valid record
+	addSubmission(t, reopened, models.Result{QuizID: models.DefaultQuizID, UserName: "User3", Score: 9, MaxScore: 10, Percentage: 90})
+
+	again := openFileStorage(t, dir, 100)
+	defer closeStorage(t, again)
+
+	_, err = again.GetUserSubmission(models.DefaultQuizID, "User3")
+	assert.NoError(t, err)
+}
+
+func TestFileStorage_RecoversFromTornHeader(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 5, MaxScore: 10, Percentage: 50})
+
+	logPath := filepath.Join(dir, "submissions.log")
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0, 0, 1})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened := openFileStorage(t, dir, 100)
+	defer closeStorage(t, reopened)
+
+	_, err = reopened.GetUserSubmission(models.DefaultQuizID, "User1")
+	assert.NoError(t, err)
+}
+
+func TestFileStorage_RecoversFromCorruptedLength(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 5, MaxScore: 10, Percentage: 50})
+
+	// a header claiming a huge payload must not be allocated
+	logPath := filepath.Join(dir, "submissions.log")
+	valid, err := os.Stat(logPath)
+	require.NoError(t, err)
+	f, err := os.OpenFile(logPath, os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	reopened := openFileStorage(t, dir, 100)
+	defer closeStorage(t, reopened)
+
+	_, err = reopened.GetUserSubmission(models.DefaultQuizID, "User1")
+	assert.NoError(t, err)
+	info, err := os.Stat(logPath)
+	require.NoError(t, err)
+	assert.Equal(t, valid.Size(), info.Size())
+}
+
+func TestFileStorage_CompactsIntoSnapshot(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 2)
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 5, MaxScore: 10, Percentage: 50})
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User2", Score: 7, MaxScore: 10, Percentage: 70})
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User3", Score: 8, MaxScore: 10, Percentage: 80})
+
+	_, err := os.Stat(filepath.Join(dir, "snapshot.json"))
+	assert.NoError(t, err)
+
+	reopened := openFileStorage(t, dir, 2)
+	defer closeStorage(t, reopened)
+
+	for _, userName := range []string{"User1", "User2", "User3"} {
+		_, err := reopened.GetUserSubmission(models.DefaultQuizID, userName)
+		assert.NoError(t, err)
+	}
+	assert.Equal(t, 50.0, standing(t, reopened, models.DefaultQuizID, models.Window{}, 70).Percentile())
+}
+
+func TestFileStorage_QuestionCRUD(t *testing.T) {
+	store := openFileStorage(t, t.TempDir(), 100)
+	defer closeStorage(t, store)
+
+	testQuestionCRUD(t, store)
+}
+
+func TestFileStorage_PersistsQuestionsAndQuizzes(t *testing.T) {
+	for _, snapshotInterval := range []int{1, 100} {
+		t.Run(fmt.Sprintf("snapshot interval %d", snapshotInterval), func(t *testing.T) {
+			dir := t.TempDir()
+
+			store := openFileStorage(t, dir, snapshotInterval)
+			created, err := store.CreateQuestion(models.Question{Text: "New", Options: []models.Option{
+				{ID: 1, Text: "A", IsCorrect: true}, {ID: 2, Text: "B"},
+			}})
+			require.NoError(t, err)
+			require.NoError(t, store.DeleteQuestion(1))
+			require.NoError(t, store.SetQuizzes([]models.Quiz{{ID: "space", Title: "Space", QuestionIDs: []int{created.ID}}}))
+			closeStorage(t, store)
+
+			reopened := openFileStorage(t, dir, snapshotInterval)
+			defer closeStorage(t, reopened)
+
+			current, err := reopened.GetQuestionSet(0)
+			require.NoError(t, err)
+			assert.Equal(t, 3, current.Version)
+			assert.Len(t, current.Questions, 10)
+			assert.Equal(t, created, current.Questions[9])
+
+			_, err = reopened.GetQuestionSet(1)
+			assert.NoError(t, err)
+
+			quiz, err := reopened.GetQuiz("space")
+			require.NoError(t, err)
+			assert.Equal(t, []int{created.ID}, quiz.QuestionIDs)
+		})
+	}
+}
+
+func TestFileStorage_QuestionsInUse(t *testing.T) {
+	store := openFileStorage(t, t.TempDir(), 100)
+	defer closeStorage(t, store)
+
+	testQuestionsInUse(t, store)
+}
+
+func TestFileStorage_QuestionBank(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	testQuestionBank(t, store)
+
+	// reopen without closing so that the bank is replayed from the log
+	reopened := openFileStorage(t, dir, 100)
+	defer closeStorage(t, reopened)
+
+	quiz, err := reopened.GetQuiz("space")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, quiz.QuestionIDs)
+	assert.Len(t, reopened.GetQuestions(), 1)
+}
+
+func TestFileStorage_Attempts(t *testing.T) {
+	testAttempts(t, func(policy storage.RankingPolicy) storage.Storage {
+		store := openRankedFileStorage(t, t.TempDir(), 100, policy)
+		t.Cleanup(func() { closeStorage(t, store) })
+		return store
+	})
+}
+
+func TestFileStorage_ChangingRankingPolicyReranks(t *testing.T) {
+	for _, snapshotInterval := range []int{1, 100} {
+		t.Run(fmt.Sprintf("snapshot interval %d", snapshotInterval), func(t *testing.T) {
+			dir := t.TempDir()
+
+			store := openRankedFileStorage(t, dir, snapshotInterval, storage.RankLatest)
+			addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 9, MaxScore: 10, Percentage: 90})
+			addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 3, MaxScore: 10, Percentage: 30})
+			addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User2", Score: 6, MaxScore: 10, Percentage: 60})
+			closeStorage(t, store)
+
+			reopened := openRankedFileStorage(t, dir, snapshotInterval, storage.RankBest)
+			defer closeStorage(t, reopened)
+
+			attempts, err := reopened.GetUserAttempts(models.DefaultQuizID, "User1")
+			require.NoError(t, err)
+			assert.Len(t, attempts, 2)
+
+			ranked, err := reopened.GetUserSubmission(models.DefaultQuizID, "User1")
+			require.NoError(t, err)
+			assert.Equal(t, 1, ranked.Attempt)
+			assert.Equal(t, 1, standing(t, reopened, models.DefaultQuizID, models.Window{}, 90).Rank)
+			assert.Equal(t, 2, standing(t, reopened, models.DefaultQuizID, models.Window{}, 60).Rank)
+		})
+	}
+}
+
+func TestFileStorage_UpgradesUnweightedScores(t *testing.T) {
+	dir := t.TempDir()
+	snapshot := `{"seq": 1, "attempts": {"default": {"User1": [
+		{"quizId": "default", "userName": "User1", "attempt": 1, "score": 4, "totalQuestionAnswered": 5}
+	]}}}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "snapshot.json"), []byte(snapshot), 0o644))
+
+	store := openFileStorage(t, dir, 100)
+	defer closeStorage(t, store)
+
+	submission, err := store.GetUserSubmission(models.DefaultQuizID, "User1")
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, submission.MaxScore)
+	assert.Equal(t, 80.0, submission.Percentage)
+}
+
+func TestFileStorage_ConcurrentSubmissions(t *testing.T) {
+	store := openFileStorage(t, t.TempDir(), 10)
+	defer closeStorage(t, store)
+
+	testConcurrentSubmissions(t, store)
+}
+
+func TestFileStorage_AttemptLimits(t *testing.T) {
+	store := openFileStorage(t, t.TempDir(), 100)
+	defer closeStorage(t, store)
+
+	testAttemptLimits(t, store)
+}
+
+func TestFileStorage_Leaderboard(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 3)
+	testLeaderboard(t, store)
+	closeStorage(t, store)
+
+	// the leaderboard is rebuilt from the snapshot and the log
+	reopened := openFileStorage(t, dir, 3)
+	defer closeStorage(t, reopened)
+
+	entries, err := reopened.GetLeaderboard(models.DefaultQuizID, models.Window{}, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 6)
+	assert.Equal(t, "A", entries[0].UserName)
+	assert.Equal(t, 6, entries[5].Rank)
+}
+
+func TestFileStorage_LeaderboardWindows(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 4)
+	testLeaderboardWindows(t, store)
+	closeStorage(t, store)
+
+	// windows are ranked from the attempts restored from the snapshot and the log
+	reopened := openFileStorage(t, dir, 4)
+	defer closeStorage(t, reopened)
+
+	day := time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	entries, err := reopened.GetLeaderboard(models.DefaultQuizID, models.Window{From: day, To: day.Add(24 * time.Hour)}, nil, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "C", entries[0].UserName)
+	assert.Equal(t, 60.0, entries[0].Percentage)
+	assert.Equal(t, "D", entries[2].UserName)
+}
+
+func TestFileStorage_Sessions(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	testSessions(t, store)
+	closeStorage(t, store)
+
+	reopened := openFileStorage(t, dir, 100)
+	defer closeStorage(t, reopened)
+
+	session, err := reopened.GetSession("abc")
+	require.NoError(t, err)
+	assert.NotNil(t, session.FinishedAt)
+	attempts, err := reopened.GetUserAttempts(models.DefaultQuizID, "User1")
+	require.NoError(t, err)
+	assert.Len(t, attempts, 2)
+}
+
+func TestFileStorage_SessionVersions(t *testing.T) {
+	store := openFileStorage(t, t.TempDir(), 100)
+	defer closeStorage(t, store)
+	testSessionVersions(t, store)
+}
+
+func TestFileStorage_Teams(t *testing.T) {
+	dir := t.TempDir()
+	want := []models.Team{
+		{ID: "blue", Name: "Blue", Members: []string{"Ann", "Cid"}},
+		{ID: "red", Name: "Red", Members: []string{"Ann"}},
+	}
+
+	store := openFileStorage(t, dir, 100)
+	testTeams(t, store)
+
+	// reopen without closing to replay the team changes from the log
+	reopened := openFileStorage(t, dir, 100)
+	teams, err := reopened.GetTeams()
+	require.NoError(t, err)
+	assert.Equal(t, want, teams)
+	closeStorage(t, reopened)
+
+	// and once more from the snapshot written on close
+	again := openFileStorage(t, dir, 100)
+	defer closeStorage(t, again)
+	teams, err = again.GetTeams()
+	require.NoError(t, err)
+	assert.Equal(t, want, teams)
+}
+
+func TestFileStorage_Users(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	testUsers(t, store)
+
+	// reopen without closing to replay the users from the log
+	reopened := openFileStorage(t, dir, 100)
+	user, err := reopened.GetUserByName("Ann")
+	require.NoError(t, err)
+	assert.Equal(t, "hash", user.PasswordHash)
+	assert.Equal(t, models.RoleAuthor, user.Role)
+	closeStorage(t, reopened)
+
+	// and once more from the snapshot written on close
+	again := openFileStorage(t, dir, 100)
+	defer closeStorage(t, again)
+	user, err = again.GetUser("u1")
+	require.NoError(t, err)
+	assert.Equal(t, "Ann", user.UserName)
+	assert.Equal(t, models.RoleAuthor, user.Role)
+	submission, err := again.GetUserSubmission(models.DefaultQuizID, "Ann")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", submission.UserID)
+}
+
+func TestFileStorage_APIKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	testAPIKeys(t, store)
+
+	// reopen without closing to replay the keys from the log
+	reopened := openFileStorage(t, dir, 100)
+	key, err := reopened.GetAPIKeyByHash("hash1")
+	require.NoError(t, err)
+	require.NotNil(t, key.RevokedAt)
+	closeStorage(t, reopened)
+
+	// and once more from the snapshot written on close
+	again := openFileStorage(t, dir, 100)
+	defer closeStorage(t, again)
+	keys, err := again.GetAPIKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, []models.Scope{models.ScopeQuiz}, keys[0].Scopes)
+	assert.NotNil(t, keys[1].RevokedAt)
+}
+
+func TestFileStorage_IdempotencyKeys(t *testing.T) {
+	dir := t.TempDir()
+
+	store := openFileStorage(t, dir, 100)
+	testIdempotencyKeys(t, store)
+	require.NoError(t, store.CompleteIdempotencyKey("u1:default:k1", []byte(`{"score":2}`), time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)))
+
+	// reopen without closing to replay the records from the log
+	reopened := openFileStorage(t, dir, 100)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	existing, err := reopened.ReserveIdempotencyKey(models.IdempotencyRecord{Key: "u1:default:k1"}, now)
+	assert.ErrorIs(t, err, storage.ErrIdempotencyKeyUsed)
+	assert.Equal(t, []byte(`{"score":2}`), existing.Response)
+	closeStorage(t, reopened)
+
+	// and once more from the snapshot written on close
+	again := openFileStorage(t, dir, 100)
+	defer closeStorage(t, again)
+	existing, err = again.ReserveIdempotencyKey(models.IdempotencyRecord{Key: "u1:default:k1"}, now)
+	assert.ErrorIs(t, err, storage.ErrIdempotencyKeyUsed)
+	assert.Equal(t, "f1", existing.Fingerprint)
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// idempotencySweepInterval is how often ReserveIdempotencyKey drops the
+// expired records. Only the reserved key is checked for expiry in between,
+// so that reservations do not scan every record under the lock.
+const idempotencySweepInterval = time.Minute
+
+func (s *memoryStorage) ReserveIdempotencyKey(record models.IdempotencyRecord, now time.Time) (models.IdempotencyRecord, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.sweepIdempotency(now)
+	if existing, exists := s.Idempotency[record.Key]; exists && existing.ExpiresAt.After(now) {
+		return existing, ErrIdempotencyKeyUsed
+	}
+	s.Idempotency[record.Key] = record
+	return record, nil
+}
+
+// sweepIdempotency drops the records expired by now, at most once every
+// idempotencySweepInterval. Callers must hold s.Mutex.
+func (s *memoryStorage) sweepIdempotency(now time.Time) {
+	if now.Sub(s.idempotencySwept) < idempotencySweepInterval {
+		return
+	}
+	for key, existing := range s.Idempotency {
+		if !existing.ExpiresAt.After(now) {
+			delete(s.Idempotency, key)
+		}
+	}
+	s.idempotencySwept = now
+}
+
+func (s *memoryStorage) CompleteIdempotencyKey(key string, response []byte, expiresAt time.Time) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	record, exists := s.Idempotency[key]
+	if !exists {
+		return nil
+	}
+	record.Response = response
+	record.ExpiresAt = expiresAt
+	s.Idempotency[key] = record
+	return nil
+}
+
+func (s *memoryStorage) ReleaseIdempotencyKey(key string) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	delete(s.Idempotency, key)
+	return nil
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// leaderboardCursor returns the position of the ranked attempt on the
+// leaderboard.
+func leaderboardCursor(result models.Result) models.LeaderboardCursor {
+	return models.LeaderboardCursor{Percentage: result.Percentage, ElapsedMillis: result.ElapsedMillis, UserName: result.UserName}
+}
+
+func leaderboardEntry(result models.Result, rank int) models.LeaderboardEntry {
+	return models.LeaderboardEntry{
+		Rank:          rank,
+		UserName:      result.UserName,
+		Attempt:       result.Attempt,
+		Score:         result.Score,
+		MaxScore:      result.MaxScore,
+		Percentage:    result.Percentage,
+		ElapsedMillis: result.ElapsedMillis,
+		SubmittedAt:   result.SubmittedAt,
+	}
+}
+
+// leaderboard is the ranked attempts of a quiz in leaderboard order. It is
+// kept sorted so that pages and ranks are found by binary search.
+type leaderboard []models.Result
+
+// search returns the index of the first entry not listed before cursor.
+func (b leaderboard) search(cursor models.LeaderboardCursor) int {
+	return sort.Search(len(b), func(i int) bool {
+		return !leaderboardCursor(b[i]).Before(cursor)
+	})
+}
+
+func (b leaderboard) insert(result models.Result) leaderboard {
+	i := b.search(leaderboardCursor(result))
+	b = append(b, models.Result{})
+	copy(b[i+1:], b[i:])
+	b[i] = result
+	return b
+}
+
+func (b leaderboard) remove(result models.Result) leaderboard {
+	i := b.search(leaderboardCursor(result))
+	if i == len(b) || b[i].UserName != result.UserName {
+		return b
+	}
+	return append(b[:i], b[i+1:]...)
+}
+
+// rank returns the rank of the entry at index i, one more than the number of
+// entries with a higher percentage.
+func (b leaderboard) rank(i int) int {
+	return sort.Search(len(b), func(j int) bool {
+		return b[j].Percentage <= b[i].Percentage
+	}) + 1
+}
+
+// entries returns the entries from index from up to, but excluding, to.
+func (b leaderboard) entries(from, to int) []models.LeaderboardEntry {
+	from, to = max(from, 0), min(to, len(b))
+	entries := make([]models.LeaderboardEntry, 0, max(to-from, 0))
+	for i := from; i < to; i++ {
+		entries = append(entries, leaderboardEntry(b[i], b.rank(i)))
+	}
+	return entries
+}
+
+// sortLeaderboard orders the ranked attempts in leaderboard order.
+func sortLeaderboard(board leaderboard) {
+	sort.Slice(board, func(i, j int) bool {
+		return leaderboardCursor(board[i]).Before(leaderboardCursor(board[j]))
+	})
+}
+
+// windowLeaderboard ranks the attempts of the quiz submitted in the window
+// under the ranking policy. Unlike the all time leaderboard it is not kept
+// up to date but built on every call. The caller must hold the lock.
+func (s *memoryStorage) windowLeaderboard(quizID string, window models.Window) leaderboard {
+	if window.AllTime() {
+		return s.Leaderboards[quizID]
+	}
+
+	board := leaderboard{}
+	for _, attempts := range s.Attempts[quizID] {
+		// attempts are ordered by submission time
+		from := sort.Search(len(attempts), func(i int) bool {
+			return window.From.IsZero() || !attempts[i].SubmittedAt.Before(window.From)
+		})
+		to := sort.Search(len(attempts), func(i int) bool {
+			return !window.To.IsZero() && !attempts[i].SubmittedAt.Before(window.To)
+		})
+		if from < to {
+			board = append(board, s.Policy.RankedAttempt(attempts[from:to]))
+		}
+	}
+	sortLeaderboard(board)
+	return board
+}
+
+// GetLeaderboard returns up to limit entries of the leaderboard of the quiz
+// in the window, listed after the entry at after, or from the top if after
+// is nil.
+func (s *memoryStorage) GetLeaderboard(quizID string, window models.Window, after *models.LeaderboardCursor, limit int) ([]models.LeaderboardEntry, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	board := s.windowLeaderboard(quizID, window)
+	from := 0
+	if after != nil {
+		from = sort.Search(len(board), func(i int) bool {
+			return after.Before(leaderboardCursor(board[i]))
+		})
+	}
+	return board.entries(from, from+limit), nil
+}
+
+// GetLeaderboardAround returns the entry of the user in the window with up to
+// neighbours entries listed before and after it.
+func (s *memoryStorage) GetLeaderboardAround(quizID, userName string, window models.Window, neighbours int) ([]models.LeaderboardEntry, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	board := s.windowLeaderboard(quizID, window)
+	i := -1
+	if window.AllTime() {
+		if ranked, exists := s.Submissions[quizID][userName]; exists {
+			i = board.search(leaderboardCursor(ranked))
+		}
+	} else {
+		for j, ranked := range board {
+			if ranked.UserName == userName {
+				i = j
+				break
+			}
+		}
+	}
+	if i < 0 {
+		return nil, ErrSubmissionNotFound
+	}
+	return board.entries(i-neighbours, i+neighbours+1), nil
+}
+
+// GetStanding places percentage among the ranked attempts of the quiz in the
+// window.
+func (s *memoryStorage) GetStanding(quizID string, window models.Window, percentage float64) (models.Standing, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	board := s.windowLeaderboard(quizID, window)
+	higher := sort.Search(len(board), func(i int) bool {
+		return board[i].Percentage <= percentage
+	})
+	lower := sort.Search(len(board), func(i int) bool {
+		return board[i].Percentage < percentage
+	})
+	return models.Standing{
+		Rank:         higher + 1,
+		Participants: len(board),
+		Lower:        len(board) - lower,
+		Tied:         lower - higher,
+	}, nil
+}
+
+// GetRankedPercentages returns the percentages of the ranked attempts of the
+// quiz in the window, highest first.
+func (s *memoryStorage) GetRankedPercentages(quizID string, window models.Window) ([]float64, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	board := s.windowLeaderboard(quizID, window)
+	percentages := make([]float64, 0, len(board))
+	for _, ranked := range board {
+		percentages = append(percentages, ranked.Percentage)
+	}
+	return percentages, nil
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// AttemptLimits bound the attempts a user may submit to a quiz. A user may
+// submit at most MaxAttempts attempts, each at least Cooldown after the one
+// before. Zero values do not limit.
+type AttemptLimits struct {
+	MaxAttempts int
+	Cooldown    time.Duration
+}
+
+// check fails if the user, who submitted count attempts, the last one at
+// last, may not submit another attempt at the given time.
+func (l AttemptLimits) check(count int, last, at time.Time) error {
+	if l.MaxAttempts > 0 && count >= l.MaxAttempts {
+		return ErrNoAttemptsLeft
+	}
+	if count > 0 && at.Before(last.Add(l.Cooldown)) {
+		return ErrCoolingDown
+	}
+	return nil
+}
+
+// checkAttempts checks the limits against the earlier attempts of the user.
+func (l AttemptLimits) checkAttempts(attempts []models.Result, at time.Time) error {
+	if len(attempts) == 0 {
+		return nil
+	}
+	return l.check(len(attempts), attempts[len(attempts)-1].SubmittedAt, at)
+}
@@ -0,0 +1,26 @@
+CREATE TABLE questions (
+    id   INTEGER PRIMARY KEY,
+    text TEXT    NOT NULL
+);
+
+CREATE TABLE options (
+    question_id INTEGER NOT NULL REFERENCES questions (id) ON DELETE CASCADE,
+    id          INTEGER NOT NULL,
+    text        TEXT    NOT NULL,
+    is_correct  BOOLEAN NOT NULL DEFAULT FALSE,
+    position    INTEGER NOT NULL,
+    PRIMARY KEY (question_id, id)
+);
+
+CREATE TABLE submissions (
+    user_name               TEXT    PRIMARY KEY,
+    score                   INTEGER NOT NULL,
+    total_question_answered INTEGER NOT NULL
+);
+
+CREATE INDEX submissions_score_idx ON submissions (score);
+
+CREATE TABLE score_histogram (
+    score INTEGER PRIMARY KEY,
+    count INTEGER NOT NULL
+);
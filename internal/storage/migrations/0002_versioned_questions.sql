@@ -0,0 +1,33 @@
+CREATE TABLE question_versions (
+    version    INTEGER   PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE versioned_questions (
+    version INTEGER NOT NULL REFERENCES question_versions (version) ON DELETE CASCADE,
+    id      INTEGER NOT NULL,
+    text    TEXT    NOT NULL,
+    PRIMARY KEY (version, id)
+);
+
+CREATE TABLE versioned_options (
+    version     INTEGER NOT NULL,
+    question_id INTEGER NOT NULL,
+    id          INTEGER NOT NULL,
+    text        TEXT    NOT NULL,
+    is_correct  BOOLEAN NOT NULL DEFAULT FALSE,
+    position    INTEGER NOT NULL,
+    PRIMARY KEY (version, question_id, id),
+    FOREIGN KEY (version, question_id) REFERENCES versioned_questions (version, id) ON DELETE CASCADE
+);
+
+INSERT INTO question_versions (version) SELECT 1 WHERE EXISTS (SELECT 1 FROM questions);
+INSERT INTO versioned_questions (version, id, text) SELECT 1, id, text FROM questions;
+INSERT INTO versioned_options (version, question_id, id, text, is_correct, position)
+    SELECT 1, question_id, id, text, is_correct, position FROM options;
+
+DROP TABLE options;
+DROP TABLE questions;
+
+ALTER TABLE versioned_questions RENAME TO questions;
+ALTER TABLE versioned_options RENAME TO options;
@@ -0,0 +1,44 @@
+CREATE TABLE quizzes (
+    id          TEXT PRIMARY KEY,
+    title       TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE quiz_questions (
+    quiz_id     TEXT    NOT NULL REFERENCES quizzes (id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL,
+    position    INTEGER NOT NULL,
+    PRIMARY KEY (quiz_id, position)
+);
+
+INSERT INTO quizzes (id, title, description)
+    VALUES ('default', 'General Knowledge', 'Every question of the current question set.');
+
+CREATE TABLE quiz_submissions (
+    quiz_id                 TEXT    NOT NULL,
+    user_name               TEXT    NOT NULL,
+    score                   INTEGER NOT NULL,
+    total_question_answered INTEGER NOT NULL,
+    PRIMARY KEY (quiz_id, user_name)
+);
+
+INSERT INTO quiz_submissions (quiz_id, user_name, score, total_question_answered)
+    SELECT 'default', user_name, score, total_question_answered FROM submissions;
+
+DROP TABLE submissions;
+ALTER TABLE quiz_submissions RENAME TO submissions;
+
+CREATE INDEX submissions_quiz_score_idx ON submissions (quiz_id, score);
+
+CREATE TABLE quiz_score_histogram (
+    quiz_id TEXT    NOT NULL,
+    score   INTEGER NOT NULL,
+    count   INTEGER NOT NULL,
+    PRIMARY KEY (quiz_id, score)
+);
+
+INSERT INTO quiz_score_histogram (quiz_id, score, count)
+    SELECT 'default', score, count FROM score_histogram;
+
+DROP TABLE score_histogram;
+ALTER TABLE quiz_score_histogram RENAME TO score_histogram;
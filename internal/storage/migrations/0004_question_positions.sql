@@ -0,0 +1,3 @@
+ALTER TABLE questions ADD COLUMN position INTEGER NOT NULL DEFAULT 0;
+
+UPDATE questions SET position = id;
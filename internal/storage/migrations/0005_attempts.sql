@@ -0,0 +1,29 @@
+CREATE TABLE attempts (
+    quiz_id                 TEXT      NOT NULL,
+    user_name               TEXT      NOT NULL,
+    attempt                 INTEGER   NOT NULL,
+    score                   INTEGER   NOT NULL,
+    total_question_answered INTEGER   NOT NULL,
+    submitted_at            TIMESTAMP NOT NULL,
+    PRIMARY KEY (quiz_id, user_name, attempt)
+);
+
+INSERT INTO attempts (quiz_id, user_name, attempt, score, total_question_answered, submitted_at)
+    SELECT quiz_id, user_name, 1, score, total_question_answered, CURRENT_TIMESTAMP FROM submissions;
+
+-- submissions keeps the attempt of every user that counts toward the ranking
+ALTER TABLE submissions ADD COLUMN attempt INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE submissions ADD COLUMN submitted_at TIMESTAMP NOT NULL DEFAULT '1970-01-01 00:00:00';
+
+UPDATE submissions SET submitted_at = (
+    SELECT submitted_at FROM attempts
+    WHERE attempts.quiz_id = submissions.quiz_id AND attempts.user_name = submissions.user_name AND attempts.attempt = 1
+);
+
+CREATE TABLE settings (
+    key   TEXT PRIMARY KEY,
+    value TEXT NOT NULL
+);
+
+-- submissions used to be overwritten by the latest one
+INSERT INTO settings (key, value) VALUES ('ranking_policy', 'latest');
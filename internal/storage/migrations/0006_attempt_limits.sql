@@ -0,0 +1,2 @@
+ALTER TABLE quizzes ADD COLUMN max_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE quizzes ADD COLUMN cooldown_seconds INTEGER NOT NULL DEFAULT 0;
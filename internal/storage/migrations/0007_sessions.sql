@@ -0,0 +1,14 @@
+ALTER TABLE quizzes ADD COLUMN time_limit_seconds INTEGER NOT NULL DEFAULT 0;
+
+CREATE TABLE sessions (
+    id          TEXT PRIMARY KEY,
+    quiz_id     TEXT      NOT NULL,
+    user_name   TEXT      NOT NULL,
+    version     INTEGER   NOT NULL,
+    started_at  TIMESTAMP NOT NULL,
+    deadline    TIMESTAMP NOT NULL,
+    finished_at TIMESTAMP
+);
+
+ALTER TABLE attempts ADD COLUMN elapsed_ms INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE submissions ADD COLUMN elapsed_ms INTEGER NOT NULL DEFAULT 0;
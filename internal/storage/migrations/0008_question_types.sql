@@ -0,0 +1,3 @@
+ALTER TABLE questions ADD COLUMN type TEXT NOT NULL DEFAULT '';
+-- answer key of true/false, numeric and text questions, encoded as JSON
+ALTER TABLE questions ADD COLUMN answer_key TEXT NOT NULL DEFAULT '';
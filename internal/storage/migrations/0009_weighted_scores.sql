@@ -0,0 +1,29 @@
+ALTER TABLE questions ADD COLUMN points REAL NOT NULL DEFAULT 0;
+ALTER TABLE questions ADD COLUMN penalty REAL NOT NULL DEFAULT 0;
+ALTER TABLE questions ADD COLUMN scoring TEXT NOT NULL DEFAULT '';
+
+-- scores used to count correct answers, each worth one point
+ALTER TABLE attempts ADD COLUMN max_score REAL NOT NULL DEFAULT 0;
+ALTER TABLE attempts ADD COLUMN percentage REAL NOT NULL DEFAULT 0;
+UPDATE attempts SET max_score = total_question_answered,
+    percentage = CASE WHEN total_question_answered > 0 THEN ROUND(score * 100.0 / total_question_answered, 2) ELSE 0 END;
+
+ALTER TABLE submissions ADD COLUMN max_score REAL NOT NULL DEFAULT 0;
+ALTER TABLE submissions ADD COLUMN percentage REAL NOT NULL DEFAULT 0;
+UPDATE submissions SET max_score = total_question_answered,
+    percentage = CASE WHEN total_question_answered > 0 THEN ROUND(score * 100.0 / total_question_answered, 2) ELSE 0 END;
+
+DROP INDEX submissions_quiz_score_idx;
+CREATE INDEX submissions_quiz_percentage_idx ON submissions (quiz_id, percentage);
+
+-- users are ranked by the percentage of their score
+DROP TABLE score_histogram;
+CREATE TABLE score_histogram (
+    quiz_id    TEXT    NOT NULL,
+    percentage REAL    NOT NULL,
+    count      INTEGER NOT NULL,
+    PRIMARY KEY (quiz_id, percentage)
+);
+
+INSERT INTO score_histogram (quiz_id, percentage, count)
+    SELECT quiz_id, percentage, COUNT(*) FROM submissions GROUP BY quiz_id, percentage;
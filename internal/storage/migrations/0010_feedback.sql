@@ -0,0 +1,2 @@
+ALTER TABLE questions ADD COLUMN explanation TEXT NOT NULL DEFAULT '';
+ALTER TABLE quizzes ADD COLUMN feedback TEXT NOT NULL DEFAULT '';
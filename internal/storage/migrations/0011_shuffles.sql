@@ -0,0 +1,6 @@
+ALTER TABLE quizzes ADD COLUMN shuffle_questions BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE quizzes ADD COLUMN shuffle_options BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE sessions ADD COLUMN seed INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE sessions ADD COLUMN shuffle_questions BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE sessions ADD COLUMN shuffle_options BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,18 @@
+ALTER TABLE questions ADD COLUMN tags TEXT NOT NULL DEFAULT '';
+ALTER TABLE questions ADD COLUMN difficulty TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE quiz_blueprint_rules (
+    quiz_id    TEXT    NOT NULL REFERENCES quizzes (id) ON DELETE CASCADE,
+    position   INTEGER NOT NULL,
+    tag        TEXT    NOT NULL,
+    difficulty TEXT    NOT NULL,
+    count      INTEGER NOT NULL,
+    PRIMARY KEY (quiz_id, position)
+);
+
+CREATE TABLE session_questions (
+    session_id  TEXT    NOT NULL REFERENCES sessions (id) ON DELETE CASCADE,
+    question_id INTEGER NOT NULL,
+    position    INTEGER NOT NULL,
+    PRIMARY KEY (session_id, position)
+);
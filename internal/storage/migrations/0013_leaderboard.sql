@@ -0,0 +1,2 @@
+DROP INDEX submissions_quiz_percentage_idx;
+CREATE INDEX submissions_leaderboard_idx ON submissions (quiz_id, percentage DESC, user_name);
@@ -0,0 +1 @@
+CREATE INDEX attempts_quiz_submitted_at_idx ON attempts (quiz_id, submitted_at);
@@ -0,0 +1,10 @@
+CREATE TABLE teams (
+    id   TEXT PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE TABLE team_members (
+    team_id   TEXT NOT NULL REFERENCES teams (id) ON DELETE CASCADE,
+    user_name TEXT NOT NULL,
+    PRIMARY KEY (team_id, user_name)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE users (
+    id            TEXT PRIMARY KEY,
+    user_name     TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    created_at    TIMESTAMP NOT NULL
+);
+
+ALTER TABLE attempts ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE submissions ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
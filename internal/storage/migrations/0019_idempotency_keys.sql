@@ -0,0 +1,6 @@
+CREATE TABLE idempotency_keys (
+    key         TEXT PRIMARY KEY,
+    fingerprint TEXT NOT NULL,
+    response    BLOB,
+    expires_at  TIMESTAMP NOT NULL
+);
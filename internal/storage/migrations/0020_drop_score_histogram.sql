@@ -0,0 +1,2 @@
+-- standings and statistics are computed from the submissions and attempts
+DROP TABLE score_histogram;
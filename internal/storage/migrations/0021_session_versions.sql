@@ -0,0 +1,2 @@
+-- question set versions are kept while sessions refer to them
+CREATE INDEX sessions_version_idx ON sessions (version);
@@ -0,0 +1,2 @@
+-- sessions are graded with the feedback of the quiz when they started
+ALTER TABLE sessions ADD COLUMN feedback TEXT NOT NULL DEFAULT '';
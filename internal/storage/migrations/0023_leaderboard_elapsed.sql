@@ -0,0 +1,3 @@
+-- ties on the leaderboard go to the faster session
+DROP INDEX submissions_leaderboard_idx;
+CREATE INDEX submissions_leaderboard_idx ON submissions (quiz_id, percentage DESC, elapsed_ms, user_name);
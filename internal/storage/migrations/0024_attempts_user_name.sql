@@ -0,0 +1,2 @@
+-- user names are only registered if no attempts were submitted under them
+CREATE INDEX attempts_user_name_idx ON attempts (user_name);
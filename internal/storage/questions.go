@@ -0,0 +1,129 @@
+package storage
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// The functions below derive a new question list from the current one. They
+// never modify their input so that the current version stays intact.
+
+// createQuestion appends question to questions. A question without ID gets the
+// next free one.
+func createQuestion(questions []models.Question, question models.Question) ([]models.Question, models.Question, error) {
+	maxID := 0
+	for _, existing := range questions {
+		if existing.ID == question.ID && question.ID != 0 {
+			return nil, models.Question{}, ErrQuestionExists
+		}
+		if existing.ID > maxID {
+			maxID = existing.ID
+		}
+	}
+	if question.ID == 0 {
+		question.ID = maxID + 1
+	}
+
+	next := make([]models.Question, 0, len(questions)+1)
+	next = append(next, questions...)
+	next = append(next, question)
+	return next, question, nil
+}
+
+// updateQuestion replaces the question with the same ID, keeping its position.
+func updateQuestion(questions []models.Question, question models.Question) ([]models.Question, error) {
+	next := make([]models.Question, len(questions))
+	copy(next, questions)
+	for i := range next {
+		if next[i].ID == question.ID {
+			next[i] = question
+			return next, nil
+		}
+	}
+	return nil, ErrQuestionNotFound
+}
+
+// modifyQuestion replaces the question with the one fn derives from it.
+func modifyQuestion(questions []models.Question, id int, fn func(question models.Question) (models.Question, error)) ([]models.Question, models.Question, error) {
+	question, err := findQuestion(questions, id)
+	if err != nil {
+		return nil, models.Question{}, err
+	}
+	if question, err = fn(question); err != nil {
+		return nil, models.Question{}, err
+	}
+	question.ID = id
+	next, err := updateQuestion(questions, question)
+	return next, question, err
+}
+
+// deleteUnusedQuestion deletes the question unless one of quizzes lists it or
+// draws its blueprint from it.
+func deleteUnusedQuestion(questions []models.Question, quizzes []models.Quiz, id int) ([]models.Question, error) {
+	next, err := deleteQuestion(questions, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, quiz := range quizzes {
+		if slices.Contains(quiz.QuestionIDs, id) {
+			return nil, fmt.Errorf("%w %q", ErrQuestionInUse, quiz.ID)
+		}
+		// quizzes whose blueprint could not be drawn before are not blamed on
+		// the question
+		if quiz.CheckBlueprint(questions) == nil {
+			if err := quiz.CheckBlueprint(next); err != nil {
+				return nil, fmt.Errorf("%w %q: %v", ErrQuestionInUse, quiz.ID, err)
+			}
+		}
+	}
+	return next, nil
+}
+
+func deleteQuestion(questions []models.Question, id int) ([]models.Question, error) {
+	next := make([]models.Question, 0, len(questions))
+	for _, question := range questions {
+		if question.ID != id {
+			next = append(next, question)
+		}
+	}
+	if len(next) == len(questions) {
+		return nil, ErrQuestionNotFound
+	}
+	return next, nil
+}
+
+// reorderQuestions orders questions as listed by ids, which must contain every
+// question ID exactly once.
+func reorderQuestions(questions []models.Question, ids []int) ([]models.Question, error) {
+	if len(ids) != len(questions) {
+		return nil, ErrInvalidOrder
+	}
+
+	byID := make(map[int]models.Question, len(questions))
+	for _, question := range questions {
+		byID[question.ID] = question
+	}
+
+	next := make([]models.Question, 0, len(ids))
+	for _, id := range ids {
+		question, exists := byID[id]
+		if !exists {
+			return nil, ErrInvalidOrder
+		}
+		delete(byID, id)
+		next = append(next, question)
+	}
+	return next, nil
+}
+
+func findQuestion(questions []models.Question, id int) (models.Question, error) {
+	for _, question := range questions {
+		if question.ID == id {
+			return question, nil
+		}
+	}
+	return models.Question{}, ErrQuestionNotFound
+}
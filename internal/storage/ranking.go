@@ -0,0 +1,67 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// RankingPolicy decides which attempt of a user counts toward the ranking of
+// a quiz. Every attempt is kept regardless of the policy.
+type RankingPolicy string
+
+const (
+	// RankBest ranks the attempt with the highest percentage. Ties go to the
+	// earlier one.
+	RankBest RankingPolicy = "best"
+	// RankLatest ranks the most recent attempt.
+	RankLatest RankingPolicy = "latest"
+	// RankFirst ranks the first attempt and ignores retries.
+	RankFirst RankingPolicy = "first"
+)
+
+// ParseRankingPolicy returns the ranking policy with the given name.
+func ParseRankingPolicy(name string) (RankingPolicy, error) {
+	switch policy := RankingPolicy(name); policy {
+	case RankBest, RankLatest, RankFirst:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown ranking policy %q (must be best, latest or first)", name)
+}
+
+// replaces reports whether attempt takes over the ranking from the currently
+// ranked attempt of the same user.
+func (p RankingPolicy) replaces(ranked, attempt models.Result) bool {
+	switch p {
+	case RankBest:
+		return attempt.Percentage > ranked.Percentage
+	case RankFirst:
+		return false
+	default:
+		return true
+	}
+}
+
+// RankedAttempt returns the attempt that counts toward the ranking out of
+// attempts, which must not be empty and ordered oldest first.
+func (p RankingPolicy) RankedAttempt(attempts []models.Result) models.Result {
+	ranked := attempts[0]
+	for _, attempt := range attempts[1:] {
+		if p.replaces(ranked, attempt) {
+			ranked = attempt
+		}
+	}
+	return ranked
+}
+
+// orderBy is the SQL ordering that puts the ranked attempt of a user first.
+func (p RankingPolicy) orderBy() string {
+	switch p {
+	case RankBest:
+		return "percentage DESC, attempt ASC"
+	case RankFirst:
+		return "attempt ASC"
+	default:
+		return "attempt DESC"
+	}
+}
@@ -0,0 +1,1331 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/pkg/log"
+)
+
+// sqlStorage is a Storage backed by a database/sql database. The queries are
+// written for SQLite.
+type sqlStorage struct {
+	db     *sql.DB
+	policy RankingPolicy
+	logger log.Logger
+}
+
+// NewSQLStorage migrates db to the latest schema, seeds the default questions
+// if the questions table is empty and returns a Storage backed by it. If the
+// ranking policy differs from the one the database was ranked with, the
+// ranking is rebuilt from the attempts. The storage takes ownership of db and
+// closes it when the storage is closed.
+func NewSQLStorage(db *sql.DB, policy RankingPolicy, logger log.Logger) (Storage, error) {
+	if err := Migrate(db); err != nil {
+		return nil, err
+	}
+
+	s := &sqlStorage{db: db, policy: policy, logger: logger}
+	if err := s.seedQuestions(defaultQuestions()); err != nil {
+		return nil, err
+	}
+	if err := s.applyRankingPolicy(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close closes the underlying database.
+func (s *sqlStorage) Close() error {
+	return s.db.Close()
+}
+
+// seedQuestions stores the given questions unless the database already holds
+// a question set.
+func (s *sqlStorage) seedQuestions(questions map[int]models.Question) error {
+	version, err := s.currentVersion(s.db)
+	if err != nil || version > 0 {
+		return err
+	}
+	_, err = s.SetQuestions(sortedQuestions(questions))
+	return err
+}
+
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func (s *sqlStorage) currentVersion(q queryer) (int, error) {
+	var version int
+	err := q.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM question_versions`).Scan(&version)
+	return version, err
+}
+
+// SetQuestions stores the questions as a new question set version in a single
+// transaction and drops the versions that are no longer retained.
+func (s *sqlStorage) SetQuestions(questions []models.Question) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	version, err := s.insertQuestionSet(tx, questions)
+	if err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
+
+// insertQuestionSet stores the questions as the next question set version and
+// drops the versions that are no longer retained.
+func (s *sqlStorage) insertQuestionSet(tx *sql.Tx, questions []models.Question) (int, error) {
+	version, err := s.currentVersion(tx)
+	if err != nil {
+		return 0, err
+	}
+	version++
+
+	if _, err := tx.Exec(`INSERT INTO question_versions (version) VALUES (?)`, version); err != nil {
+		return 0, err
+	}
+	for position, question := range questions {
+		key, err := encodeAnswerKey(question)
+		if err != nil {
+			return 0, err
+		}
+		tags, err := encodeTags(question.Tags)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO questions (version, id, type, text, answer_key, points, penalty, scoring, explanation, tags, difficulty, position)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			version, question.ID, question.Type, question.Text, key, question.Points, question.Penalty, question.Scoring,
+			question.Explanation, tags, question.Difficulty, position,
+		); err != nil {
+			return 0, err
+		}
+		for position, option := range question.Options {
+			if _, err := tx.Exec(
+				`INSERT INTO options (version, question_id, id, text, is_correct, position) VALUES (?, ?, ?, ?, ?, ?)`,
+				version, question.ID, option.ID, option.Text, option.IsCorrect, position,
+			); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	// versions live sessions were started against are kept to grade them
+	oldest := version - MaxRetainedVersions
+	for _, table := range []string{"options", "questions", "question_versions"} {
+		if _, err := tx.Exec(
+			`DELETE FROM `+table+` WHERE version <= ?
+			AND version NOT IN (SELECT version FROM sessions WHERE finished_at IS NULL AND deadline > ?)`, oldest, time.Now().UTC(),
+		); err != nil {
+			return 0, err
+		}
+	}
+	return version, nil
+}
+
+// mutateQuestions derives a new question set version from the current one
+// using fn, in a single transaction fn may query as well.
+func (s *sqlStorage) mutateQuestions(fn func(tx *sql.Tx, questions []models.Question) ([]models.Question, error)) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	version, err := s.currentVersion(tx)
+	if err != nil {
+		return err
+	}
+	current, err := queryQuestions(tx, version)
+	if err != nil {
+		return err
+	}
+
+	questions, err := fn(tx, current)
+	if err != nil {
+		return err
+	}
+	if _, err := s.insertQuestionSet(tx, questions); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetQuestion returns the question from the current question set.
+func (s *sqlStorage) GetQuestion(id int) (models.Question, error) {
+	set, err := s.GetQuestionSet(0)
+	if err != nil {
+		return models.Question{}, err
+	}
+	return findQuestion(set.Questions, id)
+}
+
+// CreateQuestion adds the question at the end of a new question set version.
+func (s *sqlStorage) CreateQuestion(question models.Question) (models.Question, error) {
+	var created models.Question
+	err := s.mutateQuestions(func(_ *sql.Tx, questions []models.Question) ([]models.Question, error) {
+		next, question, err := createQuestion(questions, question)
+		created = question
+		return next, err
+	})
+	return created, err
+}
+
+// UpdateQuestion replaces the question with the same ID in a new question set
+// version.
+func (s *sqlStorage) UpdateQuestion(question models.Question) error {
+	return s.mutateQuestions(func(_ *sql.Tx, questions []models.Question) ([]models.Question, error) {
+		return updateQuestion(questions, question)
+	})
+}
+
+// ModifyQuestion replaces the question with the one fn derives from it in a
+// new question set version, in a single transaction.
+func (s *sqlStorage) ModifyQuestion(id int, fn func(question models.Question) (models.Question, error)) (models.Question, error) {
+	var modified models.Question
+	err := s.mutateQuestions(func(_ *sql.Tx, questions []models.Question) ([]models.Question, error) {
+		next, question, err := modifyQuestion(questions, id, fn)
+		modified = question
+		return next, err
+	})
+	return modified, err
+}
+
+// DeleteQuestion removes the question from a new question set version. The
+// quizzes are checked in the same transaction.
+func (s *sqlStorage) DeleteQuestion(id int) error {
+	return s.mutateQuestions(func(tx *sql.Tx, questions []models.Question) ([]models.Question, error) {
+		quizzes, err := queryQuizzes(tx, `SELECT `+quizColumns+` FROM quizzes ORDER BY id`)
+		if err != nil {
+			return nil, err
+		}
+		return deleteUnusedQuestion(questions, quizzes, id)
+	})
+}
+
+// ReorderQuestions orders a new question set version as listed by ids.
+func (s *sqlStorage) ReorderQuestions(ids []int) error {
+	return s.mutateQuestions(func(_ *sql.Tx, questions []models.Question) ([]models.Question, error) {
+		return reorderQuestions(questions, ids)
+	})
+}
+
+func (s *sqlStorage) GetQuestions() []models.Question {
+	set, err := s.GetQuestionSet(0)
+	if err != nil {
+		s.logger.Errorf("Error querying questions: %v", err)
+		return []models.Question{}
+	}
+	return set.Questions
+}
+
+// GetQuestionSet returns the question set of the given version, or the
+// current one if version is 0.
+func (s *sqlStorage) GetQuestionSet(version int) (models.QuestionSet, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.QuestionSet{}, err
+	}
+	defer tx.Rollback()
+
+	if version == 0 {
+		if version, err = s.currentVersion(tx); err != nil {
+			return models.QuestionSet{}, err
+		}
+	}
+
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM question_versions WHERE version = ?)`, version).Scan(&exists); err != nil {
+		return models.QuestionSet{}, err
+	}
+	if !exists {
+		return models.QuestionSet{}, ErrVersionNotFound
+	}
+
+	questions, err := queryQuestions(tx, version)
+	if err != nil {
+		return models.QuestionSet{}, err
+	}
+	return models.QuestionSet{Version: version, Questions: questions}, nil
+}
+
+func queryQuestions(tx *sql.Tx, version int) ([]models.Question, error) {
+	rows, err := tx.Query(
+		`SELECT id, type, text, answer_key, points, penalty, scoring, explanation, tags, difficulty FROM questions
+		WHERE version = ? ORDER BY position, id`, version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []models.Question{}
+	index := make(map[int]int)
+	for rows.Next() {
+		var question models.Question
+		var key, tags string
+		if err := rows.Scan(
+			&question.ID, &question.Type, &question.Text, &key, &question.Points, &question.Penalty, &question.Scoring,
+			&question.Explanation, &tags, &question.Difficulty,
+		); err != nil {
+			return nil, err
+		}
+		if err := decodeAnswerKey(key, &question); err != nil {
+			return nil, err
+		}
+		if tags != "" {
+			if err := json.Unmarshal([]byte(tags), &question.Tags); err != nil {
+				return nil, err
+			}
+		}
+		question.Options = []models.Option{}
+		index[question.ID] = len(questions)
+		questions = append(questions, question)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	optionRows, err := tx.Query(
+		`SELECT question_id, id, text, is_correct FROM options WHERE version = ? ORDER BY question_id, position`, version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer optionRows.Close()
+
+	for optionRows.Next() {
+		var questionID int
+		var option models.Option
+		if err := optionRows.Scan(&questionID, &option.ID, &option.Text, &option.IsCorrect); err != nil {
+			return nil, err
+		}
+		if i, ok := index[questionID]; ok {
+			questions[i].Options = append(questions[i].Options, option)
+		}
+	}
+	return questions, optionRows.Err()
+}
+
+// answerKey holds the answer keys of questions without options.
+type answerKey struct {
+	IsTrue     *bool              `json:"isTrue,omitempty"`
+	NumericKey *models.NumericKey `json:"numericKey,omitempty"`
+	TextKey    *models.TextKey    `json:"textKey,omitempty"`
+}
+
+func encodeAnswerKey(question models.Question) (string, error) {
+	key := answerKey{question.IsTrue, question.NumericKey, question.TextKey}
+	if key == (answerKey{}) {
+		return "", nil
+	}
+	data, err := json.Marshal(key)
+	return string(data), err
+}
+
+func decodeAnswerKey(data string, question *models.Question) error {
+	if data == "" {
+		return nil
+	}
+	var key answerKey
+	if err := json.Unmarshal([]byte(data), &key); err != nil {
+		return err
+	}
+	question.IsTrue, question.NumericKey, question.TextKey = key.IsTrue, key.NumericKey, key.TextKey
+	return nil
+}
+
+func encodeTags(tags []string) (string, error) {
+	if len(tags) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(tags)
+	return string(data), err
+}
+
+// applyRankingPolicy rebuilds the ranked submissions from the attempts unless they were ranked with the storage's policy.
+func (s *sqlStorage) applyRankingPolicy() error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow(`SELECT value FROM settings WHERE key = 'ranking_policy'`).Scan(&current); err != nil {
+		return err
+	}
+	if RankingPolicy(current) == s.policy {
+		return nil
+	}
+
+	s.logger.Infof("Re-ranking submissions from ranking policy %q to %q", current, s.policy)
+	for _, query := range []string{
+		`DELETE FROM submissions`,
+		`INSERT INTO submissions (quiz_id, user_name, ` + attemptColumns + `)
+		SELECT quiz_id, user_name, ` + attemptColumns + ` FROM (
+			SELECT *, ROW_NUMBER() OVER (PARTITION BY quiz_id, user_name ORDER BY ` + s.policy.orderBy() + `) AS rank_order
+			FROM attempts
+		) WHERE rank_order = 1`,
+	} {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE settings SET value = ? WHERE key = 'ranking_policy'`, string(s.policy)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// attemptColumns are the columns attempts and submissions hold for every
+// attempt, in the order scanAttempt reads them.
+const attemptColumns = `attempt, score, max_score, percentage, total_question_answered, submitted_at, elapsed_ms, user_id`
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAttempt(row scanner, result *models.Result) error {
+	return row.Scan(&result.Attempt, &result.Score, &result.MaxScore, &result.Percentage, &result.TotalQuestionAnswered, &result.SubmittedAt, &result.ElapsedMillis, &result.UserID)
+}
+
+// attemptValues returns the quiz ID, the user name and the attemptColumns of
+// the result.
+func attemptValues(result models.Result) []interface{} {
+	return []interface{}{
+		result.QuizID, result.UserName, result.Attempt, result.Score, result.MaxScore, result.Percentage,
+		result.TotalQuestionAnswered, result.SubmittedAt.UTC(), result.ElapsedMillis, result.UserID,
+	}
+}
+
+func (s *sqlStorage) GetUserSubmission(quizID, userName string) (models.Result, error) {
+	result := models.Result{QuizID: quizID, UserName: userName}
+	err := scanAttempt(s.db.QueryRow(
+		`SELECT `+attemptColumns+` FROM submissions WHERE quiz_id = ? AND user_name = ?`, quizID, userName,
+	), &result)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Result{}, ErrSubmissionNotFound
+	}
+	if err != nil {
+		return models.Result{}, err
+	}
+	return result, nil
+}
+
+func (s *sqlStorage) GetUserAttempts(quizID, userName string) ([]models.Result, error) {
+	rows, err := s.db.Query(
+		`SELECT `+attemptColumns+` FROM attempts WHERE quiz_id = ? AND user_name = ? ORDER BY attempt`, quizID, userName,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []models.Result
+	for rows.Next() {
+		attempt := models.Result{QuizID: quizID, UserName: userName}
+		if err := scanAttempt(rows, &attempt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(attempts) == 0 {
+		return nil, ErrSubmissionNotFound
+	}
+	return attempts, nil
+}
+
+func (s *sqlStorage) RankingPolicy() RankingPolicy {
+	return s.policy
+}
+
+// GetStanding places percentage among the ranked attempts of the quiz in the
+// window.
+func (s *sqlStorage) GetStanding(quizID string, window models.Window, percentage float64) (models.Standing, error) {
+	with, args := s.ranked(quizID, window)
+	var standing models.Standing
+	err := s.db.QueryRow(
+		with+`SELECT COUNT(*),
+			COUNT(CASE WHEN percentage > ? THEN 1 END),
+			COUNT(CASE WHEN percentage < ? THEN 1 END),
+			COUNT(CASE WHEN percentage = ? THEN 1 END)
+		FROM ranked`, append(args, percentage, percentage, percentage)...,
+	).Scan(&standing.Participants, &standing.Rank, &standing.Lower, &standing.Tied)
+	if err != nil {
+		return models.Standing{}, err
+	}
+	standing.Rank++
+	return standing, nil
+}
+
+// GetRankedPercentages returns the percentages of the ranked attempts of the
+// quiz in the window, highest first.
+func (s *sqlStorage) GetRankedPercentages(quizID string, window models.Window) ([]float64, error) {
+	with, args := s.ranked(quizID, window)
+	rows, err := s.db.Query(with+`SELECT percentage FROM ranked ORDER BY percentage DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	percentages := []float64{}
+	for rows.Next() {
+		var percentage float64
+		if err := rows.Scan(&percentage); err != nil {
+			return nil, err
+		}
+		percentages = append(percentages, percentage)
+	}
+	return percentages, rows.Err()
+}
+
+// ranked returns the ranked attempts of the quiz in the window as a WITH
+// clause defining the table ranked, and the arguments of the clause. All
+// time rankings read the submissions, other windows rank the attempts
+// submitted in them under the ranking policy.
+func (s *sqlStorage) ranked(quizID string, window models.Window) (string, []interface{}) {
+	if window.AllTime() {
+		return `WITH ranked AS (SELECT * FROM submissions WHERE quiz_id = ?) `, []interface{}{quizID}
+	}
+
+	where, args := `quiz_id = ?`, []interface{}{quizID}
+	if !window.From.IsZero() {
+		where += ` AND submitted_at >= ?`
+		args = append(args, window.From.UTC())
+	}
+	if !window.To.IsZero() {
+		where += ` AND submitted_at < ?`
+		args = append(args, window.To.UTC())
+	}
+	return `WITH ranked AS (SELECT * FROM (
+		SELECT *, ROW_NUMBER() OVER (PARTITION BY user_name ORDER BY ` + s.policy.orderBy() + `) AS position
+		FROM attempts WHERE ` + where + `
+	) WHERE position = 1) `, args
+}
+
+// leaderboardColumns are the columns of a leaderboard entry read from the
+// ranked table, the attempt columns followed by the rank of the entry.
+const leaderboardColumns = `user_name, ` + attemptColumns + `,
+	(SELECT COUNT(*) FROM ranked ahead WHERE ahead.percentage > r.percentage) + 1`
+
+// leaderboardOrder lists the ranked table in leaderboard order, and
+// reverseLeaderboardOrder the other way round.
+const (
+	leaderboardOrder        = `percentage DESC, elapsed_ms, user_name`
+	reverseLeaderboardOrder = `percentage ASC, elapsed_ms DESC, user_name DESC`
+)
+
+// GetLeaderboard returns up to limit entries of the leaderboard of the quiz
+// in the window, listed after the entry at after, or from the top if after
+// is nil. For all time leaderboards the submissions_leaderboard_idx index
+// serves both the page and the ranks.
+func (s *sqlStorage) GetLeaderboard(quizID string, window models.Window, after *models.LeaderboardCursor, limit int) ([]models.LeaderboardEntry, error) {
+	with, args := s.ranked(quizID, window)
+	if after == nil {
+		return s.queryLeaderboard(
+			with+`SELECT `+leaderboardColumns+` FROM ranked r ORDER BY `+leaderboardOrder+` LIMIT ?`,
+			append(args, limit)...,
+		)
+	}
+	return s.queryLeaderboard(
+		with+`SELECT `+leaderboardColumns+` FROM ranked r
+		WHERE percentage < ? OR (percentage = ? AND (elapsed_ms > ? OR (elapsed_ms = ? AND user_name > ?)))
+		ORDER BY `+leaderboardOrder+` LIMIT ?`,
+		append(args, after.Percentage, after.Percentage, after.ElapsedMillis, after.ElapsedMillis, after.UserName, limit)...,
+	)
+}
+
+// GetLeaderboardAround returns the entry of the user in the window with up to
+// neighbours entries listed before and after it.
+func (s *sqlStorage) GetLeaderboardAround(quizID, userName string, window models.Window, neighbours int) ([]models.LeaderboardEntry, error) {
+	with, args := s.ranked(quizID, window)
+	var percentage float64
+	var elapsed int64
+	err := s.db.QueryRow(
+		with+`SELECT percentage, elapsed_ms FROM ranked WHERE user_name = ?`, append(args, userName)...,
+	).Scan(&percentage, &elapsed)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrSubmissionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	before, err := s.queryLeaderboard(
+		with+`SELECT `+leaderboardColumns+` FROM ranked r
+		WHERE percentage > ? OR (percentage = ? AND (elapsed_ms < ? OR (elapsed_ms = ? AND user_name < ?)))
+		ORDER BY `+reverseLeaderboardOrder+` LIMIT ?`,
+		append(args, percentage, percentage, elapsed, elapsed, userName, neighbours)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	// before was read backwards from the user
+	for i, j := 0, len(before)-1; i < j; i, j = i+1, j-1 {
+		before[i], before[j] = before[j], before[i]
+	}
+
+	rest, err := s.queryLeaderboard(
+		with+`SELECT `+leaderboardColumns+` FROM ranked r
+		WHERE percentage < ? OR (percentage = ? AND (elapsed_ms > ? OR (elapsed_ms = ? AND user_name >= ?)))
+		ORDER BY `+leaderboardOrder+` LIMIT ?`,
+		append(args, percentage, percentage, elapsed, elapsed, userName, neighbours+1)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return append(before, rest...), nil
+}
+
+func (s *sqlStorage) queryLeaderboard(query string, args ...interface{}) ([]models.LeaderboardEntry, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.LeaderboardEntry{}
+	for rows.Next() {
+		var result models.Result
+		var rank int
+		if err := rows.Scan(
+			&result.UserName, &result.Attempt, &result.Score, &result.MaxScore, &result.Percentage,
+			&result.TotalQuestionAnswered, &result.SubmittedAt, &result.ElapsedMillis, &result.UserID, &rank,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, leaderboardEntry(result, rank))
+	}
+	return entries, rows.Err()
+}
+
+// AddUserSubmission stores the submission as the next attempt of the user.
+// If the ranking policy prefers it over the ranked attempt, it replaces that
+// one in the submissions.
+func (s *sqlStorage) AddUserSubmission(submission models.Result) (models.Result, error) {
+	return s.AddLimitedSubmission(submission, AttemptLimits{})
+}
+
+// AddLimitedSubmission checks the limits against the latest attempt of the
+// user in the transaction that stores the submission.
+func (s *sqlStorage) AddLimitedSubmission(submission models.Result, limits AttemptLimits) (models.Result, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.Result{}, err
+	}
+	defer tx.Rollback()
+
+	if submission, err = s.addLimitedSubmission(tx, submission, limits); err != nil {
+		return models.Result{}, err
+	}
+	return submission, tx.Commit()
+}
+
+// AddSessionSubmission finishes the session in the transaction that stores
+// the submission, which rolls back if the limits reject it.
+func (s *sqlStorage) AddSessionSubmission(sessionID string, submission models.Result, limits AttemptLimits) (models.Result, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.Result{}, err
+	}
+	defer tx.Rollback()
+
+	if submission.SubmittedAt.IsZero() {
+		submission.SubmittedAt = time.Now().UTC()
+	}
+	if err := finishSession(tx, sessionID, submission.SubmittedAt); err != nil {
+		return models.Result{}, err
+	}
+	if submission, err = s.addLimitedSubmission(tx, submission, limits); err != nil {
+		return models.Result{}, err
+	}
+	return submission, tx.Commit()
+}
+
+func (s *sqlStorage) addLimitedSubmission(tx *sql.Tx, submission models.Result, limits AttemptLimits) (models.Result, error) {
+	if submission.SubmittedAt.IsZero() {
+		submission.SubmittedAt = time.Now().UTC()
+	}
+	var last time.Time
+	err := tx.QueryRow(
+		`SELECT attempt, submitted_at FROM attempts WHERE quiz_id = ? AND user_name = ? ORDER BY attempt DESC LIMIT 1`,
+		submission.QuizID, submission.UserName,
+	).Scan(&submission.Attempt, &last)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return models.Result{}, err
+	default:
+		if err := limits.check(submission.Attempt, last, submission.SubmittedAt); err != nil {
+			return models.Result{}, err
+		}
+	}
+	submission.Attempt++
+
+	if _, err := tx.Exec(
+		`INSERT INTO attempts (quiz_id, user_name, `+attemptColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		attemptValues(submission)...,
+	); err != nil {
+		return models.Result{}, err
+	}
+
+	ranked := models.Result{QuizID: submission.QuizID, UserName: submission.UserName}
+	err = tx.QueryRow(
+		`SELECT attempt, percentage FROM submissions WHERE quiz_id = ? AND user_name = ?`, submission.QuizID, submission.UserName,
+	).Scan(&ranked.Attempt, &ranked.Percentage)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+	case err != nil:
+		return models.Result{}, err
+	case !s.policy.replaces(ranked, submission):
+		return submission, nil
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO submissions (quiz_id, user_name, `+attemptColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (quiz_id, user_name) DO UPDATE SET attempt = excluded.attempt, score = excluded.score,
+			max_score = excluded.max_score, percentage = excluded.percentage,
+			total_question_answered = excluded.total_question_answered, submitted_at = excluded.submitted_at,
+			elapsed_ms = excluded.elapsed_ms, user_id = excluded.user_id`,
+		attemptValues(submission)...,
+	); err != nil {
+		return models.Result{}, err
+	}
+	return submission, nil
+}
+
+const quizColumns = `id, title, description, max_attempts, cooldown_seconds, time_limit_seconds, feedback, shuffle_questions, shuffle_options`
+
+// GetQuizzes returns every quiz ordered by ID.
+func (s *sqlStorage) GetQuizzes() []models.Quiz {
+	quizzes, err := queryQuizzes(s.db, `SELECT `+quizColumns+` FROM quizzes ORDER BY id`)
+	if err != nil {
+		s.logger.Errorf("Error querying quizzes: %v", err)
+		return []models.Quiz{}
+	}
+	return quizzes
+}
+
+func (s *sqlStorage) GetQuiz(quizID string) (models.Quiz, error) {
+	quizzes, err := queryQuizzes(s.db, `SELECT `+quizColumns+` FROM quizzes WHERE id = ?`, quizID)
+	if err != nil {
+		return models.Quiz{}, err
+	}
+	if len(quizzes) == 0 {
+		return models.Quiz{}, ErrQuizNotFound
+	}
+	return quizzes[0], nil
+}
+
+func queryQuizzes(q queryer, query string, args ...interface{}) ([]models.Quiz, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quizzes := []models.Quiz{}
+	for rows.Next() {
+		var quiz models.Quiz
+		if err := rows.Scan(
+			&quiz.ID, &quiz.Title, &quiz.Description, &quiz.MaxAttempts, &quiz.CooldownSeconds, &quiz.TimeLimitSeconds, &quiz.Feedback,
+			&quiz.ShuffleQuestions, &quiz.ShuffleOptions,
+		); err != nil {
+			return nil, err
+		}
+		quizzes = append(quizzes, quiz)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range quizzes {
+		questionIDs, err := queryQuizQuestionIDs(q, quizzes[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		quizzes[i].QuestionIDs = questionIDs
+
+		blueprint, err := queryBlueprint(q, quizzes[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		quizzes[i].Blueprint = blueprint
+	}
+	return quizzes, nil
+}
+
+func queryQuizQuestionIDs(q queryer, quizID string) ([]int, error) {
+	rows, err := q.Query(`SELECT question_id FROM quiz_questions WHERE quiz_id = ? ORDER BY position`, quizID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questionIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		questionIDs = append(questionIDs, id)
+	}
+	return questionIDs, rows.Err()
+}
+
+func queryBlueprint(q queryer, quizID string) ([]models.BlueprintRule, error) {
+	rows, err := q.Query(`SELECT tag, difficulty, count FROM quiz_blueprint_rules WHERE quiz_id = ? ORDER BY position`, quizID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var blueprint []models.BlueprintRule
+	for rows.Next() {
+		var rule models.BlueprintRule
+		if err := rows.Scan(&rule.Tag, &rule.Difficulty, &rule.Count); err != nil {
+			return nil, err
+		}
+		blueprint = append(blueprint, rule)
+	}
+	return blueprint, rows.Err()
+}
+
+// SetQuizzes replaces every quiz in a single transaction. The default quiz is
+// added if quizzes does not define it. Submissions of removed quizzes are kept.
+func (s *sqlStorage) SetQuizzes(quizzes []models.Quiz) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceQuizzes(tx, quizzes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetQuestionBank stores the questions as a new question set version and
+// replaces every quiz in a single transaction.
+func (s *sqlStorage) SetQuestionBank(questions []models.Question, quizzes []models.Quiz) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	version, err := s.insertQuestionSet(tx, questions)
+	if err != nil {
+		return 0, err
+	}
+	if err := replaceQuizzes(tx, quizzes); err != nil {
+		return 0, err
+	}
+	return version, tx.Commit()
+}
+
+func replaceQuizzes(tx *sql.Tx, quizzes []models.Quiz) error {
+	if _, err := tx.Exec(`DELETE FROM quiz_questions`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM quiz_blueprint_rules`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM quizzes`); err != nil {
+		return err
+	}
+
+	hasDefault := false
+	for _, quiz := range quizzes {
+		hasDefault = hasDefault || quiz.ID == models.DefaultQuizID
+	}
+	if !hasDefault {
+		quizzes = append([]models.Quiz{DefaultQuiz()}, quizzes...)
+	}
+
+	for _, quiz := range quizzes {
+		if _, err := tx.Exec(
+			`INSERT INTO quizzes (`+quizColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			quiz.ID, quiz.Title, quiz.Description, quiz.MaxAttempts, quiz.CooldownSeconds, quiz.TimeLimitSeconds, quiz.Feedback,
+			quiz.ShuffleQuestions, quiz.ShuffleOptions,
+		); err != nil {
+			return err
+		}
+		for position, questionID := range quiz.QuestionIDs {
+			if _, err := tx.Exec(
+				`INSERT INTO quiz_questions (quiz_id, question_id, position) VALUES (?, ?, ?)`, quiz.ID, questionID, position,
+			); err != nil {
+				return err
+			}
+		}
+		for position, rule := range quiz.Blueprint {
+			if _, err := tx.Exec(
+				`INSERT INTO quiz_blueprint_rules (quiz_id, position, tag, difficulty, count) VALUES (?, ?, ?, ?, ?)`,
+				quiz.ID, position, rule.Tag, rule.Difficulty, rule.Count,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CreateSession stores the session and the questions drawn for it in a single
+// transaction.
+func (s *sqlStorage) CreateSession(session models.Session) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO sessions (id, quiz_id, user_name, version, started_at, deadline, seed, shuffle_questions, shuffle_options, feedback)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		session.ID, session.QuizID, session.UserName, session.Version, session.StartedAt, session.Deadline,
+		session.Seed, session.ShuffleQuestions, session.ShuffleOptions, session.Feedback,
+	); err != nil {
+		return err
+	}
+	for position, questionID := range session.QuestionIDs {
+		if _, err := tx.Exec(
+			`INSERT INTO session_questions (session_id, question_id, position) VALUES (?, ?, ?)`, session.ID, questionID, position,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStorage) GetSession(id string) (models.Session, error) {
+	session := models.Session{ID: id}
+	var finishedAt sql.NullTime
+	err := s.db.QueryRow(
+		`SELECT quiz_id, user_name, version, started_at, deadline, finished_at, seed, shuffle_questions, shuffle_options, feedback
+		FROM sessions WHERE id = ?`, id,
+	).Scan(
+		&session.QuizID, &session.UserName, &session.Version, &session.StartedAt, &session.Deadline, &finishedAt,
+		&session.Seed, &session.ShuffleQuestions, &session.ShuffleOptions, &session.Feedback,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.Session{}, ErrSessionNotFound
+	}
+	if err != nil {
+		return models.Session{}, err
+	}
+	if finishedAt.Valid {
+		session.FinishedAt = &finishedAt.Time
+	}
+
+	rows, err := s.db.Query(`SELECT question_id FROM session_questions WHERE session_id = ? ORDER BY position`, id)
+	if err != nil {
+		return models.Session{}, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var questionID int
+		if err := rows.Scan(&questionID); err != nil {
+			return models.Session{}, err
+		}
+		session.QuestionIDs = append(session.QuestionIDs, questionID)
+	}
+	return session, rows.Err()
+}
+
+// finishSession sets the finish time only if it is not set yet, so that two
+// concurrent submissions of the same session cannot both succeed.
+func finishSession(tx *sql.Tx, id string, finishedAt time.Time) error {
+	result, err := tx.Exec(`UPDATE sessions SET finished_at = ? WHERE id = ? AND finished_at IS NULL`, finishedAt, id)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated > 0 {
+		return nil
+	}
+	var exists bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM sessions WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrSessionNotFound
+	}
+	return ErrSessionFinished
+}
+
+// CreateUser checks for attempts under the user name in the transaction
+// inserting the user, so that none are submitted in between.
+func (s *sqlStorage) CreateUser(user models.User) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	user = newUser(user)
+	result, err := tx.Exec(
+		`INSERT INTO users (`+userColumns+`) VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		user.ID, user.UserName, user.PasswordHash, user.Role, user.CreatedAt.UTC(),
+	)
+	if err != nil {
+		return err
+	}
+	if created, err := result.RowsAffected(); err != nil {
+		return err
+	} else if created == 0 {
+		return ErrUserExists
+	}
+	var used bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM attempts WHERE user_name = ?)`, user.UserName).Scan(&used); err != nil {
+		return err
+	}
+	if used {
+		return ErrUserNameUsed
+	}
+	return tx.Commit()
+}
+
+// userColumns are the columns of a user in the order queryUsers reads them.
+const userColumns = `id, user_name, password_hash, role, created_at`
+
+// GetUsers returns every user ordered by name.
+func (s *sqlStorage) GetUsers() ([]models.User, error) {
+	return s.queryUsers(`SELECT ` + userColumns + ` FROM users ORDER BY user_name`)
+}
+
+func (s *sqlStorage) GetUser(id string) (models.User, error) {
+	return s.queryUser(`SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+func (s *sqlStorage) GetUserByName(userName string) (models.User, error) {
+	return s.queryUser(`SELECT `+userColumns+` FROM users WHERE user_name = ?`, userName)
+}
+
+func (s *sqlStorage) SetUserRole(id string, role models.Role) error {
+	result, err := s.db.Exec(`UPDATE users SET role = ? WHERE id = ?`, role, id)
+	if err != nil {
+		return err
+	}
+	if updated, err := result.RowsAffected(); err != nil {
+		return err
+	} else if updated == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (s *sqlStorage) queryUser(query string, args ...interface{}) (models.User, error) {
+	users, err := s.queryUsers(query, args...)
+	if err != nil {
+		return models.User{}, err
+	}
+	if len(users) == 0 {
+		return models.User{}, ErrUserNotFound
+	}
+	return users[0], nil
+}
+
+func (s *sqlStorage) queryUsers(query string, args ...interface{}) ([]models.User, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.UserName, &user.PasswordHash, &user.Role, &user.CreatedAt); err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *sqlStorage) CreateAPIKey(key models.APIKey) error {
+	scopes, err := json.Marshal(key.Scopes)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(
+		`INSERT INTO api_keys (`+apiKeyColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Name, key.Prefix, key.Hash, key.UserID, string(scopes), key.CreatedAt.UTC(), key.RevokedAt,
+	)
+	return err
+}
+
+// apiKeyColumns are the columns of an API key in the order queryAPIKeys reads
+// them.
+const apiKeyColumns = `id, name, prefix, hash, user_id, scopes, created_at, revoked_at`
+
+// GetAPIKeys returns every API key ordered by name.
+func (s *sqlStorage) GetAPIKeys() ([]models.APIKey, error) {
+	return s.queryAPIKeys(`SELECT ` + apiKeyColumns + ` FROM api_keys ORDER BY name, id`)
+}
+
+func (s *sqlStorage) GetAPIKeyByHash(hash string) (models.APIKey, error) {
+	keys, err := s.queryAPIKeys(`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = ?`, hash)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	if len(keys) == 0 {
+		return models.APIKey{}, ErrAPIKeyNotFound
+	}
+	return keys[0], nil
+}
+
+// RevokeAPIKey sets the revocation time only if it is not set yet.
+func (s *sqlStorage) RevokeAPIKey(id string, at time.Time) error {
+	var exists bool
+	if err := s.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM api_keys WHERE id = ?)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return ErrAPIKeyNotFound
+	}
+	_, err := s.db.Exec(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, at.UTC(), id)
+	return err
+}
+
+func (s *sqlStorage) queryAPIKeys(query string, args ...interface{}) ([]models.APIKey, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		var (
+			key       models.APIKey
+			scopes    string
+			revokedAt sql.NullTime
+		)
+		if err := rows.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &key.UserID, &scopes, &key.CreatedAt, &revokedAt); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(scopes), &key.Scopes); err != nil {
+			return nil, err
+		}
+		if revokedAt.Valid {
+			key.RevokedAt = &revokedAt.Time
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// ReserveIdempotencyKey drops the expired records and inserts the record in
+// one transaction, so that only one of concurrent reservations of a key
+// succeeds.
+func (s *sqlStorage) ReserveIdempotencyKey(record models.IdempotencyRecord, now time.Time) (models.IdempotencyRecord, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM idempotency_keys WHERE expires_at <= ?`, now.UTC()); err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+	result, err := tx.Exec(
+		`INSERT INTO idempotency_keys (key, fingerprint, response, expires_at) VALUES (?, ?, ?, ?) ON CONFLICT DO NOTHING`,
+		record.Key, record.Fingerprint, record.Response, record.ExpiresAt.UTC(),
+	)
+	if err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+	if reserved, err := result.RowsAffected(); err != nil {
+		return models.IdempotencyRecord{}, err
+	} else if reserved > 0 {
+		return record, tx.Commit()
+	}
+
+	existing := models.IdempotencyRecord{Key: record.Key}
+	err = tx.QueryRow(
+		`SELECT fingerprint, response, expires_at FROM idempotency_keys WHERE key = ?`, record.Key,
+	).Scan(&existing.Fingerprint, &existing.Response, &existing.ExpiresAt)
+	if err != nil {
+		return models.IdempotencyRecord{}, err
+	}
+	return existing, ErrIdempotencyKeyUsed
+}
+
+func (s *sqlStorage) CompleteIdempotencyKey(key string, response []byte, expiresAt time.Time) error {
+	_, err := s.db.Exec(
+		`UPDATE idempotency_keys SET response = ?, expires_at = ? WHERE key = ?`, response, expiresAt.UTC(), key,
+	)
+	return err
+}
+
+func (s *sqlStorage) ReleaseIdempotencyKey(key string) error {
+	_, err := s.db.Exec(`DELETE FROM idempotency_keys WHERE key = ?`, key)
+	return err
+}
+
+// GetTeams returns every team ordered by ID.
+func (s *sqlStorage) GetTeams() ([]models.Team, error) {
+	return s.queryTeams(`SELECT id, name FROM teams ORDER BY id`)
+}
+
+func (s *sqlStorage) GetTeam(id string) (models.Team, error) {
+	teams, err := s.queryTeams(`SELECT id, name FROM teams WHERE id = ?`, id)
+	if err != nil {
+		return models.Team{}, err
+	}
+	if len(teams) == 0 {
+		return models.Team{}, ErrTeamNotFound
+	}
+	return teams[0], nil
+}
+
+func (s *sqlStorage) queryTeams(query string, args ...interface{}) ([]models.Team, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []models.Team{}
+	for rows.Next() {
+		team := models.Team{Members: []string{}}
+		if err := rows.Scan(&team.ID, &team.Name); err != nil {
+			return nil, err
+		}
+		teams = append(teams, team)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range teams {
+		members, err := s.queryTeamMembers(teams[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		teams[i].Members = members
+	}
+	return teams, nil
+}
+
+func (s *sqlStorage) queryTeamMembers(teamID string) ([]string, error) {
+	rows, err := s.db.Query(`SELECT user_name FROM team_members WHERE team_id = ? ORDER BY user_name`, teamID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []string{}
+	for rows.Next() {
+		var userName string
+		if err := rows.Scan(&userName); err != nil {
+			return nil, err
+		}
+		members = append(members, userName)
+	}
+	return members, rows.Err()
+}
+
+// CreateTeam stores the team and its members in a single transaction.
+func (s *sqlStorage) CreateTeam(team models.Team) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO teams (id, name) VALUES (?, ?) ON CONFLICT (id) DO NOTHING`, team.ID, team.Name)
+	if err != nil {
+		return err
+	}
+	if created, err := result.RowsAffected(); err != nil {
+		return err
+	} else if created == 0 {
+		return ErrTeamExists
+	}
+	for _, userName := range team.Members {
+		if _, err := tx.Exec(
+			`INSERT INTO team_members (team_id, user_name) VALUES (?, ?) ON CONFLICT DO NOTHING`, team.ID, userName,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTeam deletes the members along with the team, as foreign keys may not
+// be enforced.
+func (s *sqlStorage) DeleteTeam(id string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM team_members WHERE team_id = ?`, id); err != nil {
+		return err
+	}
+	result, err := tx.Exec(`DELETE FROM teams WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if deleted, err := result.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrTeamNotFound
+	}
+	return tx.Commit()
+}
+
+func (s *sqlStorage) AddTeamMember(teamID, userName string) error {
+	result, err := s.db.Exec(
+		`INSERT INTO team_members (team_id, user_name) SELECT id, ? FROM teams WHERE id = ? ON CONFLICT DO NOTHING`, userName, teamID,
+	)
+	if err != nil {
+		return err
+	}
+	if added, err := result.RowsAffected(); err != nil {
+		return err
+	} else if added > 0 {
+		return nil
+	}
+	// either the team does not exist or the user is already a member
+	_, err = s.GetTeam(teamID)
+	return err
+}
+
+func (s *sqlStorage) RemoveTeamMember(teamID, userName string) error {
+	result, err := s.db.Exec(`DELETE FROM team_members WHERE team_id = ? AND user_name = ?`, teamID, userName)
+	if err != nil {
+		return err
+	}
+	if removed, err := result.RowsAffected(); err != nil {
+		return err
+	} else if removed > 0 {
+		return nil
+	}
+	if _, err := s.GetTeam(teamID); err != nil {
+		return err
+	}
+	return ErrMemberNotFound
+}
@@ -0,0 +1,220 @@
+package storage_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/pkg/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	_ "modernc.org/sqlite"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", "file:"+t.TempDir()+"/quiz.db?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_txlock=immediate")
+	require.NoError(t, err)
+	return db
+}
+
+func openSQLStorage(t *testing.T) storage.Storage {
+	logger, _ := log.NewForTest()
+	store, err := storage.NewSQLStorage(openTestDB(t), storage.RankLatest, logger)
+	require.NoError(t, err)
+	t.Cleanup(func() { closeStorage(t, store) })
+	return store
+}
+
+func TestMigrate_IsIdempotent(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+
+	require.NoError(t, storage.Migrate(db))
+	require.NoError(t, storage.Migrate(db))
+
+	var applied int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied))
+	assert.Greater(t, applied, 0)
+}
+
+func TestSQLStorage_Questions(t *testing.T) {
+	store := openSQLStorage(t)
+
+	questions := store.GetQuestions()
+	require.Len(t, questions, 10)
+	assert.Equal(t, 1, questions[0].ID)
+	assert.Equal(t, "What is the capital of France?", questions[0].Text)
+	assert.Len(t, questions[0].Options, 4)
+}
+
+func TestSQLStorage_QuestionVersions(t *testing.T) {
+	store := openSQLStorage(t)
+
+	version, err := store.SetQuestions([]models.Question{
+		{ID: 1, Text: "Reloaded", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}, {ID: 2, Text: "B"}}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+	assert.Len(t, store.GetQuestions(), 1)
+
+	current, err := store.GetQuestionSet(0)
+	require.NoError(t, err)
+	assert.Equal(t, version, current.Version)
+	assert.Equal(t, "Reloaded", current.Questions[0].Text)
+	assert.Len(t, current.Questions[0].Options, 2)
+
+	previous, err := store.GetQuestionSet(1)
+	require.NoError(t, err)
+	assert.Len(t, previous.Questions, 10)
+
+	for i := 0; i < storage.MaxRetainedVersions; i++ {
+		_, err := store.SetQuestions(current.Questions)
+		require.NoError(t, err)
+	}
+	_, err = store.GetQuestionSet(1)
+	assert.ErrorIs(t, err, storage.ErrVersionNotFound)
+}
+
+func TestSQLStorage_SessionVersions(t *testing.T) {
+	testSessionVersions(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_QuestionCRUD(t *testing.T) {
+	testQuestionCRUD(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_Submissions(t *testing.T) {
+	store := openSQLStorage(t)
+
+	submittedAt := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+	submission := models.Result{QuizID: models.DefaultQuizID, UserName: "testUser", Score: 8, TotalQuestionAnswered: 10, SubmittedAt: submittedAt}
+	stored := addSubmission(t, store, submission)
+	assert.Equal(t, 1, stored.Attempt)
+
+	retrieved, err := store.GetUserSubmission(models.DefaultQuizID, "testUser")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, retrieved.Attempt)
+	assert.True(t, submittedAt.Equal(retrieved.SubmittedAt), "got %v", retrieved.SubmittedAt)
+	retrieved.SubmittedAt = submittedAt
+	assert.Equal(t, stored, retrieved)
+
+	_, err = store.GetUserSubmission(models.DefaultQuizID, "nonExistentUser")
+	assert.EqualError(t, err, "submission not found")
+}
+
+func TestSQLStorage_GetStanding(t *testing.T) {
+	testStanding(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_Attempts(t *testing.T) {
+	testAttempts(t, func(policy storage.RankingPolicy) storage.Storage {
+		logger, _ := log.NewForTest()
+		store, err := storage.NewSQLStorage(openTestDB(t), policy, logger)
+		require.NoError(t, err)
+		t.Cleanup(func() { closeStorage(t, store) })
+		return store
+	})
+}
+
+func TestSQLStorage_ChangingRankingPolicyReranks(t *testing.T) {
+	logger, _ := log.NewForTest()
+	dsn := "file:" + t.TempDir() + "/quiz.db"
+
+	db, err := sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	store, err := storage.NewSQLStorage(db, storage.RankLatest, logger)
+	require.NoError(t, err)
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 9, MaxScore: 10, Percentage: 90})
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 3, MaxScore: 10, Percentage: 30})
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User2", Score: 6, MaxScore: 10, Percentage: 60})
+	assert.Equal(t, 2, standing(t, store, models.DefaultQuizID, models.Window{}, 30).Rank)
+	closeStorage(t, store)
+
+	db, err = sql.Open("sqlite", dsn)
+	require.NoError(t, err)
+	reopened, err := storage.NewSQLStorage(db, storage.RankBest, logger)
+	require.NoError(t, err)
+	defer closeStorage(t, reopened)
+
+	ranked, err := reopened.GetUserSubmission(models.DefaultQuizID, "User1")
+	require.NoError(t, err)
+	assert.Equal(t, 1, ranked.Attempt)
+	assert.Equal(t, 1, standing(t, reopened, models.DefaultQuizID, models.Window{}, 90).Rank)
+	assert.Equal(t, 2, standing(t, reopened, models.DefaultQuizID, models.Window{}, 60).Rank)
+}
+
+func TestSQLStorage_ConcurrentSubmissions(t *testing.T) {
+	testConcurrentSubmissions(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_AttemptLimits(t *testing.T) {
+	testAttemptLimits(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_Sessions(t *testing.T) {
+	testSessions(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_Leaderboard(t *testing.T) {
+	testLeaderboard(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_LeaderboardWindows(t *testing.T) {
+	testLeaderboardWindows(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_Teams(t *testing.T) {
+	testTeams(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_Users(t *testing.T) {
+	testUsers(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_APIKeys(t *testing.T) {
+	testAPIKeys(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_IdempotencyKeys(t *testing.T) {
+	testIdempotencyKeys(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_QuestionsInUse(t *testing.T) {
+	testQuestionsInUse(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_QuestionBank(t *testing.T) {
+	testQuestionBank(t, openSQLStorage(t))
+}
+
+func TestSQLStorage_Quizzes(t *testing.T) {
+	store := openSQLStorage(t)
+
+	quiz, err := store.GetQuiz(models.DefaultQuizID)
+	require.NoError(t, err)
+	assert.Equal(t, storage.DefaultQuiz(), quiz)
+
+	space := models.Quiz{ID: "space", Title: "Space", QuestionIDs: []int{9, 2}, MaxAttempts: 3, CooldownSeconds: 30, TimeLimitSeconds: 120, Feedback: models.FeedbackFull,
+		ShuffleQuestions: true, ShuffleOptions: true, Blueprint: []models.BlueprintRule{
+			{Tag: "science", Difficulty: models.DifficultyEasy, Count: 2}, {Count: 1},
+		}}
+	require.NoError(t, store.SetQuizzes([]models.Quiz{space}))
+
+	quizzes := store.GetQuizzes()
+	require.Len(t, quizzes, 2)
+	assert.Equal(t, models.DefaultQuizID, quizzes[0].ID)
+	assert.Equal(t, space, quizzes[1])
+
+	_, err = store.GetQuiz("unknown")
+	assert.ErrorIs(t, err, storage.ErrQuizNotFound)
+
+	addSubmission(t, store, models.Result{QuizID: "space", UserName: "User1", Score: 1, MaxScore: 10, Percentage: 10})
+	addSubmission(t, store, models.Result{QuizID: "space", UserName: "User2", Score: 2, MaxScore: 10, Percentage: 20})
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 9, MaxScore: 10, Percentage: 90})
+
+	assert.Equal(t, 1, standing(t, store, "space", models.Window{}, 20).Rank)
+	assert.Equal(t, models.Standing{Rank: 1, Participants: 1, Tied: 1}, standing(t, store, models.DefaultQuizID, models.Window{}, 90))
+}
@@ -7,216 +7,652 @@ import (
 
 	"sync"
 
+	"time"
+
 	"github.com/courage173/quiz-api/internal/models"
 )
 
+var (
+	ErrSubmissionNotFound = errors.New("submission not found")
+	ErrQuestionNotFound   = errors.New("question not found")
+	ErrVersionNotFound    = errors.New("question set version not found")
+	ErrQuizNotFound       = errors.New("quiz not found")
+	ErrQuestionExists     = errors.New("a question with this ID already exists")
+	ErrInvalidOrder       = errors.New("the order must list every question exactly once")
+	ErrQuestionInUse      = errors.New("question is used by quiz")
+	ErrSessionNotFound    = errors.New("session not found")
+	ErrSessionFinished    = errors.New("session has already been submitted")
+	ErrTeamNotFound       = errors.New("team not found")
+	ErrTeamExists         = errors.New("a team with this ID already exists")
+	ErrMemberNotFound     = errors.New("user is not a member of the team")
+	ErrUserNotFound       = errors.New("user not found")
+	ErrUserExists         = errors.New("a user with this name already exists")
+	ErrUserNameUsed       = errors.New("the user name is used by earlier submissions")
+	ErrAPIKeyNotFound     = errors.New("API key not found")
+	ErrIdempotencyKeyUsed = errors.New("idempotency key already used")
+	ErrNoAttemptsLeft     = errors.New("all attempts of the quiz are used")
+	ErrCoolingDown        = errors.New("the quiz cannot be attempted again yet")
+)
+
+// MaxRetainedVersions is the number of question set versions kept around so
+// that submissions started against an older version can still be graded.
+// Older versions are kept as well for as long as a session that can still be
+// submitted refers to them.
+const MaxRetainedVersions = 10
+
 type Storage interface {
 	GetQuestions() []models.Question
-	GetUserSubmission(userName string) (models.Result, error)
-	CalculateScoreRankPercentage(score int) float64
-	AddUserSubmission(submission models.Result)
-	GetCorrectOption(questionID int) (models.Option, error)
-	Count() int
+	// GetUserSubmission returns the attempt of the user that counts toward
+	// the ranking of the quiz.
+	GetUserSubmission(quizID, userName string) (models.Result, error)
+	// GetUserAttempts returns every attempt of the user at the quiz, oldest
+	// first.
+	GetUserAttempts(quizID, userName string) ([]models.Result, error)
+	RankingPolicy() RankingPolicy
+	// GetStanding places percentage among the ranked attempts of the quiz
+	// in the window.
+	GetStanding(quizID string, window models.Window, percentage float64) (models.Standing, error)
+	// GetRankedPercentages returns the percentages of the ranked attempts of
+	// the quiz in the window, highest first.
+	GetRankedPercentages(quizID string, window models.Window) ([]float64, error)
+	// GetLeaderboard returns up to limit entries of the leaderboard of the
+	// quiz in the window, listed after the entry at after, or from the top if
+	// after is nil.
+	GetLeaderboard(quizID string, window models.Window, after *models.LeaderboardCursor, limit int) ([]models.LeaderboardEntry, error)
+	// GetLeaderboardAround returns the entry of the user on the leaderboard
+	// of the quiz in the window with up to neighbours entries listed before
+	// and after it.
+	GetLeaderboardAround(quizID, userName string, window models.Window, neighbours int) ([]models.LeaderboardEntry, error)
+	// AddUserSubmission stores the submission as the next attempt of the user
+	// and returns it with its attempt number.
+	AddUserSubmission(submission models.Result) (models.Result, error)
+	// AddLimitedSubmission stores the submission like AddUserSubmission
+	// unless the earlier attempts of the user exceed the limits, in which case
+	// it fails with ErrNoAttemptsLeft or ErrCoolingDown. The limits are checked
+	// atomically with the write, so that concurrent submissions cannot both
+	// pass them.
+	AddLimitedSubmission(submission models.Result, limits AttemptLimits) (models.Result, error)
+	// AddSessionSubmission finishes the session at the time of the submission
+	// and stores the submission like AddLimitedSubmission, both or neither.
+	// It fails with ErrSessionFinished if the session was submitted before,
+	// and leaves the session open if the limits reject the submission.
+	AddSessionSubmission(sessionID string, submission models.Result, limits AttemptLimits) (models.Result, error)
+	GetQuestionSet(version int) (models.QuestionSet, error)
+	SetQuestions(questions []models.Question) (int, error)
+	GetQuestion(id int) (models.Question, error)
+	CreateQuestion(question models.Question) (models.Question, error)
+	UpdateQuestion(question models.Question) error
+	// ModifyQuestion replaces the question with the one fn derives from it in
+	// a new question set version and returns it. fn is given the current
+	// question, so that concurrent changes to it are not lost.
+	ModifyQuestion(id int, fn func(question models.Question) (models.Question, error)) (models.Question, error)
+	// DeleteQuestion removes the question from a new question set version. It
+	// fails with ErrQuestionInUse if a quiz lists the question or its
+	// blueprint could not be drawn without it.
+	DeleteQuestion(id int) error
+	ReorderQuestions(ids []int) error
+	GetQuizzes() []models.Quiz
+	GetQuiz(quizID string) (models.Quiz, error)
+	SetQuizzes(quizzes []models.Quiz) error
+	// SetQuestionBank atomically replaces the question set with a new version
+	// and every quiz with quizzes, and returns the version.
+	SetQuestionBank(questions []models.Question, quizzes []models.Quiz) (int, error)
+	CreateSession(session models.Session) error
+	GetSession(id string) (models.Session, error)
+	// GetTeams returns every team ordered by ID.
+	GetTeams() ([]models.Team, error)
+	GetTeam(id string) (models.Team, error)
+	// CreateTeam stores the team. It fails with ErrTeamExists if a team with
+	// the same ID exists.
+	CreateTeam(team models.Team) error
+	DeleteTeam(id string) error
+	// AddTeamMember adds the user to the team. Adding a member twice is not
+	// an error.
+	AddTeamMember(teamID, userName string) error
+	RemoveTeamMember(teamID, userName string) error
+	// CreateUser stores the user. It fails with ErrUserExists if a user with
+	// the same ID or user name exists, and with ErrUserNameUsed if attempts
+	// were submitted under the user name, as they were before accounts.
+	CreateUser(user models.User) error
+	// GetUsers returns every user ordered by name.
+	GetUsers() ([]models.User, error)
+	GetUser(id string) (models.User, error)
+	GetUserByName(userName string) (models.User, error)
+	SetUserRole(id string, role models.Role) error
+	CreateAPIKey(key models.APIKey) error
+	// GetAPIKeys returns every API key, revoked ones included, ordered by name.
+	GetAPIKeys() ([]models.APIKey, error)
+	// GetAPIKeyByHash returns the API key with the hash, even if revoked.
+	GetAPIKeyByHash(hash string) (models.APIKey, error)
+	// RevokeAPIKey marks the API key as revoked at the given time. Revoking a
+	// key twice keeps the first time.
+	RevokeAPIKey(id string, at time.Time) error
+	// ReserveIdempotencyKey stores the record unless a record with its key
+	// that has not expired by now exists. It then returns that record and
+	// ErrIdempotencyKeyUsed. Expired records are dropped, though not
+	// necessarily on every call.
+	ReserveIdempotencyKey(record models.IdempotencyRecord, now time.Time) (models.IdempotencyRecord, error)
+	// CompleteIdempotencyKey stores the response of the reserved key and
+	// keeps it until expiresAt. Completing a key that is not reserved does
+	// nothing.
+	CompleteIdempotencyKey(key string, response []byte, expiresAt time.Time) error
+	// ReleaseIdempotencyKey drops the record of the key so that the request
+	// can be made again.
+	ReleaseIdempotencyKey(key string) error
 }
 
 type memoryStorage struct {
-	Questions    map[int]models.Question
-	Submissions  map[string]models.Result
-	ScoreTracker map[int]int
-	Mutex        sync.RWMutex
+	// Questions is the current question set in order.
+	Questions []models.Question
+	// Version is the version of Questions. Versions holds every retained
+	// question set, including the current one.
+	Version  int
+	Versions map[int][]models.Question
+	Quizzes  map[string]models.Quiz
+	// Attempts, Submissions and Leaderboards are keyed by quiz ID. Attempts
+	// holds every attempt of a user, Submissions the one that counts toward
+	// the ranking under Policy and Leaderboards orders them.
+	Attempts     map[string]map[string][]models.Result
+	Submissions  map[string]map[string]models.Result
+	Leaderboards map[string]leaderboard
+	Policy       RankingPolicy
+	Sessions     map[string]models.Session
+	Teams        map[string]models.Team
+	Users        map[string]models.User
+	APIKeys      map[string]models.APIKey
+	Idempotency  map[string]models.IdempotencyRecord
+	// idempotencySwept is when the expired Idempotency records were last
+	// dropped.
+	idempotencySwept time.Time
+	Mutex            sync.RWMutex
 }
 
-func NewStorage() Storage {
+func NewStorage(policy RankingPolicy) Storage {
+	questions := sortedQuestions(defaultQuestions())
 	return &memoryStorage{
-		Questions: map[int]models.Question{
-			1: {
-				ID:   1,
-				Text: "What is the capital of France?",
-				Options: []models.Option{
-					{ID: 1, Text: "Berlin", IsCorrect: false},
-					{ID: 2, Text: "London", IsCorrect: false},
-					{ID: 3, Text: "Paris", IsCorrect: true},
-					{ID: 4, Text: "Madrid", IsCorrect: false},
-				},
+		Questions:    questions,
+		Version:      1,
+		Versions:     map[int][]models.Question{1: questions},
+		Quizzes:      map[string]models.Quiz{models.DefaultQuizID: DefaultQuiz()},
+		Attempts:     make(map[string]map[string][]models.Result),
+		Submissions:  make(map[string]map[string]models.Result),
+		Leaderboards: make(map[string]leaderboard),
+		Policy:       policy,
+		Sessions:     make(map[string]models.Session),
+		Teams:        make(map[string]models.Team),
+		Users:        make(map[string]models.User),
+		APIKeys:      make(map[string]models.APIKey),
+		Idempotency:  make(map[string]models.IdempotencyRecord),
+	}
+}
+
+// DefaultQuiz returns the quiz covering every question of the question set.
+// Storages always hold a quiz with this ID.
+func DefaultQuiz() models.Quiz {
+	return models.Quiz{
+		ID:          models.DefaultQuizID,
+		Title:       "General Knowledge",
+		Description: "Every question of the current question set.",
+	}
+}
+
+// defaultQuestions returns the question set the storages are seeded with.
+func defaultQuestions() map[int]models.Question {
+	return map[int]models.Question{
+		1: {
+			ID:   1,
+			Text: "What is the capital of France?",
+			Options: []models.Option{
+				{ID: 1, Text: "Berlin", IsCorrect: false},
+				{ID: 2, Text: "London", IsCorrect: false},
+				{ID: 3, Text: "Paris", IsCorrect: true},
+				{ID: 4, Text: "Madrid", IsCorrect: false},
 			},
-			2: {
-				ID:   2,
-				Text: "Which planet is known as the Red Planet?",
-				Options: []models.Option{
-					{ID: 1, Text: "Earth", IsCorrect: false},
-					{ID: 2, Text: "Mars", IsCorrect: true},
-					{ID: 3, Text: "Jupiter", IsCorrect: false},
-					{ID: 4, Text: "Saturn", IsCorrect: false},
-				},
+		},
+		2: {
+			ID:   2,
+			Text: "Which planet is known as the Red Planet?",
+			Options: []models.Option{
+				{ID: 1, Text: "Earth", IsCorrect: false},
+				{ID: 2, Text: "Mars", IsCorrect: true},
+				{ID: 3, Text: "Jupiter", IsCorrect: false},
+				{ID: 4, Text: "Saturn", IsCorrect: false},
 			},
-			3: {
-				ID:   3,
-				Text: "What is the largest ocean on Earth?",
-				Options: []models.Option{
-					{ID: 1, Text: "Atlantic Ocean", IsCorrect: false},
-					{ID: 2, Text: "Indian Ocean", IsCorrect: false},
-					{ID: 3, Text: "Arctic Ocean", IsCorrect: false},
-					{ID: 4, Text: "Pacific Ocean", IsCorrect: true},
-				},
+		},
+		3: {
+			ID:   3,
+			Text: "What is the largest ocean on Earth?",
+			Options: []models.Option{
+				{ID: 1, Text: "Atlantic Ocean", IsCorrect: false},
+				{ID: 2, Text: "Indian Ocean", IsCorrect: false},
+				{ID: 3, Text: "Arctic Ocean", IsCorrect: false},
+				{ID: 4, Text: "Pacific Ocean", IsCorrect: true},
 			},
-			4: {
-				ID:   4,
-				Text: "Which country is known as the Land of the Rising Sun?",
-				Options: []models.Option{
-					{ID: 1, Text: "China", IsCorrect: false},
-					{ID: 2, Text: "Japan", IsCorrect: true},
-					{ID: 3, Text: "Thailand", IsCorrect: false},
-					{ID: 4, Text: "South Korea", IsCorrect: false},
-				},
+		},
+		4: {
+			ID:   4,
+			Text: "Which country is known as the Land of the Rising Sun?",
+			Options: []models.Option{
+				{ID: 1, Text: "China", IsCorrect: false},
+				{ID: 2, Text: "Japan", IsCorrect: true},
+				{ID: 3, Text: "Thailand", IsCorrect: false},
+				{ID: 4, Text: "South Korea", IsCorrect: false},
 			},
-			5: {
-				ID:   5,
-				Text: "Who wrote 'Romeo and Juliet'?",
-				Options: []models.Option{
-					{ID: 1, Text: "William Shakespeare", IsCorrect: true},
-					{ID: 2, Text: "Charles Dickens", IsCorrect: false},
-					{ID: 3, Text: "Leo Tolstoy", IsCorrect: false},
-					{ID: 4, Text: "Jane Austen", IsCorrect: false},
-				},
+		},
+		5: {
+			ID:   5,
+			Text: "Who wrote 'Romeo and Juliet'?",
+			Options: []models.Option{
+				{ID: 1, Text: "William Shakespeare", IsCorrect: true},
+				{ID: 2, Text: "Charles Dickens", IsCorrect: false},
+				{ID: 3, Text: "Leo Tolstoy", IsCorrect: false},
+				{ID: 4, Text: "Jane Austen", IsCorrect: false},
 			},
-			6: {
-				ID:   6,
-				Text: "What is the smallest prime number?",
-				Options: []models.Option{
-					{ID: 1, Text: "0", IsCorrect: false},
-					{ID: 2, Text: "1", IsCorrect: false},
-					{ID: 3, Text: "2", IsCorrect: true},
-					{ID: 4, Text: "3", IsCorrect: false},
-				},
+		},
+		6: {
+			ID:   6,
+			Text: "What is the smallest prime number?",
+			Options: []models.Option{
+				{ID: 1, Text: "0", IsCorrect: false},
+				{ID: 2, Text: "1", IsCorrect: false},
+				{ID: 3, Text: "2", IsCorrect: true},
+				{ID: 4, Text: "3", IsCorrect: false},
 			},
-			7: {
-				ID:   7,
-				Text: "What is the powerhouse of the cell?",
-				Options: []models.Option{
-					{ID: 1, Text: "Nucleus", IsCorrect: false},
-					{ID: 2, Text: "Mitochondria", IsCorrect: true},
-					{ID: 3, Text: "Ribosome", IsCorrect: false},
-					{ID: 4, Text: "Chloroplast", IsCorrect: false},
-				},
+		},
+		7: {
+			ID:   7,
+			Text: "What is the powerhouse of the cell?",
+			Options: []models.Option{
+				{ID: 1, Text: "Nucleus", IsCorrect: false},
+				{ID: 2, Text: "Mitochondria", IsCorrect: true},
+				{ID: 3, Text: "Ribosome", IsCorrect: false},
+				{ID: 4, Text: "Chloroplast", IsCorrect: false},
 			},
-			8: {
-				ID:   8,
-				Text: "What is the boiling point of water at sea level in Celsius?",
-				Options: []models.Option{
-					{ID: 1, Text: "50°C", IsCorrect: false},
-					{ID: 2, Text: "100°C", IsCorrect: true},
-					{ID: 3, Text: "75°C", IsCorrect: false},
-					{ID: 4, Text: "125°C", IsCorrect: false},
-				},
+		},
+		8: {
+			ID:   8,
+			Text: "What is the boiling point of water at sea level in Celsius?",
+			Options: []models.Option{
+				{ID: 1, Text: "50°C", IsCorrect: false},
+				{ID: 2, Text: "100°C", IsCorrect: true},
+				{ID: 3, Text: "75°C", IsCorrect: false},
+				{ID: 4, Text: "125°C", IsCorrect: false},
 			},
-			9: {
-				ID:   9,
-				Text: "Which planet has the most moons?",
-				Options: []models.Option{
-					{ID: 1, Text: "Earth", IsCorrect: false},
-					{ID: 2, Text: "Mars", IsCorrect: false},
-					{ID: 3, Text: "Jupiter", IsCorrect: true},
-					{ID: 4, Text: "Venus", IsCorrect: false},
-				},
+		},
+		9: {
+			ID:   9,
+			Text: "Which planet has the most moons?",
+			Options: []models.Option{
+				{ID: 1, Text: "Earth", IsCorrect: false},
+				{ID: 2, Text: "Mars", IsCorrect: false},
+				{ID: 3, Text: "Jupiter", IsCorrect: true},
+				{ID: 4, Text: "Venus", IsCorrect: false},
 			},
-			10: {
-				ID:   10,
-				Text: "What is the chemical symbol for gold?",
-				Options: []models.Option{
-					{ID: 1, Text: "Au", IsCorrect: true},
-					{ID: 2, Text: "Ag", IsCorrect: false},
-					{ID: 3, Text: "Gd", IsCorrect: false},
-					{ID: 4, Text: "Go", IsCorrect: false},
-				},
+		},
+		10: {
+			ID:   10,
+			Text: "What is the chemical symbol for gold?",
+			Options: []models.Option{
+				{ID: 1, Text: "Au", IsCorrect: true},
+				{ID: 2, Text: "Ag", IsCorrect: false},
+				{ID: 3, Text: "Gd", IsCorrect: false},
+				{ID: 4, Text: "Go", IsCorrect: false},
 			},
 		},
-		Submissions:  make(map[string]models.Result),
-		ScoreTracker: make(map[int]int),
 	}
 }
 
-func (s *memoryStorage) AddUserSubmission(submissionResult models.Result) {
+func (s *memoryStorage) AddUserSubmission(submission models.Result) (models.Result, error) {
 	s.Mutex.Lock()
 	defer s.Mutex.Unlock()
-	s.Submissions[submissionResult.UserName] = submissionResult
-	s.ScoreTracker[submissionResult.Score]++
+
+	return s.addUserSubmission(submission), nil
 }
 
-func (s *memoryStorage) GetUserSubmission(userName string) (models.Result, error) {
+func (s *memoryStorage) AddLimitedSubmission(submission models.Result, limits AttemptLimits) (models.Result, error) {
 	s.Mutex.Lock()
 	defer s.Mutex.Unlock()
 
-	submission, exists := s.Submissions[userName]
+	if submission.SubmittedAt.IsZero() {
+		submission.SubmittedAt = time.Now().UTC()
+	}
+	if err := limits.checkAttempts(s.Attempts[submission.QuizID][submission.UserName], submission.SubmittedAt); err != nil {
+		return models.Result{}, err
+	}
+	return s.addUserSubmission(submission), nil
+}
+
+func (s *memoryStorage) AddSessionSubmission(sessionID string, submission models.Result, limits AttemptLimits) (models.Result, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if submission.SubmittedAt.IsZero() {
+		submission.SubmittedAt = time.Now().UTC()
+	}
+	if err := s.checkSession(sessionID); err != nil {
+		return models.Result{}, err
+	}
+	if err := limits.checkAttempts(s.Attempts[submission.QuizID][submission.UserName], submission.SubmittedAt); err != nil {
+		return models.Result{}, err
+	}
+	s.finishSession(sessionID, submission.SubmittedAt)
+	return s.addUserSubmission(submission), nil
+}
+
+func (s *memoryStorage) addUserSubmission(submission models.Result) models.Result {
+	quizID := submission.QuizID
+	if s.Attempts[quizID] == nil {
+		s.Attempts[quizID] = make(map[string][]models.Result)
+		s.Submissions[quizID] = make(map[string]models.Result)
+	}
+
+	attempts := s.Attempts[quizID][submission.UserName]
+	submission.Attempt = len(attempts) + 1
+	if submission.SubmittedAt.IsZero() {
+		submission.SubmittedAt = time.Now().UTC()
+	}
+	s.Attempts[quizID][submission.UserName] = append(attempts, submission)
+
+	// keep the leaderboard listing every user once, with the attempt that is
+	// ranked
+	ranked, exists := s.Submissions[quizID][submission.UserName]
+	if !exists || s.Policy.replaces(ranked, submission) {
+		if exists {
+			s.Leaderboards[quizID] = s.Leaderboards[quizID].remove(ranked)
+		}
+		s.Submissions[quizID][submission.UserName] = submission
+		s.Leaderboards[quizID] = s.Leaderboards[quizID].insert(submission)
+	}
+	return submission
+}
+
+func (s *memoryStorage) GetUserSubmission(quizID, userName string) (models.Result, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	submission, exists := s.Submissions[quizID][userName]
 	if !exists {
-		return models.Result{}, errors.New("submission not found")
+		return models.Result{}, ErrSubmissionNotFound
 	}
 	return submission, nil
 }
 
-func (s *memoryStorage) CalculateScoreRankPercentage(score int) float64 {
+func (s *memoryStorage) GetUserAttempts(quizID, userName string) ([]models.Result, error) {
 	s.Mutex.RLock()
 	defer s.Mutex.RUnlock()
 
-	if score == 0 {
-		return 0.0
+	attempts := s.Attempts[quizID][userName]
+	if len(attempts) == 0 {
+		return nil, ErrSubmissionNotFound
 	}
+	return append([]models.Result(nil), attempts...), nil
+}
 
-	// subtracting 1 to exclude the current submission
-	totalScores := len(s.Submissions) - 1
+func (s *memoryStorage) RankingPolicy() RankingPolicy {
+	return s.Policy
+}
 
-	if totalScores == 0 {
-		return 100.0
+// rebuildRanking derives Submissions and Leaderboards from
+// Attempts under the current policy.
+func (s *memoryStorage) rebuildRanking() {
+	s.Submissions = make(map[string]map[string]models.Result, len(s.Attempts))
+	s.Leaderboards = make(map[string]leaderboard, len(s.Attempts))
+	for quizID, users := range s.Attempts {
+		s.Submissions[quizID] = make(map[string]models.Result, len(users))
+		board := make(leaderboard, 0, len(users))
+		for userName, attempts := range users {
+			ranked := s.Policy.RankedAttempt(attempts)
+			s.Submissions[quizID][userName] = ranked
+			board = append(board, ranked)
+		}
+		sortLeaderboard(board)
+		s.Leaderboards[quizID] = board
 	}
+}
+
+func (s *memoryStorage) GetQuestion(id int) (models.Question, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	return findQuestion(s.Questions, id)
+}
+
+func (s *memoryStorage) GetQuestions() []models.Question {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	return s.Questions
+}
+
+// GetQuestionSet returns the question set of the given version, or the
+// current one if version is 0.
+func (s *memoryStorage) GetQuestionSet(version int) (models.QuestionSet, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	if version == 0 {
+		version = s.Version
+	}
+	questions, exists := s.Versions[version]
+	if !exists {
+		return models.QuestionSet{}, ErrVersionNotFound
+	}
+	return models.QuestionSet{Version: version, Questions: questions}, nil
+}
+
+// SetQuestions atomically replaces the question set with a new version and
+// returns that version. Versions older than the last MaxRetainedVersions are
+// dropped unless a live session refers to them.
+func (s *memoryStorage) SetQuestions(questions []models.Question) (int, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	return s.setQuestions(questions), nil
+}
+
+func (s *memoryStorage) setQuestions(questions []models.Question) int {
+	s.Version++
+	s.Questions = questions
+	s.Versions[s.Version] = questions
+	s.pruneVersions()
+	return s.Version
+}
 
-	lowerScores := 0
-	for s, count := range s.ScoreTracker {
-		if s < score {
-			lowerScores += count
+// pruneVersions drops the versions older than the last MaxRetainedVersions
+// that no live session refers to. Sessions that were submitted or are past
+// their deadline cannot be graded anymore and keep no version. Callers must
+// hold the write lock.
+func (s *memoryStorage) pruneVersions() {
+	now := time.Now()
+	referenced := make(map[int]bool)
+	for _, session := range s.Sessions {
+		if session.FinishedAt == nil && session.Deadline.After(now) {
+			referenced[session.Version] = true
 		}
 	}
+	for version := range s.Versions {
+		if version <= s.Version-MaxRetainedVersions && !referenced[version] {
+			delete(s.Versions, version)
+		}
+	}
+}
+
+// CreateQuestion adds the question at the end of a new question set version.
+func (s *memoryStorage) CreateQuestion(question models.Question) (models.Question, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
 
-	return float64(lowerScores) / float64(totalScores) * 100
+	questions, created, err := createQuestion(s.Questions, question)
+	if err != nil {
+		return models.Question{}, err
+	}
+	s.setQuestions(questions)
+	return created, nil
 }
 
-func (s *memoryStorage) GetQuestion(id int) (models.Question, error) {
-	question, exists := s.Questions[id]
-	if !exists {
-		return models.Question{}, errors.New("question not found")
+// UpdateQuestion replaces the question with the same ID in a new question set
+// version.
+func (s *memoryStorage) UpdateQuestion(question models.Question) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	questions, err := updateQuestion(s.Questions, question)
+	if err != nil {
+		return err
 	}
-	return question, nil
+	s.setQuestions(questions)
+	return nil
 }
 
-func (s *memoryStorage) GetCorrectOption(questionId int) (models.Option, error) {
-	question, err := s.GetQuestion(questionId)
+func (s *memoryStorage) ModifyQuestion(id int, fn func(question models.Question) (models.Question, error)) (models.Question, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	questions, question, err := modifyQuestion(s.Questions, id, fn)
 	if err != nil {
-		return models.Option{}, err
+		return models.Question{}, err
 	}
-	for _, option := range question.Options {
-		if option.IsCorrect {
-			return option, nil
-		}
+	s.setQuestions(questions)
+	return question, nil
+}
+
+// DeleteQuestion removes the question from a new question set version.
+func (s *memoryStorage) DeleteQuestion(id int) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	quizzes := make([]models.Quiz, 0, len(s.Quizzes))
+	for _, quiz := range s.Quizzes {
+		quizzes = append(quizzes, quiz)
+	}
+	sort.Slice(quizzes, func(i, j int) bool {
+		return quizzes[i].ID < quizzes[j].ID
+	})
+	questions, err := deleteUnusedQuestion(s.Questions, quizzes, id)
+	if err != nil {
+		return err
 	}
-	return models.Option{}, errors.New("correct option not found")
+	s.setQuestions(questions)
+	return nil
 }
 
-func (s *memoryStorage) GetQuestions() []models.Question {
+// ReorderQuestions orders a new question set version as listed by ids.
+func (s *memoryStorage) ReorderQuestions(ids []int) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
 
-	keys := make([]int, 0, len(s.Questions))
-	for key := range s.Questions {
+	questions, err := reorderQuestions(s.Questions, ids)
+	if err != nil {
+		return err
+	}
+	s.setQuestions(questions)
+	return nil
+}
+
+// sortedQuestions returns the questions of the set ordered by ID.
+func sortedQuestions(set map[int]models.Question) []models.Question {
+	keys := make([]int, 0, len(set))
+	for key := range set {
 		keys = append(keys, key)
 	}
 
 	sort.Ints(keys)
 
-	questions := make([]models.Question, 0, len(s.Questions))
+	questions := make([]models.Question, 0, len(set))
 	for _, key := range keys {
-		questions = append(questions, s.Questions[key])
+		questions = append(questions, set[key])
 	}
 	return questions
 }
 
-func (s *memoryStorage) Count() int {
+// GetQuizzes returns every quiz ordered by ID.
+func (s *memoryStorage) GetQuizzes() []models.Quiz {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	quizzes := make([]models.Quiz, 0, len(s.Quizzes))
+	for _, quiz := range s.Quizzes {
+		quizzes = append(quizzes, quiz)
+	}
+	sort.Slice(quizzes, func(i, j int) bool {
+		return quizzes[i].ID < quizzes[j].ID
+	})
+	return quizzes
+}
+
+func (s *memoryStorage) GetQuiz(quizID string) (models.Quiz, error) {
 	s.Mutex.RLock()
 	defer s.Mutex.RUnlock()
-	return len(s.Questions)
+
+	quiz, exists := s.Quizzes[quizID]
+	if !exists {
+		return models.Quiz{}, ErrQuizNotFound
+	}
+	return quiz, nil
+}
+
+// SetQuizzes replaces every quiz. The default quiz is added if quizzes does
+// not define it. Submissions of removed quizzes are kept.
+func (s *memoryStorage) SetQuizzes(quizzes []models.Quiz) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+	s.setQuizzes(quizzes)
+	return nil
+}
+
+func (s *memoryStorage) setQuizzes(quizzes []models.Quiz) {
+	set := make(map[string]models.Quiz, len(quizzes)+1)
+	set[models.DefaultQuizID] = DefaultQuiz()
+	for _, quiz := range quizzes {
+		set[quiz.ID] = quiz
+	}
+	s.Quizzes = set
+}
+
+func (s *memoryStorage) SetQuestionBank(questions []models.Question, quizzes []models.Quiz) (int, error) {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	version := s.setQuestions(questions)
+	s.setQuizzes(quizzes)
+	return version, nil
+}
+
+func (s *memoryStorage) CreateSession(session models.Session) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	s.Sessions[session.ID] = session
+	return nil
+}
+
+func (s *memoryStorage) GetSession(id string) (models.Session, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	session, exists := s.Sessions[id]
+	if !exists {
+		return models.Session{}, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// checkSession returns ErrSessionNotFound or ErrSessionFinished unless the
+// session can be finished. Callers must hold s.Mutex.
+func (s *memoryStorage) checkSession(id string) error {
+	session, exists := s.Sessions[id]
+	if !exists {
+		return ErrSessionNotFound
+	}
+	if session.FinishedAt != nil {
+		return ErrSessionFinished
+	}
+	return nil
+}
+
+// finishSession marks the session as submitted. Callers must hold s.Mutex.
+func (s *memoryStorage) finishSession(id string, finishedAt time.Time) {
+	session := s.Sessions[id]
+	session.FinishedAt = &finishedAt
+	s.Sessions[id] = session
 }
@@ -2,80 +2,121 @@ package storage_test
 
 import (
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/courage173/quiz-api/internal/models"
 	"github.com/courage173/quiz-api/internal/storage"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+func addSubmission(t *testing.T, store storage.Storage, submission models.Result) models.Result {
+	t.Helper()
+	stored, err := store.AddUserSubmission(submission)
+	require.NoError(t, err)
+	return stored
+}
+
+func standing(t *testing.T, store storage.Storage, quizID string, window models.Window, percentage float64) models.Standing {
+	t.Helper()
+	standing, err := store.GetStanding(quizID, window, percentage)
+	require.NoError(t, err)
+	return standing
+}
+
 func TestMemoryStorage_AddUserSubmission(t *testing.T) {
-	store := storage.NewStorage()
+	store := storage.NewStorage(storage.RankLatest)
 
 	// Test adding a new user submission
 	submission := models.Result{
+		QuizID:                models.DefaultQuizID,
 		UserName:              "testUser",
 		Score:                 8,
 		TotalQuestionAnswered: 10,
 	}
-	store.AddUserSubmission(submission)
+	stored := addSubmission(t, store, submission)
+	assert.Equal(t, 1, stored.Attempt)
+	assert.False(t, stored.SubmittedAt.IsZero())
 
 	// Check if the submission was added correctly
-	retrievedSubmission, err := store.GetUserSubmission("testUser")
+	retrievedSubmission, err := store.GetUserSubmission(models.DefaultQuizID, "testUser")
 	assert.NoError(t, err)
-	assert.Equal(t, submission, retrievedSubmission)
+	assert.Equal(t, stored, retrievedSubmission)
 }
 
 func TestMemoryStorage_GetUserSubmission(t *testing.T) {
-	store := storage.NewStorage()
+	store := storage.NewStorage(storage.RankLatest)
 
 	// Test retrieving an existing submission
 	submission := models.Result{
+		QuizID:                models.DefaultQuizID,
 		UserName:              "testUser",
 		Score:                 8,
 		TotalQuestionAnswered: 10,
 	}
-	store.AddUserSubmission(submission)
+	stored := addSubmission(t, store, submission)
 
-	retrievedSubmission, err := store.GetUserSubmission("testUser")
+	retrievedSubmission, err := store.GetUserSubmission(models.DefaultQuizID, "testUser")
 	assert.NoError(t, err)
-	assert.Equal(t, submission, retrievedSubmission)
+	assert.Equal(t, stored, retrievedSubmission)
 
 	// Test retrieving a non-existent submission
-	_, err = store.GetUserSubmission("nonExistentUser")
+	_, err = store.GetUserSubmission(models.DefaultQuizID, "nonExistentUser")
 	assert.Error(t, err)
 	assert.EqualError(t, err, "submission not found")
 }
 
-func TestMemoryStorage_CalculateScoreRankPercentage(t *testing.T) {
-	store := storage.NewStorage()
+func TestMemoryStorage_GetStanding(t *testing.T) {
+	testStanding(t, storage.NewStorage(storage.RankLatest))
+}
 
-	// Add multiple submissions with varying scores
-	store.AddUserSubmission(models.Result{UserName: "User1", Score: 5})
-	store.AddUserSubmission(models.Result{UserName: "User2", Score: 7})
-	store.AddUserSubmission(models.Result{UserName: "User3", Score: 8})
-	store.AddUserSubmission(models.Result{UserName: "User4", Score: 10})
+// testStanding checks the ranks, the counts and the percentiles of the
+// standings, and the percentages they are computed from.
+func testStanding(t *testing.T, store storage.Storage) {
+	assert.Equal(t, models.Standing{Rank: 1}, standing(t, store, models.DefaultQuizID, models.Window{}, 50))
 
-	//calculate for user 3
-	percentage := store.CalculateScoreRankPercentage(8)
-	formattedValue := fmt.Sprintf("%.2f", percentage)
-	assert.Equal(t, "66.67", formattedValue)
-}
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 0, MaxScore: 10, Percentage: 0})
+	// a sole participant is in the middle, even with a score of 0
+	assert.Equal(t, 50.0, standing(t, store, models.DefaultQuizID, models.Window{}, 0).Percentile())
 
-func TestMemoryStorage_GetCorrectOption(t *testing.T) {
-	store := storage.NewStorage()
+	for _, submission := range []struct {
+		userName   string
+		percentage float64
+	}{{"User2", 70}, {"User3", 80}, {"User4", 100}, {"User5", 70}} {
+		addSubmission(t, store, models.Result{
+			QuizID: models.DefaultQuizID, UserName: submission.userName,
+			Score: submission.percentage / 10, MaxScore: 10, Percentage: submission.percentage,
+		})
+	}
 
-	option, err := store.GetCorrectOption(1)
-	assert.NoError(t, err)
-	assert.Equal(t, models.Option{ID: 3, Text: "Paris", IsCorrect: true}, option)
+	third := standing(t, store, models.DefaultQuizID, models.Window{}, 80)
+	assert.Equal(t, models.Standing{Rank: 2, Participants: 5, Lower: 3, Tied: 1}, third)
+	assert.Equal(t, 70.0, third.Percentile())
 
-	_, err = store.GetCorrectOption(999)
-	assert.Error(t, err)
-	assert.EqualError(t, err, "question not found")
+	// ties share the rank and the percentile
+	tied := standing(t, store, models.DefaultQuizID, models.Window{}, 70)
+	assert.Equal(t, models.Standing{Rank: 3, Participants: 5, Lower: 1, Tied: 2}, tied)
+	assert.Equal(t, 40.0, tied.Percentile())
+
+	assert.Equal(t, 10.0, standing(t, store, models.DefaultQuizID, models.Window{}, 0).Percentile())
+
+	// resubmitting ranks the latest attempt instead of counting the user twice
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User4", Score: 2, MaxScore: 10, Percentage: 20})
+	assert.Equal(t, models.Standing{Rank: 1, Participants: 5, Lower: 4, Tied: 1}, standing(t, store, models.DefaultQuizID, models.Window{}, 80))
+
+	percentages, err := store.GetRankedPercentages(models.DefaultQuizID, models.Window{})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{80, 70, 70, 20, 0}, percentages)
+
+	percentages, err = store.GetRankedPercentages("space", models.Window{})
+	require.NoError(t, err)
+	assert.Empty(t, percentages)
 }
 
 func TestMemoryStorage_GetQuestions(t *testing.T) {
-	store := storage.NewStorage()
+	store := storage.NewStorage(storage.RankLatest)
 
 	// Test that all questions are returned
 	questions := store.GetQuestions()
@@ -85,9 +126,754 @@ func TestMemoryStorage_GetQuestions(t *testing.T) {
 	assert.Equal(t, "What is the capital of France?", questions[0].Text)
 }
 
-func TestMemoryStorage_Count(t *testing.T) {
-	store := storage.NewStorage()
+func TestMemoryStorage_SetQuestions(t *testing.T) {
+	store := storage.NewStorage(storage.RankLatest)
+
+	version, err := store.SetQuestions([]models.Question{
+		{ID: 2, Text: "Question 2", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}}},
+		{ID: 1, Text: "Question 1", Options: []models.Option{{ID: 1, Text: "B", IsCorrect: true}}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	// the questions keep the order they were given in
+	questions := store.GetQuestions()
+	assert.Len(t, store.GetQuestions(), 2)
+	assert.Equal(t, 2, questions[0].ID)
+	assert.Equal(t, 1, questions[1].ID)
+}
+
+func TestMemoryStorage_QuestionCRUD(t *testing.T) {
+	testQuestionCRUD(t, storage.NewStorage(storage.RankLatest))
+}
+
+// testQuestionCRUD exercises the question management of a storage seeded with
+// the default questions.
+func testQuestionCRUD(t *testing.T, store storage.Storage) {
+	options := []models.Option{{ID: 1, Text: "A", IsCorrect: true}, {ID: 2, Text: "B"}}
+
+	created, err := store.CreateQuestion(models.Question{Text: "New", Options: options})
+	assert.NoError(t, err)
+	assert.Equal(t, 11, created.ID)
+	assert.Len(t, store.GetQuestions(), 11)
+
+	_, err = store.CreateQuestion(models.Question{ID: 3, Text: "Duplicate", Options: options})
+	assert.ErrorIs(t, err, storage.ErrQuestionExists)
+
+	created.Text = "Updated"
+	assert.NoError(t, store.UpdateQuestion(created))
+	question, err := store.GetQuestion(11)
+	assert.NoError(t, err)
+	assert.Equal(t, "Updated", question.Text)
+	assert.Equal(t, options, question.Options)
+
+	assert.ErrorIs(t, store.UpdateQuestion(models.Question{ID: 99, Text: "Missing"}), storage.ErrQuestionNotFound)
+
+	assert.NoError(t, store.DeleteQuestion(1))
+	assert.ErrorIs(t, store.DeleteQuestion(1), storage.ErrQuestionNotFound)
+	_, err = store.GetQuestion(1)
+	assert.ErrorIs(t, err, storage.ErrQuestionNotFound)
+
+	assert.NoError(t, store.ReorderQuestions([]int{11, 10, 9, 8, 7, 6, 5, 4, 3, 2}))
+	questions := store.GetQuestions()
+	assert.Equal(t, 11, questions[0].ID)
+	assert.Equal(t, 2, questions[9].ID)
+
+	assert.ErrorIs(t, store.ReorderQuestions([]int{11, 10}), storage.ErrInvalidOrder)
+	assert.ErrorIs(t, store.ReorderQuestions([]int{11, 11, 9, 8, 7, 6, 5, 4, 3, 2}), storage.ErrInvalidOrder)
+
+	// every change is a new version, so the original set is still available
+	original, err := store.GetQuestionSet(1)
+	assert.NoError(t, err)
+	assert.Len(t, original.Questions, 10)
+	current, err := store.GetQuestionSet(0)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, current.Version)
+
+	numeric, err := store.CreateQuestion(models.Question{
+		Type: models.QuestionNumeric, Text: "Pi?", NumericKey: &models.NumericKey{Value: 3.14, Tolerance: 0.01}, Explanation: "Roughly 22/7.",
+		Tags: []string{"math", "geometry"}, Difficulty: models.DifficultyHard,
+	})
+	assert.NoError(t, err)
+	question, err = store.GetQuestion(numeric.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, models.QuestionNumeric, question.Type)
+	assert.Equal(t, numeric.NumericKey, question.NumericKey)
+	assert.Equal(t, "Roughly 22/7.", question.Explanation)
+	assert.Equal(t, []string{"math", "geometry"}, question.Tags)
+	assert.Equal(t, models.DifficultyHard, question.Difficulty)
+	assert.Empty(t, question.Options)
+}
+
+func TestMemoryStorage_QuestionsInUse(t *testing.T) {
+	testQuestionsInUse(t, storage.NewStorage(storage.RankLatest))
+}
+
+// testQuestionsInUse checks that questions are modified in place and that
+// the questions quizzes ask cannot be deleted.
+func testQuestionsInUse(t *testing.T, store storage.Storage) {
+	_, err := store.SetQuestionBank([]models.Question{
+		{ID: 1, Text: "One", Tags: []string{"space"}, Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}}},
+		{ID: 2, Text: "Two", Tags: []string{"space"}, Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}}},
+		{ID: 3, Text: "Three", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}}},
+		{ID: 4, Text: "Four", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}}},
+	}, []models.Quiz{
+		{ID: "listed", Title: "Listed", QuestionIDs: []int{3}},
+		{ID: "drawn", Title: "Drawn", Blueprint: []models.BlueprintRule{{Tag: "space", Count: 2}}},
+	})
+	require.NoError(t, err)
+
+	modified, err := store.ModifyQuestion(4, func(question models.Question) (models.Question, error) {
+		question.Text += " and a half"
+		return question, nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Four and a half", modified.Text)
+	stored, err := store.GetQuestion(4)
+	require.NoError(t, err)
+	assert.Equal(t, modified, stored)
+
+	_, err = store.ModifyQuestion(9, func(question models.Question) (models.Question, error) {
+		return question, nil
+	})
+	assert.ErrorIs(t, err, storage.ErrQuestionNotFound)
+
+	err = store.DeleteQuestion(3)
+	assert.ErrorIs(t, err, storage.ErrQuestionInUse)
+	assert.EqualError(t, err, `question is used by quiz "listed"`)
+	assert.ErrorIs(t, store.DeleteQuestion(1), storage.ErrQuestionInUse, "the blueprint needs both space questions")
+	assert.NoError(t, store.DeleteQuestion(4))
+	assert.Len(t, store.GetQuestions(), 3)
+}
+
+func TestMemoryStorage_GetQuestionSet(t *testing.T) {
+	store := storage.NewStorage(storage.RankLatest)
+
+	version, err := store.SetQuestions([]models.Question{
+		{ID: 1, Text: "Reloaded", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}}},
+	})
+	assert.NoError(t, err)
+
+	current, err := store.GetQuestionSet(0)
+	assert.NoError(t, err)
+	assert.Equal(t, version, current.Version)
+	assert.Equal(t, "Reloaded", current.Questions[0].Text)
+
+	// the previous version stays available for grading in-flight submissions
+	previous, err := store.GetQuestionSet(version - 1)
+	assert.NoError(t, err)
+	assert.Len(t, previous.Questions, 10)
+
+	for i := 0; i < storage.MaxRetainedVersions; i++ {
+		_, err := store.SetQuestions(current.Questions)
+		assert.NoError(t, err)
+	}
+	_, err = store.GetQuestionSet(version - 1)
+	assert.ErrorIs(t, err, storage.ErrVersionNotFound)
+}
+
+func TestMemoryStorage_SessionVersions(t *testing.T) {
+	testSessionVersions(t, storage.NewStorage(storage.RankLatest))
+}
+
+// testSessionVersions checks that versions older than the retained ones are
+// kept while a live session refers to them, and pruned once it is submitted
+// or past its deadline.
+func testSessionVersions(t *testing.T, store storage.Storage) {
+	questions := []models.Question{{ID: 1, Text: "Pinned", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}}}}
+	now := time.Now().UTC()
+	startSession := func(id string, deadline time.Time) int {
+		version, err := store.SetQuestions(questions)
+		require.NoError(t, err)
+		require.NoError(t, store.CreateSession(models.Session{
+			ID: id, QuizID: models.DefaultQuizID, UserName: id, Version: version, StartedAt: now.Add(-time.Minute), Deadline: deadline,
+		}))
+		return version
+	}
+	live := startSession("live", now.Add(time.Hour))
+	expired := startSession("expired", now.Add(-time.Second))
+	submitted := startSession("submitted", now.Add(time.Hour))
+	_, err := store.AddSessionSubmission("submitted", models.Result{QuizID: models.DefaultQuizID, UserName: "submitted", SubmittedAt: now}, storage.AttemptLimits{})
+	require.NoError(t, err)
+
+	for i := 0; i < storage.MaxRetainedVersions; i++ {
+		_, err := store.SetQuestions(questions)
+		require.NoError(t, err)
+	}
+	pinned, err := store.GetQuestionSet(live)
+	require.NoError(t, err)
+	assert.Equal(t, "Pinned", pinned.Questions[0].Text)
+	_, err = store.GetQuestionSet(expired)
+	assert.ErrorIs(t, err, storage.ErrVersionNotFound)
+	_, err = store.GetQuestionSet(submitted)
+	assert.ErrorIs(t, err, storage.ErrVersionNotFound)
+
+	// the version goes with the next change once the session is submitted
+	_, err = store.AddSessionSubmission("live", models.Result{QuizID: models.DefaultQuizID, UserName: "live", SubmittedAt: now}, storage.AttemptLimits{})
+	require.NoError(t, err)
+	_, err = store.SetQuestions(questions)
+	require.NoError(t, err)
+	_, err = store.GetQuestionSet(live)
+	assert.ErrorIs(t, err, storage.ErrVersionNotFound)
+}
+
+func TestMemoryStorage_Quizzes(t *testing.T) {
+	store := storage.NewStorage(storage.RankLatest)
+
+	quiz, err := store.GetQuiz(models.DefaultQuizID)
+	assert.NoError(t, err)
+	assert.Equal(t, storage.DefaultQuiz(), quiz)
+
+	err = store.SetQuizzes([]models.Quiz{{ID: "space", Title: "Space", QuestionIDs: []int{2, 9}}})
+	assert.NoError(t, err)
+
+	quizzes := store.GetQuizzes()
+	assert.Len(t, quizzes, 2)
+	assert.Equal(t, models.DefaultQuizID, quizzes[0].ID)
+	assert.Equal(t, []int{2, 9}, quizzes[1].QuestionIDs)
+
+	_, err = store.GetQuiz("unknown")
+	assert.ErrorIs(t, err, storage.ErrQuizNotFound)
+}
+
+func TestMemoryStorage_QuestionBank(t *testing.T) {
+	testQuestionBank(t, storage.NewStorage(storage.RankLatest))
+}
+
+// testQuestionBank checks that the questions and quizzes of a bank are
+// swapped in together.
+func testQuestionBank(t *testing.T, store storage.Storage) {
+	version, err := store.SetQuestionBank([]models.Question{
+		{ID: 1, Text: "Reloaded", Options: []models.Option{{ID: 1, Text: "A", IsCorrect: true}, {ID: 2, Text: "B"}}},
+	}, []models.Quiz{{ID: "space", Title: "Space", QuestionIDs: []int{1}}})
+	require.NoError(t, err)
+
+	current, err := store.GetQuestionSet(0)
+	require.NoError(t, err)
+	assert.Equal(t, version, current.Version)
+	require.Len(t, current.Questions, 1)
+	assert.Equal(t, "Reloaded", current.Questions[0].Text)
+
+	quiz, err := store.GetQuiz("space")
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, quiz.QuestionIDs)
+	_, err = store.GetQuiz(models.DefaultQuizID)
+	assert.NoError(t, err)
+}
+
+func TestMemoryStorage_RanksPerQuiz(t *testing.T) {
+	store := storage.NewStorage(storage.RankLatest)
+
+	store.AddUserSubmission(models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 5, MaxScore: 10, Percentage: 50})
+	store.AddUserSubmission(models.Result{QuizID: models.DefaultQuizID, UserName: "User2", Score: 7, MaxScore: 10, Percentage: 70})
+	store.AddUserSubmission(models.Result{QuizID: "space", UserName: "User1", Score: 1, MaxScore: 10, Percentage: 10})
+	store.AddUserSubmission(models.Result{QuizID: "space", UserName: "User2", Score: 2, MaxScore: 10, Percentage: 20})
+
+	assert.Equal(t, 1, standing(t, store, models.DefaultQuizID, models.Window{}, 70).Rank)
+	assert.Equal(t, 2, standing(t, store, "space", models.Window{}, 10).Rank)
+
+	submission, err := store.GetUserSubmission("space", "User1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, submission.Score)
+}
+
+func TestMemoryStorage_Attempts(t *testing.T) {
+	testAttempts(t, func(policy storage.RankingPolicy) storage.Storage {
+		return storage.NewStorage(policy)
+	})
+}
+
+// testAttempts checks that every attempt is kept and that each user is
+// ranked once, with the attempt the policy picks.
+func testAttempts(t *testing.T, open func(policy storage.RankingPolicy) storage.Storage) {
+	tests := []struct {
+		policy     storage.RankingPolicy
+		wantRanked int
+		wantScore  float64
+		wantRank   int
+	}{
+		// User1 scores 5, 9 and 3; User2 scores 6
+		{storage.RankBest, 2, 9, 1},
+		{storage.RankLatest, 3, 3, 2},
+		{storage.RankFirst, 1, 5, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.policy), func(t *testing.T) {
+			store := open(tt.policy)
+			assert.Equal(t, tt.policy, store.RankingPolicy())
+
+			for _, score := range []float64{5, 9, 3} {
+				addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: score, MaxScore: 10, Percentage: score * 10, TotalQuestionAnswered: 10})
+			}
+			addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User2", Score: 6, MaxScore: 10, Percentage: 60, TotalQuestionAnswered: 10})
+
+			attempts, err := store.GetUserAttempts(models.DefaultQuizID, "User1")
+			require.NoError(t, err)
+			require.Len(t, attempts, 3)
+			for i, attempt := range attempts {
+				assert.Equal(t, i+1, attempt.Attempt)
+			}
+			assert.Equal(t, 9.0, attempts[1].Score)
+
+			ranked, err := store.GetUserSubmission(models.DefaultQuizID, "User1")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantRanked, ranked.Attempt)
+			assert.Equal(t, tt.wantScore, ranked.Score)
+
+			// User1 is counted once, whichever attempt is ranked
+			assert.Equal(t, models.Standing{Rank: tt.wantRank, Participants: 2, Lower: 2 - tt.wantRank, Tied: 1},
+				standing(t, store, models.DefaultQuizID, models.Window{}, ranked.Percentage))
+
+			_, err = store.GetUserAttempts(models.DefaultQuizID, "User3")
+			assert.ErrorIs(t, err, storage.ErrSubmissionNotFound)
+		})
+	}
+}
+
+func TestMemoryStorage_ConcurrentSubmissions(t *testing.T) {
+	testConcurrentSubmissions(t, storage.NewStorage(storage.RankLatest))
+}
+
+// testConcurrentSubmissions checks that parallel submissions of the same user
+// all succeed and are numbered without gaps or duplicates.
+func testConcurrentSubmissions(t *testing.T, store storage.Storage) {
+	const submissions = 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, submissions)
+	for i := 0; i < submissions; i++ {
+		wg.Add(1)
+		go func(score float64) {
+			defer wg.Done()
+			_, err := store.AddUserSubmission(models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: score, MaxScore: submissions, Percentage: score * 100 / submissions})
+			errs <- err
+		}(float64(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	attempts, err := store.GetUserAttempts(models.DefaultQuizID, "User1")
+	require.NoError(t, err)
+	require.Len(t, attempts, submissions)
+	for i, attempt := range attempts {
+		assert.Equal(t, i+1, attempt.Attempt)
+	}
+}
+
+func TestMemoryStorage_AttemptLimits(t *testing.T) {
+	testAttemptLimits(t, storage.NewStorage(storage.RankLatest))
+}
+
+// testAttemptLimits checks that the limits hold against parallel submissions
+// and that the cooldown is measured from the latest attempt.
+func testAttemptLimits(t *testing.T, store storage.Storage) {
+	limits := storage.AttemptLimits{MaxAttempts: 3}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := store.AddLimitedSubmission(models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 5, MaxScore: 10, Percentage: 50}, limits)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	stored := 0
+	for err := range errs {
+		if err == nil {
+			stored++
+		} else {
+			assert.ErrorIs(t, err, storage.ErrNoAttemptsLeft)
+		}
+	}
+	assert.Equal(t, 3, stored)
+	attempts, err := store.GetUserAttempts(models.DefaultQuizID, "User1")
+	require.NoError(t, err)
+	assert.Len(t, attempts, 3)
+
+	submittedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cooldown := storage.AttemptLimits{Cooldown: time.Minute}
+	_, err = store.AddLimitedSubmission(models.Result{QuizID: models.DefaultQuizID, UserName: "User2", SubmittedAt: submittedAt}, cooldown)
+	require.NoError(t, err)
+	_, err = store.AddLimitedSubmission(models.Result{QuizID: models.DefaultQuizID, UserName: "User2", SubmittedAt: submittedAt.Add(59 * time.Second)}, cooldown)
+	assert.ErrorIs(t, err, storage.ErrCoolingDown)
+	second, err := store.AddLimitedSubmission(models.Result{QuizID: models.DefaultQuizID, UserName: "User2", SubmittedAt: submittedAt.Add(time.Minute)}, cooldown)
+	require.NoError(t, err)
+	assert.Equal(t, 2, second.Attempt)
+}
+
+func TestMemoryStorage_Leaderboard(t *testing.T) {
+	testLeaderboard(t, storage.NewStorage(storage.RankLatest))
+}
+
+// testLeaderboard checks the order, the pages and the competition ranks of
+// the leaderboard.
+func testLeaderboard(t *testing.T, store storage.Storage) {
+	// ties go to the faster session and then by name
+	for _, submission := range []struct {
+		userName   string
+		percentage float64
+		elapsed    int64
+	}{{"A", 40, 0}, {"F", 80, 20000}, {"B", 90, 0}, {"D", 50, 0}, {"C", 80, 30000}, {"E", 80, 20000}, {"A", 95, 0}} {
+		addSubmission(t, store, models.Result{
+			QuizID: models.DefaultQuizID, UserName: submission.userName,
+			Score: submission.percentage / 10, MaxScore: 10, Percentage: submission.percentage, ElapsedMillis: submission.elapsed,
+		})
+	}
+	ranks := func(entries []models.LeaderboardEntry) []string {
+		ranked := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ranked = append(ranked, fmt.Sprintf("%d %s", entry.Rank, entry.UserName))
+		}
+		return ranked
+	}
+
+	var pages [][]string
+	var after *models.LeaderboardCursor
+	for {
+		entries, err := store.GetLeaderboard(models.DefaultQuizID, models.Window{}, after, 2)
+		require.NoError(t, err)
+		if len(entries) == 0 {
+			break
+		}
+		pages = append(pages, ranks(entries))
+		last := entries[len(entries)-1]
+		after = &models.LeaderboardCursor{Percentage: last.Percentage, ElapsedMillis: last.ElapsedMillis, UserName: last.UserName}
+	}
+	assert.Equal(t, [][]string{{"1 A", "2 B"}, {"3 E", "3 F"}, {"3 C", "6 D"}}, pages)
+
+	top, err := store.GetLeaderboard(models.DefaultQuizID, models.Window{}, nil, 1)
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	assert.Equal(t, 2, top[0].Attempt)
+	assert.Equal(t, 9.5, top[0].Score)
+
+	around, err := store.GetLeaderboardAround(models.DefaultQuizID, "F", models.Window{}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"3 E", "3 F", "3 C"}, ranks(around))
+
+	around, err = store.GetLeaderboardAround(models.DefaultQuizID, "A", models.Window{}, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1 A", "2 B", "3 E"}, ranks(around))
+
+	_, err = store.GetLeaderboardAround(models.DefaultQuizID, "unknown", models.Window{}, 1)
+	assert.ErrorIs(t, err, storage.ErrSubmissionNotFound)
+
+	empty, err := store.GetLeaderboard("space", models.Window{}, nil, 10)
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+}
+
+func TestMemoryStorage_LeaderboardWindows(t *testing.T) {
+	testLeaderboardWindows(t, storage.NewStorage(storage.RankLatest))
+}
+
+// testLeaderboardWindows checks that the leaderboard and the percentiles of
+// a window only rank the attempts submitted in it.
+func testLeaderboardWindows(t *testing.T, store storage.Storage) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	for _, submission := range []struct {
+		userName    string
+		percentage  float64
+		submittedAt time.Time
+	}{
+		{"A", 90, day.Add(9 * time.Hour)},
+		{"B", 70, day.Add(10 * time.Hour)},
+		{"A", 50, day.Add(33 * time.Hour)},
+		{"C", 80, day.Add(34 * time.Hour)},
+		{"C", 60, day.Add(35 * time.Hour)},
+		// 23:00 on the second day in UTC
+		{"D", 40, time.Date(2024, 5, 3, 1, 0, 0, 0, time.FixedZone("CEST", 2*60*60))},
+	} {
+		addSubmission(t, store, models.Result{
+			QuizID: models.DefaultQuizID, UserName: submission.userName,
+			Score: submission.percentage / 10, MaxScore: 10, Percentage: submission.percentage,
+			SubmittedAt: submission.submittedAt,
+		})
+	}
+	first := models.Window{From: day, To: day.Add(24 * time.Hour)}
+	second := models.Window{From: day.Add(24 * time.Hour), To: day.Add(48 * time.Hour)}
+	ranks := func(entries []models.LeaderboardEntry) []string {
+		ranked := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ranked = append(ranked, fmt.Sprintf("%d %s %g", entry.Rank, entry.UserName, entry.Percentage))
+		}
+		return ranked
+	}
+
+	entries, err := store.GetLeaderboard(models.DefaultQuizID, first, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1 A 90", "2 B 70"}, ranks(entries))
+
+	entries, err = store.GetLeaderboard(models.DefaultQuizID, second, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1 C 60", "2 A 50", "3 D 40"}, ranks(entries))
+
+	entries, err = store.GetLeaderboard(models.DefaultQuizID, second, &models.LeaderboardCursor{Percentage: 60, UserName: "C"}, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2 A 50"}, ranks(entries))
+
+	entries, err = store.GetLeaderboard(models.DefaultQuizID, models.Window{From: day.Add(24 * time.Hour)}, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1 C 60", "2 A 50", "3 D 40"}, ranks(entries))
+
+	around, err := store.GetLeaderboardAround(models.DefaultQuizID, "D", second, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"2 A 50", "3 D 40"}, ranks(around))
+
+	_, err = store.GetLeaderboardAround(models.DefaultQuizID, "B", second, 1)
+	assert.ErrorIs(t, err, storage.ErrSubmissionNotFound)
+
+	assert.Equal(t, 1, standing(t, store, models.DefaultQuizID, first, 90).Rank)
+	assert.Equal(t, 2, standing(t, store, models.DefaultQuizID, first, 70).Rank)
+	assert.Equal(t, models.Standing{Rank: 2, Participants: 3, Lower: 1, Tied: 1}, standing(t, store, models.DefaultQuizID, second, 50))
+	assert.Equal(t, models.Standing{Rank: 1}, standing(t, store, models.DefaultQuizID, models.Window{From: day.Add(48 * time.Hour)}, 50))
+
+	percentages, err := store.GetRankedPercentages(models.DefaultQuizID, second)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{60, 50, 40}, percentages)
+
+	// the all time leaderboard still ranks the latest attempts
+	entries, err = store.GetLeaderboard(models.DefaultQuizID, models.Window{}, nil, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"1 B 70", "2 C 60", "3 A 50", "4 D 40"}, ranks(entries))
+}
+
+func TestMemoryStorage_Sessions(t *testing.T) {
+	testSessions(t, storage.NewStorage(storage.RankLatest))
+}
+
+func testSessions(t *testing.T, store storage.Storage) {
+	startedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	session := models.Session{
+		ID:             "abc",
+		QuizID:         models.DefaultQuizID,
+		UserName:       "User1",
+		Version:        1,
+		StartedAt:      startedAt,
+		Deadline:       startedAt.Add(time.Minute),
+		Seed:           -42,
+		ShuffleOptions: true,
+		QuestionIDs:    []int{7, 2},
+		Feedback:       models.FeedbackResults,
+	}
+	require.NoError(t, store.CreateSession(session))
+
+	stored, err := store.GetSession("abc")
+	require.NoError(t, err)
+	assert.True(t, session.Deadline.Equal(stored.Deadline))
+	assert.Equal(t, int64(-42), stored.Seed)
+	assert.False(t, stored.ShuffleQuestions)
+	assert.True(t, stored.ShuffleOptions)
+	assert.Equal(t, []int{7, 2}, stored.QuestionIDs)
+	assert.Equal(t, models.FeedbackResults, stored.Feedback)
+	assert.Nil(t, stored.FinishedAt)
+
+	// a submission the limits reject leaves the session open
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 1, MaxScore: 2, Percentage: 50, SubmittedAt: startedAt})
+	finishedAt := startedAt.Add(30 * time.Second)
+	submission := models.Result{QuizID: models.DefaultQuizID, UserName: "User1", Score: 2, MaxScore: 2, Percentage: 100, SubmittedAt: finishedAt}
+	_, err = store.AddSessionSubmission("abc", submission, storage.AttemptLimits{Cooldown: time.Minute})
+	assert.ErrorIs(t, err, storage.ErrCoolingDown)
+	stored, err = store.GetSession("abc")
+	require.NoError(t, err)
+	assert.Nil(t, stored.FinishedAt)
+
+	submitted, err := store.AddSessionSubmission("abc", submission, storage.AttemptLimits{Cooldown: time.Second})
+	require.NoError(t, err)
+	assert.Equal(t, 2, submitted.Attempt)
+	_, err = store.AddSessionSubmission("abc", submission, storage.AttemptLimits{})
+	assert.ErrorIs(t, err, storage.ErrSessionFinished)
+
+	stored, err = store.GetSession("abc")
+	require.NoError(t, err)
+	require.NotNil(t, stored.FinishedAt)
+	assert.True(t, finishedAt.Equal(*stored.FinishedAt))
+	attempts, err := store.GetUserAttempts(models.DefaultQuizID, "User1")
+	require.NoError(t, err)
+	assert.Len(t, attempts, 2)
+
+	_, err = store.GetSession("unknown")
+	assert.ErrorIs(t, err, storage.ErrSessionNotFound)
+	_, err = store.AddSessionSubmission("unknown", submission, storage.AttemptLimits{})
+	assert.ErrorIs(t, err, storage.ErrSessionNotFound)
+}
+
+func TestMemoryStorage_Teams(t *testing.T) {
+	testTeams(t, storage.NewStorage(storage.RankLatest))
+}
+
+func testTeams(t *testing.T, store storage.Storage) {
+	teams, err := store.GetTeams()
+	require.NoError(t, err)
+	assert.Empty(t, teams)
+
+	require.NoError(t, store.CreateTeam(models.Team{ID: "red", Name: "Red", Members: []string{"Bob", "Ann", "Bob"}}))
+	require.NoError(t, store.CreateTeam(models.Team{ID: "blue", Name: "Blue"}))
+	assert.ErrorIs(t, store.CreateTeam(models.Team{ID: "red", Name: "Other"}), storage.ErrTeamExists)
+
+	red, err := store.GetTeam("red")
+	require.NoError(t, err)
+	assert.Equal(t, models.Team{ID: "red", Name: "Red", Members: []string{"Ann", "Bob"}}, red)
+
+	require.NoError(t, store.AddTeamMember("blue", "Ann"))
+	require.NoError(t, store.AddTeamMember("blue", "Ann"))
+	require.NoError(t, store.AddTeamMember("blue", "Cid"))
+	assert.ErrorIs(t, store.AddTeamMember("green", "Ann"), storage.ErrTeamNotFound)
+
+	require.NoError(t, store.RemoveTeamMember("red", "Bob"))
+	assert.ErrorIs(t, store.RemoveTeamMember("red", "Bob"), storage.ErrMemberNotFound)
+	assert.ErrorIs(t, store.RemoveTeamMember("green", "Bob"), storage.ErrTeamNotFound)
+
+	teams, err = store.GetTeams()
+	require.NoError(t, err)
+	assert.Equal(t, []models.Team{
+		{ID: "blue", Name: "Blue", Members: []string{"Ann", "Cid"}},
+		{ID: "red", Name: "Red", Members: []string{"Ann"}},
+	}, teams)
+
+	require.NoError(t, store.CreateTeam(models.Team{ID: "green", Name: "Green", Members: []string{"Dan"}}))
+	require.NoError(t, store.DeleteTeam("green"))
+	assert.ErrorIs(t, store.DeleteTeam("green"), storage.ErrTeamNotFound)
+	_, err = store.GetTeam("green")
+	assert.ErrorIs(t, err, storage.ErrTeamNotFound)
+
+	// a team created again under the ID of a deleted one starts out empty
+	require.NoError(t, store.CreateTeam(models.Team{ID: "green", Name: "Green"}))
+	green, err := store.GetTeam("green")
+	require.NoError(t, err)
+	assert.Empty(t, green.Members)
+	require.NoError(t, store.DeleteTeam("green"))
+}
+
+func TestMemoryStorage_Users(t *testing.T) {
+	testUsers(t, storage.NewStorage(storage.RankLatest))
+}
+
+func testUsers(t *testing.T, store storage.Storage) {
+	ann := models.User{ID: "u1", UserName: "Ann", PasswordHash: "hash", Role: models.RoleParticipant, CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)}
+	require.NoError(t, store.CreateUser(ann))
+	assert.ErrorIs(t, store.CreateUser(models.User{ID: "u2", UserName: "Ann", PasswordHash: "other"}), storage.ErrUserExists)
+	assert.ErrorIs(t, store.CreateUser(models.User{ID: "u1", UserName: "Bob", PasswordHash: "other"}), storage.ErrUserExists)
+
+	user, err := store.GetUser("u1")
+	require.NoError(t, err)
+	assert.Equal(t, ann, user)
+	user, err = store.GetUserByName("Ann")
+	require.NoError(t, err)
+	assert.Equal(t, ann, user)
+
+	_, err = store.GetUser("u2")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = store.GetUserByName("Bob")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	// users without a role are participants
+	require.NoError(t, store.CreateUser(models.User{ID: "u2", UserName: "Bob", PasswordHash: "hash"}))
+	require.NoError(t, store.SetUserRole("u1", models.RoleAuthor))
+	assert.ErrorIs(t, store.SetUserRole("u3", models.RoleAuthor), storage.ErrUserNotFound)
+	users, err := store.GetUsers()
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "Ann", users[0].UserName)
+	assert.Equal(t, models.RoleAuthor, users[0].Role)
+	assert.Equal(t, models.RoleParticipant, users[1].Role)
+
+	// attempts keep the account they were made with
+	addSubmission(t, store, models.Result{QuizID: models.DefaultQuizID, UserName: "Ann", UserID: "u1", Score: 1, MaxScore: 2, Percentage: 50})
+	submission, err := store.GetUserSubmission(models.DefaultQuizID, "Ann")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", submission.UserID)
+	attempts, err := store.GetUserAttempts(models.DefaultQuizID, "Ann")
+	require.NoError(t, err)
+	require.Len(t, attempts, 1)
+	assert.Equal(t, "u1", attempts[0].UserID)
+
+	// names with attempts from before accounts cannot be registered
+	addSubmission(t, store, models.Result{QuizID: "space", UserName: "Cid", Score: 1, MaxScore: 2, Percentage: 50})
+	assert.ErrorIs(t, store.CreateUser(models.User{ID: "u3", UserName: "Cid", PasswordHash: "hash"}), storage.ErrUserNameUsed)
+	_, err = store.GetUserByName("Cid")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+func TestMemoryStorage_APIKeys(t *testing.T) {
+	testAPIKeys(t, storage.NewStorage(storage.RankLatest))
+}
+
+func testAPIKeys(t *testing.T, store storage.Storage) {
+	created := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ci := models.APIKey{ID: "k1", Name: "ci", Prefix: "qk_abc", Hash: "hash1", Scopes: []models.Scope{models.ScopeQuiz, models.ScopeQuestions}, CreatedAt: created}
+	bot := models.APIKey{ID: "k2", Name: "bot", Prefix: "qk_def", Hash: "hash2", UserID: "u1", Scopes: []models.Scope{models.ScopeQuiz}, CreatedAt: created}
+	require.NoError(t, store.CreateAPIKey(ci))
+	require.NoError(t, store.CreateAPIKey(bot))
+
+	key, err := store.GetAPIKeyByHash("hash1")
+	require.NoError(t, err)
+	assert.Equal(t, ci, key)
+	_, err = store.GetAPIKeyByHash("hash3")
+	assert.ErrorIs(t, err, storage.ErrAPIKeyNotFound)
+
+	revoked := created.Add(time.Hour)
+	require.NoError(t, store.RevokeAPIKey("k1", revoked))
+	// revoking again keeps the first time
+	require.NoError(t, store.RevokeAPIKey("k1", revoked.Add(time.Hour)))
+	assert.ErrorIs(t, store.RevokeAPIKey("k3", revoked), storage.ErrAPIKeyNotFound)
+
+	keys, err := store.GetAPIKeys()
+	require.NoError(t, err)
+	require.Len(t, keys, 2)
+	assert.Equal(t, bot, keys[0])
+	assert.Equal(t, "ci", keys[1].Name)
+	require.NotNil(t, keys[1].RevokedAt)
+	assert.True(t, revoked.Equal(*keys[1].RevokedAt))
+}
+
+func TestMemoryStorage_IdempotencyKeys(t *testing.T) {
+	testIdempotencyKeys(t, storage.NewStorage(storage.RankLatest))
+}
+
+func testIdempotencyKeys(t *testing.T, store storage.Storage) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	record := models.IdempotencyRecord{Key: "u1:default:k1", Fingerprint: "f1", ExpiresAt: now.Add(time.Minute)}
+
+	reserved, err := store.ReserveIdempotencyKey(record, now)
+	require.NoError(t, err)
+	assert.Equal(t, record, reserved)
+
+	// a request in progress holds the key
+	existing, err := store.ReserveIdempotencyKey(models.IdempotencyRecord{Key: "u1:default:k1", Fingerprint: "f2", ExpiresAt: now.Add(time.Minute)}, now)
+	assert.ErrorIs(t, err, storage.ErrIdempotencyKeyUsed)
+	assert.Equal(t, "f1", existing.Fingerprint)
+	assert.Empty(t, existing.Response)
+
+	require.NoError(t, store.CompleteIdempotencyKey("u1:default:k1", []byte(`{"score":1}`), now.Add(time.Hour)))
+	existing, err = store.ReserveIdempotencyKey(record, now.Add(30*time.Minute))
+	assert.ErrorIs(t, err, storage.ErrIdempotencyKeyUsed)
+	assert.Equal(t, []byte(`{"score":1}`), existing.Response)
+	assert.True(t, now.Add(time.Hour).Equal(existing.ExpiresAt))
+
+	// expired records are replaced
+	_, err = store.ReserveIdempotencyKey(models.IdempotencyRecord{Key: "u1:default:k1", Fingerprint: "f3", ExpiresAt: now.Add(2 * time.Hour)}, now.Add(time.Hour))
+	require.NoError(t, err)
+
+	// even between the sweeps dropping them
+	later := now.Add(time.Hour)
+	_, err = store.ReserveIdempotencyKey(models.IdempotencyRecord{Key: "u1:default:k2", Fingerprint: "f1", ExpiresAt: later.Add(10 * time.Second)}, later)
+	require.NoError(t, err)
+	reserved, err = store.ReserveIdempotencyKey(models.IdempotencyRecord{Key: "u1:default:k2", Fingerprint: "f2", ExpiresAt: later.Add(time.Hour)}, later.Add(20*time.Second))
+	require.NoError(t, err)
+	assert.Equal(t, "f2", reserved.Fingerprint)
 
-	count := store.Count()
-	assert.Equal(t, 10, count)
+	// and released ones too
+	require.NoError(t, store.ReleaseIdempotencyKey("u1:default:k1"))
+	reserved, err = store.ReserveIdempotencyKey(record, now)
+	require.NoError(t, err)
+	assert.Equal(t, "f1", reserved.Fingerprint)
 }
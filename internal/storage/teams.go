@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"slices"
+	"sort"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// newTeam returns a copy of the team with its members ordered by name and
+// listed once.
+func newTeam(team models.Team) models.Team {
+	members := append([]string{}, team.Members...)
+	sort.Strings(members)
+	team.Members = slices.Compact(members)
+	return team
+}
+
+func (s *memoryStorage) GetTeams() ([]models.Team, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	teams := make([]models.Team, 0, len(s.Teams))
+	for _, team := range s.Teams {
+		teams = append(teams, newTeam(team))
+	}
+	sort.Slice(teams, func(i, j int) bool {
+		return teams[i].ID < teams[j].ID
+	})
+	return teams, nil
+}
+
+func (s *memoryStorage) GetTeam(id string) (models.Team, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	team, exists := s.Teams[id]
+	if !exists {
+		return models.Team{}, ErrTeamNotFound
+	}
+	return newTeam(team), nil
+}
+
+func (s *memoryStorage) CreateTeam(team models.Team) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if _, exists := s.Teams[team.ID]; exists {
+		return ErrTeamExists
+	}
+	s.Teams[team.ID] = newTeam(team)
+	return nil
+}
+
+func (s *memoryStorage) DeleteTeam(id string) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if _, exists := s.Teams[id]; !exists {
+		return ErrTeamNotFound
+	}
+	delete(s.Teams, id)
+	return nil
+}
+
+func (s *memoryStorage) AddTeamMember(teamID, userName string) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	team, exists := s.Teams[teamID]
+	if !exists {
+		return ErrTeamNotFound
+	}
+	team.Members = append(team.Members, userName)
+	s.Teams[teamID] = newTeam(team)
+	return nil
+}
+
+func (s *memoryStorage) RemoveTeamMember(teamID, userName string) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	team, exists := s.Teams[teamID]
+	if !exists {
+		return ErrTeamNotFound
+	}
+	i := slices.Index(team.Members, userName)
+	if i < 0 {
+		return ErrMemberNotFound
+	}
+	team.Members = slices.Delete(slices.Clone(team.Members), i, i+1)
+	s.Teams[teamID] = team
+	return nil
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"sort"
+
+	"github.com/courage173/quiz-api/internal/models"
+)
+
+// newUser returns the user with the participant role if it has none, as
+// users created before roles existed have.
+func newUser(user models.User) models.User {
+	if user.Role == "" {
+		user.Role = models.RoleParticipant
+	}
+	return user
+}
+
+func (s *memoryStorage) CreateUser(user models.User) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	if _, exists := s.Users[user.ID]; exists {
+		return ErrUserExists
+	}
+	if _, exists := s.userByName(user.UserName); exists {
+		return ErrUserExists
+	}
+	if s.hasAttempts(user.UserName) {
+		return ErrUserNameUsed
+	}
+	s.Users[user.ID] = newUser(user)
+	return nil
+}
+
+// hasAttempts reports whether attempts were submitted under the user name at
+// any quiz. Callers must hold s.Mutex.
+func (s *memoryStorage) hasAttempts(userName string) bool {
+	for _, attempts := range s.Attempts {
+		if len(attempts[userName]) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memoryStorage) GetUsers() ([]models.User, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	users := make([]models.User, 0, len(s.Users))
+	for _, user := range s.Users {
+		users = append(users, newUser(user))
+	}
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].UserName < users[j].UserName
+	})
+	return users, nil
+}
+
+func (s *memoryStorage) GetUser(id string) (models.User, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	user, exists := s.Users[id]
+	if !exists {
+		return models.User{}, ErrUserNotFound
+	}
+	return newUser(user), nil
+}
+
+func (s *memoryStorage) GetUserByName(userName string) (models.User, error) {
+	s.Mutex.RLock()
+	defer s.Mutex.RUnlock()
+
+	user, exists := s.userByName(userName)
+	if !exists {
+		return models.User{}, ErrUserNotFound
+	}
+	return newUser(user), nil
+}
+
+func (s *memoryStorage) SetUserRole(id string, role models.Role) error {
+	s.Mutex.Lock()
+	defer s.Mutex.Unlock()
+
+	user, exists := s.Users[id]
+	if !exists {
+		return ErrUserNotFound
+	}
+	user.Role = role
+	s.Users[id] = user
+	return nil
+}
+
+// userByName looks up a user by name. Callers must hold s.Mutex.
+func (s *memoryStorage) userByName(userName string) (models.User, bool) {
+	for _, user := range s.Users {
+		if user.UserName == userName {
+			return user, true
+		}
+	}
+	return models.User{}, false
+}
@@ -0,0 +1,156 @@
+package team
+
+import (
+	stderrors "errors"
+	"net/http"
+	"strconv"
+
+	"github.com/courage173/quiz-api/internal/errors"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+)
+
+// RegisterHandlers registers the routes listing and scoring teams. The quiz
+// query parameter selects the quiz the teams are scored at, the default quiz
+// if it is missing.
+func RegisterHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
+	rg.Get("", listTeams(service, logger))
+	rg.Get("/leaderboard", getTeamLeaderboard(service, logger))
+	rg.Get("/<id>", getTeam(service, logger))
+}
+
+// RegisterAdminHandlers registers the routes managing teams and their
+// members. The route group is expected to be protected by an admin-only
+// middleware.
+func RegisterAdminHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
+	rg.Post("", createTeam(service, logger))
+	rg.Delete("/<id>", deleteTeam(service, logger))
+	rg.Put("/<id>/members/<username>", addMember(service, logger))
+	rg.Delete("/<id>/members/<username>", removeMember(service, logger))
+}
+
+// toErrorResponse maps errors returned by the service to error responses.
+// Validation errors are passed on as they are.
+func toErrorResponse(err error) error {
+	switch {
+	case stderrors.Is(err, storage.ErrTeamNotFound), stderrors.Is(err, storage.ErrMemberNotFound), stderrors.Is(err, storage.ErrQuizNotFound),
+		stderrors.Is(err, storage.ErrUserNotFound):
+		return errors.NotFound(err.Error())
+	case stderrors.Is(err, storage.ErrTeamExists):
+		return errors.BadRequest(err.Error())
+	}
+	return err
+}
+
+// scoring returns the quiz, the aggregate and the number of members counted
+// by the best aggregate given as query parameters.
+func scoring(c *routing.Context) (string, models.TeamAggregate, int, error) {
+	quizID := c.Query("quiz", models.DefaultQuizID)
+	n := 0
+	if value := c.Query("n"); value != "" {
+		var err error
+		if n, err = strconv.Atoi(value); err != nil {
+			return "", "", 0, errors.BadRequest("The n must be a number")
+		}
+	}
+	return quizID, models.TeamAggregate(c.Query("aggregate")), n, nil
+}
+
+func listTeams(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.GetTeams()
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error listing teams: %v", err)
+			return err
+		}
+		return c.Write(response)
+	}
+}
+
+func getTeam(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		quizID, aggregate, n, err := scoring(c)
+		if err != nil {
+			return err
+		}
+
+		response, err := service.GetTeamScore(c.Param("id"), quizID, aggregate, n)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting team score: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func getTeamLeaderboard(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		quizID, aggregate, n, err := scoring(c)
+		if err != nil {
+			return err
+		}
+
+		response, err := service.GetTeamLeaderboard(quizID, aggregate, n)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting team leaderboard: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func createTeam(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req models.Team
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		response, err := service.CreateTeam(req)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error creating team: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.WriteWithStatus(response, http.StatusCreated)
+	}
+}
+
+func deleteTeam(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		if err := service.DeleteTeam(c.Param("id")); err != nil {
+			logger.With(c.Request.Context()).Errorf("Error deleting team: %v", err)
+			return toErrorResponse(err)
+		}
+		c.Response.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+}
+
+func addMember(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.AddMember(c.Param("id"), c.Param("username"))
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error adding team member: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func removeMember(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.RemoveMember(c.Param("id"), c.Param("username"))
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error removing team member: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
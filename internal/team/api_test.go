@@ -0,0 +1,84 @@
+package team_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/courage173/quiz-api/internal/errors"
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/internal/team"
+	"github.com/courage173/quiz-api/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRouter(t *testing.T) *routing.Router {
+	logger, _ := log.NewForTest()
+	router := routing.New()
+	router.Use(errors.Handler(logger), content.TypeNegotiator(content.JSON))
+
+	store := storage.NewStorage(storage.RankLatest)
+	for _, userName := range []string{"Ann", "Bob"} {
+		require.NoError(t, store.CreateUser(models.User{ID: userName, UserName: userName, Role: models.RoleParticipant}))
+	}
+	for userName, percentage := range map[string]float64{"Ann": 90, "Bob": 40} {
+		_, err := store.AddUserSubmission(models.Result{
+			QuizID: models.DefaultQuizID, UserName: userName,
+			Score: percentage / 10, MaxScore: 10, Percentage: percentage,
+		})
+		require.NoError(t, err)
+	}
+
+	service := team.NewService(store, logger)
+	team.RegisterHandlers(router.Group("/v1/teams"), service, logger)
+	team.RegisterAdminHandlers(router.Group("/v1/admin/teams"), service, logger)
+	return router
+}
+
+func TestTeamHandlers(t *testing.T) {
+	router := setupRouter(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"create", "POST", "/v1/admin/teams", `{"id":"red","name":"Red","members":["Bob"]}`, http.StatusCreated, `"members":["Bob"]`},
+		{"create invalid", "POST", "/v1/admin/teams", `{"id":"Red"}`, http.StatusBadRequest, "name"},
+		{"create existing", "POST", "/v1/admin/teams", `{"id":"red","name":"Red"}`, http.StatusBadRequest, "already exists"},
+		{"add member", "PUT", "/v1/admin/teams/red/members/Ann", "", http.StatusOK, `"members":["Ann","Bob"]`},
+		{"add member to unknown team", "PUT", "/v1/admin/teams/blue/members/Ann", "", http.StatusNotFound, "team not found"},
+		{"add unknown user", "PUT", "/v1/admin/teams/red/members/Zed", "", http.StatusNotFound, "user not found"},
+		{"list", "GET", "/v1/teams", "", http.StatusOK, `"id":"red"`},
+		{"get", "GET", "/v1/teams/red", "", http.StatusOK, `"score":130`},
+		{"get best", "GET", "/v1/teams/red?aggregate=best&n=1", "", http.StatusOK, `"score":90`},
+		{"get invalid n", "GET", "/v1/teams/red?aggregate=best&n=one", "", http.StatusBadRequest, "The n must be a number"},
+		{"get unknown quiz", "GET", "/v1/teams/red?quiz=space", "", http.StatusNotFound, "quiz not found"},
+		{"leaderboard", "GET", "/v1/teams/leaderboard?aggregate=average", "", http.StatusOK, `"entries":[{"rank":1,"teamId":"red","name":"Red","score":65,"participants":2}]`},
+		{"leaderboard invalid aggregate", "GET", "/v1/teams/leaderboard?aggregate=median", "", http.StatusBadRequest, "The aggregate must be"},
+		{"remove member", "DELETE", "/v1/admin/teams/red/members/Bob", "", http.StatusOK, `"members":["Ann"]`},
+		{"remove unknown member", "DELETE", "/v1/admin/teams/red/members/Bob", "", http.StatusNotFound, "not a member"},
+		{"delete", "DELETE", "/v1/admin/teams/red", "", http.StatusNoContent, ""},
+		{"get deleted", "GET", "/v1/teams/red", "", http.StatusNotFound, "team not found"},
+	}
+
+	// the cases build on each other and run in order
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, tt.wantCode, resp.Code, tt.name)
+		assert.Contains(t, resp.Body.String(), tt.wantBody, tt.name)
+	}
+}
@@ -0,0 +1,221 @@
+package team
+
+import (
+	stderrors "errors"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/courage173/quiz-api/internal/errors"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/pkg/log"
+)
+
+// DefaultBestN is the number of members counted by the best aggregate if no
+// number is given.
+const DefaultBestN = 3
+
+// Service manages teams and scores them at quizzes from the ranked attempts
+// of their members.
+type Service interface {
+	GetTeams() ([]models.Team, error)
+	GetTeamScore(teamID, quizID string, aggregate models.TeamAggregate, n int) (models.TeamScore, error)
+	GetTeamLeaderboard(quizID string, aggregate models.TeamAggregate, n int) (models.TeamLeaderboard, error)
+	CreateTeam(team models.Team) (models.Team, error)
+	DeleteTeam(id string) error
+	AddMember(teamID, userName string) (models.Team, error)
+	RemoveMember(teamID, userName string) (models.Team, error)
+}
+
+type service struct {
+	storage storage.Storage
+	logger  log.Logger
+}
+
+func NewService(storage storage.Storage, logger log.Logger) Service {
+	return service{
+		storage,
+		logger,
+	}
+}
+
+func (s service) GetTeams() ([]models.Team, error) {
+	return s.storage.GetTeams()
+}
+
+// GetTeamScore returns the score of the team at the quiz with the attempt of
+// every member.
+func (s service) GetTeamScore(teamID, quizID string, aggregate models.TeamAggregate, n int) (models.TeamScore, error) {
+	aggregate, n, err := checkAggregate(aggregate, n)
+	if err != nil {
+		return models.TeamScore{}, err
+	}
+	if _, err := s.storage.GetQuiz(quizID); err != nil {
+		return models.TeamScore{}, err
+	}
+	team, err := s.storage.GetTeam(teamID)
+	if err != nil {
+		return models.TeamScore{}, err
+	}
+	return s.teamScore(team, quizID, aggregate, n)
+}
+
+// GetTeamLeaderboard ranks the teams with at least one member who submitted
+// the quiz by their score.
+func (s service) GetTeamLeaderboard(quizID string, aggregate models.TeamAggregate, n int) (models.TeamLeaderboard, error) {
+	aggregate, n, err := checkAggregate(aggregate, n)
+	if err != nil {
+		return models.TeamLeaderboard{}, err
+	}
+	if _, err := s.storage.GetQuiz(quizID); err != nil {
+		return models.TeamLeaderboard{}, err
+	}
+	teams, err := s.storage.GetTeams()
+	if err != nil {
+		return models.TeamLeaderboard{}, err
+	}
+
+	entries := make([]models.TeamScore, 0, len(teams))
+	for _, team := range teams {
+		score, err := s.teamScore(team, quizID, aggregate, n)
+		if err != nil {
+			return models.TeamLeaderboard{}, err
+		}
+		if score.Participants > 0 {
+			score.Members = nil
+			entries = append(entries, score)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Score > entries[j].Score
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+		if i > 0 && entries[i].Score == entries[i-1].Score {
+			entries[i].Rank = entries[i-1].Rank
+		}
+	}
+
+	leaderboard := models.TeamLeaderboard{QuizID: quizID, Aggregate: aggregate, Entries: entries}
+	if aggregate == models.AggregateBest {
+		leaderboard.N = n
+	}
+	return leaderboard, nil
+}
+
+// CreateTeam creates the team with its members, which must be registered
+// users.
+func (s service) CreateTeam(team models.Team) (models.Team, error) {
+	if err := team.Validate(); err != nil {
+		return models.Team{}, err
+	}
+	for _, member := range team.Members {
+		if err := s.checkUser(member); err != nil {
+			return models.Team{}, err
+		}
+	}
+	if err := s.storage.CreateTeam(team); err != nil {
+		return models.Team{}, err
+	}
+	return s.storage.GetTeam(team.ID)
+}
+
+func (s service) DeleteTeam(id string) error {
+	return s.storage.DeleteTeam(id)
+}
+
+// AddMember adds the registered user to the team.
+func (s service) AddMember(teamID, userName string) (models.Team, error) {
+	if err := s.checkUser(userName); err != nil {
+		return models.Team{}, err
+	}
+	if err := s.storage.AddTeamMember(teamID, userName); err != nil {
+		return models.Team{}, err
+	}
+	return s.storage.GetTeam(teamID)
+}
+
+func (s service) RemoveMember(teamID, userName string) (models.Team, error) {
+	if err := s.storage.RemoveTeamMember(teamID, userName); err != nil {
+		return models.Team{}, err
+	}
+	return s.storage.GetTeam(teamID)
+}
+
+// checkUser returns storage.ErrUserNotFound unless a user registered under
+// the name.
+func (s service) checkUser(userName string) error {
+	_, err := s.storage.GetUserByName(userName)
+	if stderrors.Is(err, storage.ErrUserNotFound) {
+		return fmt.Errorf("%w %q", err, userName)
+	}
+	return err
+}
+
+// checkAggregate returns the aggregate, the sum if none is given, and the
+// number of members the best aggregate counts.
+func checkAggregate(aggregate models.TeamAggregate, n int) (models.TeamAggregate, int, error) {
+	switch aggregate {
+	case "":
+		aggregate = models.AggregateSum
+	case models.AggregateSum, models.AggregateAverage, models.AggregateBest:
+	default:
+		return "", 0, errors.BadRequest("The aggregate must be sum, average or best")
+	}
+	if n == 0 {
+		n = DefaultBestN
+	}
+	if n < 0 {
+		return "", 0, errors.BadRequest("The n must be at least 1")
+	}
+	return aggregate, n, nil
+}
+
+// teamScore scores the team from the ranked attempts of its members. The best
+// aggregate counts the n members with the highest percentages, the others
+// every member who submitted the quiz.
+func (s service) teamScore(team models.Team, quizID string, aggregate models.TeamAggregate, n int) (models.TeamScore, error) {
+	score := models.TeamScore{TeamID: team.ID, Name: team.Name, Members: make([]models.MemberScore, 0, len(team.Members))}
+	var submitted []int
+	for _, userName := range team.Members {
+		member := models.MemberScore{UserName: userName}
+		ranked, err := s.storage.GetUserSubmission(quizID, userName)
+		switch {
+		case err == nil:
+			member.Submitted = true
+			member.Attempt = ranked.Attempt
+			member.Score = ranked.Score
+			member.MaxScore = ranked.MaxScore
+			member.Percentage = ranked.Percentage
+			member.SubmittedAt = &ranked.SubmittedAt
+			submitted = append(submitted, len(score.Members))
+		case !stderrors.Is(err, storage.ErrSubmissionNotFound):
+			return models.TeamScore{}, err
+		}
+		score.Members = append(score.Members, member)
+	}
+
+	counted := submitted
+	if aggregate == models.AggregateBest {
+		sort.SliceStable(counted, func(i, j int) bool {
+			return score.Members[counted[i]].Percentage > score.Members[counted[j]].Percentage
+		})
+		counted = counted[:min(n, len(counted))]
+	}
+
+	var sum float64
+	for _, i := range counted {
+		score.Members[i].Counted = true
+		sum += score.Members[i].Percentage
+	}
+	score.Participants = len(submitted)
+	score.Score = math.Round(sum*100) / 100
+	if aggregate == models.AggregateAverage && len(counted) > 0 {
+		score.Score = math.Round(sum/float64(len(counted))*100) / 100
+	}
+	return score, nil
+}
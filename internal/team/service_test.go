@@ -0,0 +1,142 @@
+package team_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/internal/team"
+	"github.com/courage173/quiz-api/pkg/log"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newService returns a service with the teams red (Ann, Bob and Cid) and blue
+// (Dan and Eve), the users Ann to Fay and the submissions of every member but
+// Cid.
+func newService(t *testing.T) team.Service {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	service := team.NewService(store, logger)
+	for _, userName := range []string{"Ann", "Bob", "Cid", "Dan", "Eve", "Fay"} {
+		require.NoError(t, store.CreateUser(models.User{ID: userName, UserName: userName, Role: models.RoleParticipant}))
+	}
+
+	_, err := service.CreateTeam(models.Team{ID: "red", Name: "Red", Members: []string{"Bob", "Ann", "Cid"}})
+	require.NoError(t, err)
+	_, err = service.CreateTeam(models.Team{ID: "blue", Name: "Blue", Members: []string{"Dan", "Eve"}})
+	require.NoError(t, err)
+	for userName, percentage := range map[string]float64{"Ann": 90, "Bob": 40, "Dan": 70, "Eve": 60} {
+		_, err := store.AddUserSubmission(models.Result{
+			QuizID: models.DefaultQuizID, UserName: userName,
+			Score: percentage / 10, MaxScore: 10, Percentage: percentage,
+		})
+		require.NoError(t, err)
+	}
+	return service
+}
+
+func TestService_GetTeamScore(t *testing.T) {
+	service := newService(t)
+
+	score, err := service.GetTeamScore("red", models.DefaultQuizID, "", 0)
+	require.NoError(t, err)
+	assert.Equal(t, 130.0, score.Score)
+	assert.Equal(t, 2, score.Participants)
+	require.Len(t, score.Members, 3)
+	assert.Equal(t, "Ann", score.Members[0].UserName)
+	assert.True(t, score.Members[0].Counted)
+	assert.Equal(t, models.MemberScore{UserName: "Cid"}, score.Members[2])
+
+	score, err = service.GetTeamScore("red", models.DefaultQuizID, models.AggregateAverage, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 65.0, score.Score)
+
+	score, err = service.GetTeamScore("red", models.DefaultQuizID, models.AggregateBest, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 90.0, score.Score)
+	assert.True(t, score.Members[0].Counted)
+	assert.False(t, score.Members[1].Counted)
+
+	_, err = service.GetTeamScore("green", models.DefaultQuizID, "", 0)
+	assert.ErrorIs(t, err, storage.ErrTeamNotFound)
+	_, err = service.GetTeamScore("red", "unknown", "", 0)
+	assert.ErrorIs(t, err, storage.ErrQuizNotFound)
+	_, err = service.GetTeamScore("red", models.DefaultQuizID, "median", 0)
+	assert.EqualError(t, err, "The aggregate must be sum, average or best")
+	_, err = service.GetTeamScore("red", models.DefaultQuizID, models.AggregateBest, -1)
+	assert.EqualError(t, err, "The n must be at least 1")
+}
+
+func TestService_GetTeamLeaderboard(t *testing.T) {
+	service := newService(t)
+	_, err := service.CreateTeam(models.Team{ID: "green", Name: "Green", Members: []string{"Fay"}})
+	require.NoError(t, err)
+
+	tests := []struct {
+		aggregate models.TeamAggregate
+		n         int
+		want      []string
+	}{
+		{models.AggregateSum, 0, []string{"1 blue 130", "1 red 130"}},
+		{models.AggregateAverage, 0, []string{"1 blue 65", "1 red 65"}},
+		{models.AggregateBest, 1, []string{"1 red 90", "2 blue 70"}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.aggregate), func(t *testing.T) {
+			leaderboard, err := service.GetTeamLeaderboard(models.DefaultQuizID, tt.aggregate, tt.n)
+			require.NoError(t, err)
+			assert.Equal(t, tt.aggregate, leaderboard.Aggregate)
+
+			// green has no participants and is left out
+			var ranks []string
+			for _, entry := range leaderboard.Entries {
+				assert.Nil(t, entry.Members)
+				ranks = append(ranks, fmt.Sprintf("%d %s %g", entry.Rank, entry.TeamID, entry.Score))
+			}
+			assert.Equal(t, tt.want, ranks)
+		})
+	}
+
+	_, err = service.GetTeamLeaderboard("unknown", "", 0)
+	assert.ErrorIs(t, err, storage.ErrQuizNotFound)
+}
+
+func TestService_Members(t *testing.T) {
+	service := newService(t)
+
+	updated, err := service.AddMember("blue", "Ann")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ann", "Dan", "Eve"}, updated.Members)
+
+	// users can belong to several teams and are added once
+	updated, err = service.AddMember("blue", "Ann")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ann", "Dan", "Eve"}, updated.Members)
+
+	updated, err = service.RemoveMember("blue", "Dan")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Ann", "Eve"}, updated.Members)
+
+	_, err = service.RemoveMember("blue", "Dan")
+	assert.ErrorIs(t, err, storage.ErrMemberNotFound)
+	_, err = service.AddMember("green", "Dan")
+	assert.ErrorIs(t, err, storage.ErrTeamNotFound)
+	_, err = service.AddMember("blue", "Zed")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+	_, err = service.CreateTeam(models.Team{ID: "green", Name: "Green", Members: []string{"Ann", "Zed"}})
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = service.CreateTeam(models.Team{ID: "red", Name: "Red"})
+	assert.ErrorIs(t, err, storage.ErrTeamExists)
+	_, err = service.CreateTeam(models.Team{ID: "Not A Slug"})
+	assert.IsType(t, validation.Errors{}, err)
+
+	require.NoError(t, service.DeleteTeam("red"))
+	teams, err := service.GetTeams()
+	require.NoError(t, err)
+	require.Len(t, teams, 1)
+	assert.Equal(t, "blue", teams[0].ID)
+}
@@ -0,0 +1,132 @@
+package user
+
+import (
+	stderrors "errors"
+	"net/http"
+
+	"github.com/courage173/quiz-api/internal/auth"
+
+	"github.com/courage173/quiz-api/internal/errors"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// RegisterHandlers registers the routes registering and logging in users.
+// authHandler guards the routes of the logged in user.
+func RegisterHandlers(rg *routing.RouteGroup, service Service, authHandler routing.Handler, logger log.Logger) {
+	rg.Post("", register(service, logger))
+	rg.Post("/login", login(service, logger))
+	rg.Get("/me", authHandler, getProfile(service, logger))
+}
+
+// RegisterAdminHandlers registers the routes listing users and changing their
+// roles. The route group is expected to be restricted to admins.
+func RegisterAdminHandlers(rg *routing.RouteGroup, service Service, logger log.Logger) {
+	rg.Get("", listUsers(service, logger))
+	rg.Put("/<id>/role", setRole(service, logger))
+}
+
+// toErrorResponse maps errors returned by the service to error responses.
+// Validation errors are passed on as they are.
+func toErrorResponse(err error) error {
+	switch {
+	case stderrors.Is(err, storage.ErrUserNotFound):
+		return errors.NotFound(err.Error())
+	case stderrors.Is(err, storage.ErrUserExists), stderrors.Is(err, storage.ErrUserNameUsed):
+		return errors.BadRequest(err.Error())
+	case stderrors.Is(err, bcrypt.ErrPasswordTooLong):
+		return errors.BadRequest("The password must be no more than 72 bytes")
+	case stderrors.Is(err, ErrInvalidCredentials):
+		return errors.Unauthorized("The user name or password is wrong")
+	}
+	return err
+}
+
+func register(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req models.Credentials
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		response, err := service.Register(req)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error registering user: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.WriteWithStatus(response, http.StatusCreated)
+	}
+}
+
+func login(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req models.Credentials
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		response, err := service.Login(req)
+		if err != nil {
+			logger.With(c.Request.Context()).Infof("Failed login of %q: %v", req.UserName, err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func getProfile(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		principal, ok := auth.CurrentPrincipal(c.Request.Context())
+		if !ok {
+			return errors.Unauthorized("")
+		}
+		if principal.UserID == "" {
+			return errors.NotFound("The admin token has no profile")
+		}
+
+		response, err := service.GetProfile(principal.UserID)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error getting user profile: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
+
+func listUsers(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		response, err := service.GetUsers()
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error listing users: %v", err)
+			return err
+		}
+		return c.Write(response)
+	}
+}
+
+func setRole(service Service, logger log.Logger) routing.Handler {
+	return func(c *routing.Context) error {
+		var req models.RoleRequest
+		if err := c.Read(&req); err != nil {
+			logger.With(c.Request.Context()).Errorf("Invalid request: %v", err)
+			return errors.BadRequest("")
+		}
+
+		response, err := service.SetRole(c.Param("id"), req.Role)
+		if err != nil {
+			logger.With(c.Request.Context()).Errorf("Error setting user role: %v", err)
+			return toErrorResponse(err)
+		}
+		return c.Write(response)
+	}
+}
@@ -0,0 +1,118 @@
+package user_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/courage173/quiz-api/internal/auth"
+	"github.com/courage173/quiz-api/internal/errors"
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/internal/user"
+	"github.com/courage173/quiz-api/pkg/log"
+	routing "github.com/go-ozzo/ozzo-routing/v2"
+	"github.com/go-ozzo/ozzo-routing/v2/content"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupRouter(t *testing.T) *routing.Router {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	// a submission from before accounts
+	_, err := store.AddUserSubmission(models.Result{QuizID: models.DefaultQuizID, UserName: "cid", Score: 1, MaxScore: 2, Percentage: 50})
+	require.NoError(t, err)
+	service := user.NewService(store, tokens, logger)
+
+	router := routing.New()
+	router.Use(errors.Handler(logger), content.TypeNegotiator(content.JSON), auth.Handler(tokens, service, "admin-secret"))
+	user.RegisterHandlers(router.Group("/v1/users"), service, auth.RequireRole(models.RoleParticipant), logger)
+	admin := router.Group("/v1/admin/users")
+	admin.Use(auth.RequireRole(models.RoleAdmin))
+	user.RegisterAdminHandlers(admin, service, logger)
+	return router
+}
+
+func TestUserHandlers(t *testing.T) {
+	router := setupRouter(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		wantCode int
+		wantBody string
+	}{
+		{"register", "POST", "/v1/users", `{"userName":"ann","password":"correct horse"}`, http.StatusCreated, `"userName":"ann"`},
+		{"register invalid", "POST", "/v1/users", `{"userName":"ann"}`, http.StatusBadRequest, "password"},
+		{"register password over 72 bytes", "POST", "/v1/users", `{"userName":"dan","password":"` + strings.Repeat("日", 25) + `"}`, http.StatusBadRequest, "72 bytes"},
+		{"register multibyte password", "POST", "/v1/users", `{"userName":"eve","password":"` + strings.Repeat("日", 24) + `"}`, http.StatusCreated, `"userName":"eve"`},
+		{"register existing", "POST", "/v1/users", `{"userName":"ann","password":"another password"}`, http.StatusBadRequest, "already exists"},
+		{"register name with submissions", "POST", "/v1/users", `{"userName":"cid","password":"correct horse"}`, http.StatusBadRequest, "earlier submissions"},
+		{"login with wrong password", "POST", "/v1/users/login", `{"userName":"ann","password":"wrong horse"}`, http.StatusUnauthorized, "user name or password"},
+		{"login unknown user", "POST", "/v1/users/login", `{"userName":"bob","password":"correct horse"}`, http.StatusUnauthorized, "user name or password"},
+		{"profile without token", "GET", "/v1/users/me", "", http.StatusUnauthorized, ""},
+		{"login", "POST", "/v1/users/login", `{"userName":"ann","password":"correct horse"}`, http.StatusOK, `"token"`},
+	}
+
+	// the cases build on each other and run in order
+	var body string
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, tt.wantCode, resp.Code, tt.name)
+		assert.Contains(t, resp.Body.String(), tt.wantBody, tt.name)
+		assert.NotContains(t, resp.Body.String(), "passwordHash", tt.name)
+		body = resp.Body.String()
+	}
+
+	var login models.LoginResponse
+	require.NoError(t, json.Unmarshal([]byte(body), &login))
+
+	req := httptest.NewRequest("GET", "/v1/users/me", nil)
+	req.Header.Set("Authorization", "Bearer "+login.Token)
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Contains(t, resp.Body.String(), `"userName":"ann"`)
+	assert.NotContains(t, resp.Body.String(), "passwordHash")
+
+	admin := []struct {
+		name     string
+		method   string
+		url      string
+		body     string
+		token    string
+		wantCode int
+		wantBody string
+	}{
+		{"list users as participant", "GET", "/v1/admin/users", "", login.Token, http.StatusForbidden, ""},
+		{"list users", "GET", "/v1/admin/users", "", "admin-secret", http.StatusOK, `"role":"participant"`},
+		{"set role", "PUT", "/v1/admin/users/" + login.User.ID + "/role", `{"role":"author"}`, "admin-secret", http.StatusOK, `"role":"author"`},
+		{"promote to admin", "PUT", "/v1/admin/users/" + login.User.ID + "/role", `{"role":"admin"}`, "admin-secret", http.StatusOK, `"role":"admin"`},
+		{"list users after promotion", "GET", "/v1/admin/users", "", login.Token, http.StatusOK, `"role":"admin"`},
+		{"set unknown role", "PUT", "/v1/admin/users/" + login.User.ID + "/role", `{"role":"owner"}`, "admin-secret", http.StatusBadRequest, "role"},
+		{"set role of unknown user", "PUT", "/v1/admin/users/unknown/role", `{"role":"admin"}`, "admin-secret", http.StatusNotFound, "user not found"},
+		{"profile of admin token", "GET", "/v1/users/me", "", "admin-secret", http.StatusNotFound, "no profile"},
+	}
+	for _, tt := range admin {
+		req := httptest.NewRequest(tt.method, tt.url, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		resp := httptest.NewRecorder()
+
+		router.ServeHTTP(resp, req)
+
+		assert.Equal(t, tt.wantCode, resp.Code, tt.name)
+		assert.Contains(t, resp.Body.String(), tt.wantBody, tt.name)
+	}
+}
@@ -0,0 +1,137 @@
+package user
+
+import (
+	stderrors "errors"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/auth"
+
+	"github.com/courage173/quiz-api/internal/models"
+
+	"github.com/courage173/quiz-api/internal/storage"
+
+	"github.com/courage173/quiz-api/pkg/log"
+
+	"github.com/google/uuid"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInvalidCredentials is returned on login with an unknown user name or a
+// wrong password. The two are not told apart.
+var ErrInvalidCredentials = stderrors.New("invalid user name or password")
+
+// Service registers users, logs them in and manages their roles.
+type Service interface {
+	Register(credentials models.Credentials) (models.UserProfile, error)
+	Login(credentials models.Credentials) (models.LoginResponse, error)
+	GetProfile(id string) (models.UserProfile, error)
+	GetUsers() ([]models.UserProfile, error)
+	SetRole(id string, role models.Role) (models.UserProfile, error)
+	Resolve(id string) (auth.Principal, error)
+}
+
+type service struct {
+	storage storage.Storage
+	tokens  *auth.Tokens
+	logger  log.Logger
+}
+
+func NewService(storage storage.Storage, tokens *auth.Tokens, logger log.Logger) Service {
+	return service{
+		storage,
+		tokens,
+		logger,
+	}
+}
+
+// Register creates a participant with the credentials. Only the bcrypt hash
+// of the password is stored.
+func (s service) Register(credentials models.Credentials) (models.UserProfile, error) {
+	if err := credentials.Validate(); err != nil {
+		return models.UserProfile{}, err
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(credentials.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+
+	user := models.User{
+		ID:           uuid.NewString(),
+		UserName:     credentials.UserName,
+		PasswordHash: string(hash),
+		Role:         models.RoleParticipant,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := s.storage.CreateUser(user); err != nil {
+		return models.UserProfile{}, err
+	}
+	return user.Profile(), nil
+}
+
+// dummyHash is compared against on logins of unknown users so that they take
+// as long as logins with a wrong password.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("password"), bcrypt.DefaultCost)
+
+// Login checks the credentials and issues a token for the user.
+func (s service) Login(credentials models.Credentials) (models.LoginResponse, error) {
+	user, err := s.storage.GetUserByName(credentials.UserName)
+	if stderrors.Is(err, storage.ErrUserNotFound) {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(credentials.Password))
+		return models.LoginResponse{}, ErrInvalidCredentials
+	}
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(credentials.Password)); err != nil {
+		return models.LoginResponse{}, ErrInvalidCredentials
+	}
+
+	token, expiresAt, err := s.tokens.Issue(user)
+	if err != nil {
+		return models.LoginResponse{}, err
+	}
+	return models.LoginResponse{Token: token, ExpiresAt: expiresAt, User: user.Profile()}, nil
+}
+
+func (s service) GetProfile(id string) (models.UserProfile, error) {
+	user, err := s.storage.GetUser(id)
+	if err != nil {
+		return models.UserProfile{}, err
+	}
+	return user.Profile(), nil
+}
+
+func (s service) GetUsers() ([]models.UserProfile, error) {
+	users, err := s.storage.GetUsers()
+	if err != nil {
+		return nil, err
+	}
+	profiles := make([]models.UserProfile, len(users))
+	for i, user := range users {
+		profiles[i] = user.Profile()
+	}
+	return profiles, nil
+}
+
+// SetRole changes the role of the user. It applies to the tokens issued
+// before, as the auth middleware resolves their user again.
+func (s service) SetRole(id string, role models.Role) (models.UserProfile, error) {
+	if err := (models.RoleRequest{Role: role}).Validate(); err != nil {
+		return models.UserProfile{}, err
+	}
+	if err := s.storage.SetUserRole(id, role); err != nil {
+		return models.UserProfile{}, err
+	}
+	return s.GetProfile(id)
+}
+
+// Resolve returns the principal of the user with its current role, for the
+// auth middleware to authenticate the tokens of the user as.
+func (s service) Resolve(id string) (auth.Principal, error) {
+	user, err := s.storage.GetUser(id)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+	return auth.Principal{UserID: user.ID, UserName: user.UserName, Role: user.Role}, nil
+}
@@ -0,0 +1,105 @@
+package user_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/courage173/quiz-api/internal/auth"
+	"github.com/courage173/quiz-api/internal/models"
+	"github.com/courage173/quiz-api/internal/storage"
+	"github.com/courage173/quiz-api/internal/user"
+	"github.com/courage173/quiz-api/pkg/log"
+	validation "github.com/go-ozzo/ozzo-validation/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var tokens = auth.NewTokens([]byte("secret"), time.Hour)
+
+func TestService_Register(t *testing.T) {
+	logger, _ := log.NewForTest()
+	store := storage.NewStorage(storage.RankLatest)
+	service := user.NewService(store, tokens, logger)
+
+	profile, err := service.Register(models.Credentials{UserName: "ann", Password: "correct horse"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, profile.ID)
+	assert.Equal(t, "ann", profile.UserName)
+
+	stored, err := store.GetUser(profile.ID)
+	require.NoError(t, err)
+	assert.NotEmpty(t, stored.PasswordHash)
+	assert.NotContains(t, stored.PasswordHash, "correct horse")
+
+	_, err = service.Register(models.Credentials{UserName: "ann", Password: "another password"})
+	assert.ErrorIs(t, err, storage.ErrUserExists)
+
+	for _, credentials := range []models.Credentials{
+		{UserName: "bo", Password: "long enough"},
+		{UserName: "bob smith", Password: "long enough"},
+		{UserName: "bob", Password: "short"},
+	} {
+		_, err = service.Register(credentials)
+		assert.IsType(t, validation.Errors{}, err, credentials.UserName)
+	}
+}
+
+func TestService_Login(t *testing.T) {
+	logger, _ := log.NewForTest()
+	service := user.NewService(storage.NewStorage(storage.RankLatest), tokens, logger)
+
+	profile, err := service.Register(models.Credentials{UserName: "ann", Password: "correct horse"})
+	require.NoError(t, err)
+
+	response, err := service.Login(models.Credentials{UserName: "ann", Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, profile, response.User)
+	assert.True(t, response.ExpiresAt.After(time.Now()))
+	principal, err := tokens.Verify(response.Token)
+	require.NoError(t, err)
+	assert.Equal(t, auth.Principal{UserID: profile.ID, UserName: "ann", Role: models.RoleParticipant}, principal)
+
+	_, err = service.Login(models.Credentials{UserName: "ann", Password: "wrong horse"})
+	assert.ErrorIs(t, err, user.ErrInvalidCredentials)
+	_, err = service.Login(models.Credentials{UserName: "bob", Password: "correct horse"})
+	assert.ErrorIs(t, err, user.ErrInvalidCredentials)
+
+	got, err := service.GetProfile(profile.ID)
+	require.NoError(t, err)
+	assert.Equal(t, profile, got)
+	_, err = service.GetProfile("unknown")
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+func TestService_SetRole(t *testing.T) {
+	logger, _ := log.NewForTest()
+	service := user.NewService(storage.NewStorage(storage.RankLatest), tokens, logger)
+
+	ann, err := service.Register(models.Credentials{UserName: "ann", Password: "correct horse"})
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleParticipant, ann.Role)
+	_, err = service.Register(models.Credentials{UserName: "bob", Password: "correct horse"})
+	require.NoError(t, err)
+
+	ann, err = service.SetRole(ann.ID, models.RoleAuthor)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAuthor, ann.Role)
+
+	// the role is carried by the tokens issued from then on
+	response, err := service.Login(models.Credentials{UserName: "ann", Password: "correct horse"})
+	require.NoError(t, err)
+	principal, err := tokens.Verify(response.Token)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleAuthor, principal.Role)
+
+	_, err = service.SetRole(ann.ID, "owner")
+	assert.IsType(t, validation.Errors{}, err)
+	_, err = service.SetRole("unknown", models.RoleAdmin)
+	assert.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	users, err := service.GetUsers()
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+	assert.Equal(t, "ann", users[0].UserName)
+	assert.Equal(t, models.RoleParticipant, users[1].Role)
+}
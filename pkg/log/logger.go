@@ -40,6 +40,7 @@ type contextKey int
 const (
 	requestIDKey contextKey = iota
 	correlationIDKey
+	userIDKey
 )
 
 // New creates a new logger using the default configuration.
@@ -62,7 +63,8 @@ func NewForTest() (Logger, *observer.ObservedLogs) {
 // With returns a logger based off the root logger and decorates it with the given context and arguments.
 //
 // If the context contains request ID and/or correlation ID information (recorded via WithRequestID()
-// and WithCorrelationID()), they will be added to every log message generated by the new logger.
+// and WithCorrelationID()), they will be added to every log message generated by the new logger, as
+// will the user ID recorded via WithUserID().
 //
 // The arguments should be specified as a sequence of name, value pairs with names being strings.
 // The arguments will also be added to every log message generated by the logger.
@@ -74,6 +76,9 @@ func (l *logger) With(ctx context.Context, args ...interface{}) Logger {
 		if id, ok := ctx.Value(correlationIDKey).(string); ok {
 			args = append(args, zap.String("correlation_id", id))
 		}
+		if id, ok := ctx.Value(userIDKey).(string); ok {
+			args = append(args, zap.String("user_id", id))
+		}
 	}
 	if len(args) > 0 {
 		return &logger{l.SugaredLogger.With(args...)}
@@ -94,6 +99,11 @@ func WithRequest(ctx context.Context, req *http.Request) context.Context {
 	return ctx
 }
 
+// WithUserID returns a context which knows the ID of the user making the request.
+func WithUserID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, userIDKey, id)
+}
+
 // getCorrelationID extracts the correlation ID from the HTTP request
 func getCorrelationID(req *http.Request) string {
 	return req.Header.Get("X-Correlation-ID")